@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/acai-travel/tech-challenge/internal/pb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// audit runs the audit command, listing or exporting the audit log.
+func audit(ctx context.Context, cli pb.ChatService, args []string) {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	user := fs.String("user", "", "Only list events of this user")
+	action := fs.String("action", "", "Only list events of this action, e.g. describe or delete")
+	conversation := fs.String("conversation", "", "Only list events of this conversation")
+	outcome := fs.String("outcome", "", "Only list events with this outcome, ok or a Twirp error code")
+	from := fs.String("from", "", "Only list events on or after this date (YYYY-MM-DD)")
+	to := fs.String("to", "", "Only list events before this date (YYYY-MM-DD)")
+	limit := fs.Int("limit", 50, "Maximum number of events")
+	output := fs.String("o", "", "Export every matching event as JSONL to this file, - for stdout")
+	_ = fs.Parse(args)
+
+	filter := &pb.AuditFilter{
+		UserId:         *user,
+		Action:         *action,
+		ConversationId: *conversation,
+		Outcome:        *outcome,
+	}
+
+	if *from != "" {
+		t, err := time.Parse(time.DateOnly, *from)
+		if err != nil {
+			fmt.Printf("Error parsing -from: %v\n", err)
+			os.Exit(1)
+		}
+		filter.From = timestamppb.New(t)
+	}
+
+	if *to != "" {
+		t, err := time.Parse(time.DateOnly, *to)
+		if err != nil {
+			fmt.Printf("Error parsing -to: %v\n", err)
+			os.Exit(1)
+		}
+		filter.To = timestamppb.New(t)
+	}
+
+	if *output != "" {
+		out := os.Stdout
+		if *output != "-" {
+			f, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+			if err != nil {
+				fmt.Printf("Error writing export: %v\n", err)
+				os.Exit(1)
+			}
+			defer f.Close()
+			out = f
+		}
+
+		req := &pb.ExportAuditEventsRequest{Filter: filter}
+		for {
+			resp, err := cli.ExportAuditEvents(ctx, req)
+			if err != nil {
+				fmt.Printf("Error exporting audit events: %v\n", err)
+				os.Exit(1)
+			}
+
+			if _, err := out.Write(resp.GetContent()); err != nil {
+				fmt.Printf("Error writing export: %v\n", err)
+				os.Exit(1)
+			}
+
+			if req.PageToken = resp.GetNextPageToken(); req.PageToken == "" {
+				break
+			}
+		}
+
+		if *output != "-" {
+			fmt.Printf("Exported audit events to %s\n", *output)
+		}
+		return
+	}
+
+	resp, err := cli.ListAuditEvents(ctx, &pb.ListAuditEventsRequest{Filter: filter, PageSize: int32(*limit)})
+	if err != nil {
+		fmt.Printf("Error listing audit events: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(resp.GetEvents()) == 0 {
+		fmt.Println("No audit events found.")
+		return
+	}
+
+	fmt.Println("TIME                   USER                 ACTION       CONVERSATION               OUTCOME            CLIENT IP")
+	for _, e := range resp.GetEvents() {
+		fmt.Printf("%s   %-20s %-12s %-26s %-18s %s\n",
+			e.GetTimestamp().AsTime().Format(time.DateTime), e.GetUserId(), e.GetAction(), e.GetConversationId(), e.GetOutcome(), e.GetClientIp())
+	}
+
+	if resp.GetNextPageToken() != "" {
+		fmt.Printf("\nShowing the latest %d events, use -limit to see more.\n", len(resp.GetEvents()))
+	}
+}
@@ -5,11 +5,16 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/acai-travel/tech-challenge/internal/config"
 	"github.com/acai-travel/tech-challenge/internal/pb"
+	"github.com/twitchtv/twirp"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 func main() {
@@ -19,6 +24,17 @@ func main() {
 		fmt.Println("  ask        Create a new conversation with assistant or continue an existing one")
 		fmt.Println("  list       List existing conversations")
 		fmt.Println("  show       Show conversation by ID")
+		fmt.Println("  edit       Edit a message and get a new reply to it")
+		fmt.Println("  regenerate Replace the last reply of a conversation with a new one")
+		fmt.Println("  fork       Copy a conversation up to a message into a new conversation")
+		fmt.Println("  delete     Delete a conversation")
+		fmt.Println("  feedback   Rate a reply up or down")
+		fmt.Println("  personas   List, show, create, update or delete personas")
+		fmt.Println("  memories   List what the assistant remembers about you, or forget it")
+		fmt.Println("  search     Search conversation titles and messages")
+		fmt.Println("  export     Export conversations as JSON, Markdown or JSONL")
+		fmt.Println("  import     Import conversations from a JSON or JSONL export")
+		fmt.Println("  audit      List or export who accessed or changed which conversation (admins only)")
 	}
 
 	if len(os.Args) < 2 {
@@ -28,22 +44,38 @@ func main() {
 		os.Exit(-1)
 	}
 
-	url := "http://localhost:8080"
-	if v := os.Getenv("API_URL"); v != "" {
-		url = v
+	cfg, err := config.LoadClient()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
 	}
 
-	cli := pb.NewChatServiceJSONClient(url, http.DefaultClient)
+	cli := pb.NewChatServiceJSONClient(cfg.URL, http.DefaultClient)
 	ctx := context.Background()
 
+	if cfg.APIKey != "" {
+		header := make(http.Header)
+		header.Set("Authorization", "Bearer "+cfg.APIKey)
+
+		var err error
+		if ctx, err = twirp.WithHTTPRequestHeaders(ctx, header); err != nil {
+			fmt.Printf("Error setting API key: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	switch os.Args[1] {
 	case "ask":
+		fs := flag.NewFlagSet("ask", flag.ExitOnError)
+		persona := fs.String("persona", "", "Persona answering a new conversation")
+		_ = fs.Parse(os.Args[2:])
+
 		fmt.Println("Press CMD+C to exit.")
 		fmt.Println()
 
 		cid := ""
-		if len(os.Args) >= 3 {
-			cid = os.Args[2]
+		if fs.NArg() >= 1 {
+			cid = fs.Arg(0)
 			resp, err := cli.DescribeConversation(ctx, &pb.DescribeConversationRequest{ConversationId: cid})
 
 			if err != nil {
@@ -78,6 +110,7 @@ func main() {
 			if cid == "" {
 				out, err := cli.StartConversation(ctx, &pb.StartConversationRequest{
 					Message: string(line),
+					Persona: *persona,
 				})
 
 				if err != nil {
@@ -125,13 +158,17 @@ func main() {
 			fmt.Printf("%s   %s\n", conv.GetId(), conv.GetTitle())
 		}
 	case "show":
-		if len(os.Args) < 3 {
+		fs := flag.NewFlagSet("show", flag.ExitOnError)
+		versions := fs.Bool("versions", false, "Also show earlier versions of edited messages and regenerated replies, and prompt versions")
+		_ = fs.Parse(os.Args[2:])
+
+		if fs.NArg() < 1 {
 			fmt.Println("Error: Conversation ID is required")
 			os.Exit(1)
 		}
 
 		resp, err := cli.DescribeConversation(ctx, &pb.DescribeConversationRequest{
-			ConversationId: os.Args[2],
+			ConversationId: fs.Arg(0),
 		})
 
 		if err != nil {
@@ -142,9 +179,365 @@ func main() {
 		fmt.Println("ID:", resp.GetConversation().GetId())
 		fmt.Println("Title:", resp.GetConversation().GetTitle())
 		fmt.Println("Timestamp:", resp.GetConversation().GetTimestamp().AsTime().Format(time.RFC1123))
+		if resp.GetConversation().GetPersona() != "" {
+			fmt.Println("Persona:", resp.GetConversation().GetPersona())
+		}
 		fmt.Println("")
 		for _, msg := range resp.GetConversation().GetMessages() {
-			fmt.Printf("%s, %s:\n%s\n\n", msg.GetRole(), msg.GetTimestamp().AsTime().Format(time.TimeOnly), msg.GetContent())
+			printMessage(msg, *versions)
+		}
+
+		if len(resp.GetTree().GetForks()) > 0 {
+			fmt.Println("Forks:")
+			printTree(resp.GetTree(), resp.GetConversation().GetId(), "")
+		}
+	case "fork":
+		fs := flag.NewFlagSet("fork", flag.ExitOnError)
+		title := fs.String("title", "", "Title of the fork, the title of the conversation by default")
+		_ = fs.Parse(os.Args[2:])
+
+		if fs.NArg() < 1 {
+			fmt.Println("Error: Conversation ID is required")
+			os.Exit(1)
+		}
+
+		out, err := cli.ForkConversation(ctx, &pb.ForkConversationRequest{
+			ConversationId: fs.Arg(0),
+			MessageId:      fs.Arg(1),
+			Title:          *title,
+		})
+
+		if err != nil {
+			fmt.Printf("Error forking conversation: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Println("Forked conversation:")
+		fmt.Println("ID:", out.GetConversation().GetId())
+		fmt.Println("Title:", out.GetConversation().GetTitle())
+		fmt.Println()
+		fmt.Printf("Continue it with: ask %s\n", out.GetConversation().GetId())
+	case "delete":
+		if len(os.Args) < 3 {
+			fmt.Println("Error: Conversation ID is required")
+			os.Exit(1)
+		}
+
+		if _, err := cli.DeleteConversation(ctx, &pb.DeleteConversationRequest{ConversationId: os.Args[2]}); err != nil {
+			fmt.Printf("Error deleting conversation: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Println("Deleted conversation:", os.Args[2])
+	case "feedback":
+		fs := flag.NewFlagSet("feedback", flag.ExitOnError)
+		category := fs.String("category", "", "Reason for the rating: helpful, inaccurate, incomplete, off_topic, harmful or other")
+		comment := fs.String("comment", "", "Free text comment")
+		_ = fs.Parse(os.Args[2:])
+
+		if fs.NArg() != 3 {
+			fmt.Println("Error: Conversation ID, reply ID and up or down are required")
+			os.Exit(1)
+		}
+
+		rating, ok := map[string]pb.Feedback_Rating{"up": pb.Feedback_UP, "down": pb.Feedback_DOWN}[fs.Arg(2)]
+		if !ok {
+			fmt.Printf("Error: Rating must be up or down, got %q\n", fs.Arg(2))
+			os.Exit(1)
+		}
+
+		out, err := cli.SubmitFeedback(ctx, &pb.SubmitFeedbackRequest{
+			ConversationId: fs.Arg(0),
+			MessageId:      fs.Arg(1),
+			Rating:         rating,
+			Category:       *category,
+			Comment:        *comment,
+		})
+
+		if err != nil {
+			fmt.Printf("Error submitting feedback: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Println("Feedback recorded:", out.GetFeedback().GetId())
+	case "personas":
+		personas(ctx, cli, os.Args[2:])
+	case "memories":
+		memories(ctx, cli, os.Args[2:])
+	case "audit":
+		audit(ctx, cli, os.Args[2:])
+	case "edit":
+		if len(os.Args) < 5 {
+			fmt.Println("Error: Conversation ID, message ID and new message are required")
+			os.Exit(1)
+		}
+
+		out, err := cli.EditMessage(ctx, &pb.EditMessageRequest{
+			ConversationId: os.Args[2],
+			MessageId:      os.Args[3],
+			Content:        strings.Join(os.Args[4:], " "),
+		})
+
+		if err != nil {
+			fmt.Printf("Error editing message: %v\n", err)
+			os.Exit(1)
+		}
+
+		printMessage(out.GetMessage(), false)
+		fmt.Printf("ASSISTANT:\n%s\n", out.GetReply())
+	case "regenerate":
+		if len(os.Args) < 3 {
+			fmt.Println("Error: Conversation ID is required")
+			os.Exit(1)
+		}
+
+		out, err := cli.RegenerateReply(ctx, &pb.RegenerateReplyRequest{ConversationId: os.Args[2]})
+		if err != nil {
+			fmt.Printf("Error regenerating reply: %v\n", err)
+			os.Exit(1)
+		}
+
+		printMessage(out.GetMessage(), false)
+	case "search":
+		fs := flag.NewFlagSet("search", flag.ExitOnError)
+		from := fs.String("from", "", "Only match messages sent on or after this date (YYYY-MM-DD)")
+		to := fs.String("to", "", "Only match messages sent before this date (YYYY-MM-DD)")
+		limit := fs.Int("limit", 10, "Maximum number of results")
+		_ = fs.Parse(os.Args[2:])
+
+		if fs.NArg() == 0 {
+			fmt.Println("Error: Search query is required")
+			os.Exit(1)
+		}
+
+		req := &pb.SearchConversationsRequest{
+			Query:    strings.Join(fs.Args(), " "),
+			PageSize: int32(*limit),
+		}
+
+		if *from != "" {
+			t, err := time.Parse(time.DateOnly, *from)
+			if err != nil {
+				fmt.Printf("Error parsing -from: %v\n", err)
+				os.Exit(1)
+			}
+			req.From = timestamppb.New(t)
+		}
+
+		if *to != "" {
+			t, err := time.Parse(time.DateOnly, *to)
+			if err != nil {
+				fmt.Printf("Error parsing -to: %v\n", err)
+				os.Exit(1)
+			}
+			req.To = timestamppb.New(t)
+		}
+
+		resp, err := cli.SearchConversations(ctx, req)
+		if err != nil {
+			fmt.Printf("Error searching conversations: %v\n", err)
+			os.Exit(1)
+		}
+
+		if len(resp.GetHits()) == 0 {
+			if resp.GetTruncated() {
+				fmt.Println("No recent conversations found, older ones were not searched.")
+			} else {
+				fmt.Println("No conversations found.")
+			}
+			return
 		}
+
+		fmt.Println("ID                         TITLE")
+		for _, hit := range resp.GetHits() {
+			fmt.Printf("%s   %s\n", hit.GetConversationId(), highlight(hit.GetTitle(), hit.GetTitleHighlights()))
+			for _, snippet := range hit.GetSnippets() {
+				fmt.Printf("    %s %s: %s\n", snippet.GetRole(), snippet.GetMessageId(), highlight(snippet.GetText(), snippet.GetHighlights()))
+			}
+		}
+
+		if resp.GetNextPageToken() != "" {
+			fmt.Printf("\nShowing the first %d results, use -limit to see more.\n", len(resp.GetHits()))
+		}
+		if resp.GetTruncated() {
+			fmt.Println("\nOnly the most recent conversations and messages were searched.")
+		}
+	case "export":
+		fs := flag.NewFlagSet("export", flag.ExitOnError)
+		format := fs.String("format", "json", "Export format: json, markdown or jsonl")
+		output := fs.String("o", "", "Write the export to this file instead of stdout")
+		all := fs.Bool("all", false, "Export every conversation")
+		_ = fs.Parse(os.Args[2:])
+
+		f, err := parseFormat(*format)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		ids := fs.Args()
+		if *all {
+			resp, err := cli.ListConversations(ctx, &pb.ListConversationsRequest{})
+			if err != nil {
+				fmt.Printf("Error listing conversations: %v\n", err)
+				os.Exit(1)
+			}
+
+			for _, conv := range resp.GetConversations() {
+				ids = append(ids, conv.GetId())
+			}
+		}
+
+		if len(ids) == 0 {
+			fmt.Println("Error: Conversation ID is required")
+			os.Exit(1)
+		}
+
+		resp, err := cli.ExportConversation(ctx, &pb.ExportConversationRequest{ConversationIds: ids, Format: f})
+		if err != nil {
+			fmt.Printf("Error exporting conversations: %v\n", err)
+			os.Exit(1)
+		}
+
+		if *output == "" {
+			_, _ = os.Stdout.Write(resp.GetContent())
+			return
+		}
+
+		if err := os.WriteFile(*output, resp.GetContent(), 0o644); err != nil {
+			fmt.Printf("Error writing export: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Exported %d conversations to %s\n", len(ids), *output)
+	case "import":
+		fs := flag.NewFlagSet("import", flag.ExitOnError)
+		format := fs.String("format", "json", "Import format: json or jsonl")
+		overwrite := fs.Bool("overwrite", false, "Replace conversations that already exist")
+		_ = fs.Parse(os.Args[2:])
+
+		if fs.NArg() != 1 {
+			fmt.Println("Error: File to import is required, use - to read from stdin")
+			os.Exit(1)
+		}
+
+		f, err := parseFormat(*format)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		var content []byte
+		if fs.Arg(0) == "-" {
+			content, err = io.ReadAll(os.Stdin)
+		} else {
+			content, err = os.ReadFile(fs.Arg(0))
+		}
+
+		if err != nil {
+			fmt.Printf("Error reading import: %v\n", err)
+			os.Exit(1)
+		}
+
+		resp, err := cli.ImportConversations(ctx, &pb.ImportConversationsRequest{Format: f, Content: content, Overwrite: *overwrite})
+		if err != nil {
+			fmt.Printf("Error importing conversations: %v\n", err)
+			os.Exit(1)
+		}
+
+		for _, id := range resp.GetConversationIds() {
+			fmt.Println("Imported:", id)
+		}
+
+		for _, id := range resp.GetSkippedIds() {
+			fmt.Println("Skipped, already exists:", id)
+		}
+	}
+}
+
+// printMessage prints a message with its ID, which edit takes, and its
+// version once it was edited or regenerated.
+func printMessage(msg *pb.Conversation_Message, versions bool) {
+	version := ""
+	if msg.GetVersion() > 1 {
+		version = fmt.Sprintf(" (version %d)", msg.GetVersion())
+	}
+
+	fmt.Printf("%s %s, %s%s:\n%s\n\n", msg.GetRole(), msg.GetId(), msg.GetTimestamp().AsTime().Format(time.TimeOnly), version, msg.GetContent())
+
+	if !versions {
+		return
+	}
+
+	if msg.GetPromptVersion() != "" {
+		fmt.Printf("    prompt %s, model %s", msg.GetPromptVersion(), msg.GetModel())
+		if len(msg.GetTools()) > 0 {
+			fmt.Printf(", tools %s", strings.Join(msg.GetTools(), ", "))
+		}
+		fmt.Print("\n\n")
+	}
+
+	for _, v := range msg.GetPreviousVersions() {
+		prompt := ""
+		if v.GetPromptVersion() != "" {
+			prompt = ", prompt " + v.GetPromptVersion()
+		}
+
+		fmt.Printf("    version %d, %s%s:\n    %s\n\n", v.GetVersion(), v.GetTimestamp().AsTime().Format(time.TimeOnly), prompt,
+			strings.ReplaceAll(v.GetContent(), "\n", "\n    "))
+	}
+}
+
+// printTree prints a tree of forks, marking the current conversation.
+func printTree(node *pb.ConversationNode, current, indent string) {
+	title := node.GetTitle()
+	if node.GetDeleted() {
+		title = "(deleted)"
+	}
+
+	marker := "  "
+	if node.GetConversationId() == current {
+		marker = "* "
+	}
+
+	fmt.Printf("%s%s%s   %s\n", marker, indent, node.GetConversationId(), title)
+
+	for _, fork := range node.GetForks() {
+		printTree(fork, current, indent+"  ")
+	}
+}
+
+// highlight marks the matched terms of a search result in bold markdown.
+func highlight(text string, highlights []*pb.SearchHit_Highlight) string {
+	runes := []rune(text)
+
+	var sb strings.Builder
+	last := 0
+
+	for _, h := range highlights {
+		start, end := int(h.GetStart()), int(h.GetEnd())
+		if start < last || end > len(runes) || start > end {
+			continue
+		}
+
+		sb.WriteString(string(runes[last:start]))
+		sb.WriteString("**" + string(runes[start:end]) + "**")
+		last = end
+	}
+
+	sb.WriteString(string(runes[last:]))
+	return sb.String()
+}
+
+func parseFormat(format string) (pb.ExportFormat, error) {
+	switch strings.ToLower(format) {
+	case "json":
+		return pb.ExportFormat_JSON, nil
+	case "markdown", "md":
+		return pb.ExportFormat_MARKDOWN, nil
+	case "jsonl":
+		return pb.ExportFormat_JSONL, nil
+	default:
+		return 0, fmt.Errorf("unknown format %q", format)
 	}
 }
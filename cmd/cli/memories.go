@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/acai-travel/tech-challenge/internal/pb"
+)
+
+// memories runs the memories subcommands, listing memories by default.
+func memories(ctx context.Context, cli pb.ChatService, args []string) {
+	if len(args) == 0 || args[0] == "list" {
+		resp, err := cli.ListMemories(ctx, &pb.ListMemoriesRequest{})
+		if err != nil {
+			fmt.Printf("Error listing memories: %v\n", err)
+			os.Exit(1)
+		}
+
+		if len(resp.GetMemories()) == 0 {
+			fmt.Println("Nothing is remembered about you.")
+			return
+		}
+
+		fmt.Println("ID                         UPDATED            MEMORY")
+		for _, m := range resp.GetMemories() {
+			fmt.Printf("%s   %s   %s\n", m.GetId(), m.GetUpdatedAt().AsTime().Format(time.DateOnly+" 15:04"), m.GetContent())
+		}
+		return
+	}
+
+	switch args[0] {
+	case "forget":
+		if len(args) < 2 {
+			fmt.Println("Error: Memory ID is required")
+			os.Exit(1)
+		}
+
+		for _, id := range args[1:] {
+			if _, err := cli.DeleteMemory(ctx, &pb.DeleteMemoryRequest{MemoryId: id}); err != nil {
+				fmt.Printf("Error forgetting memory %s: %v\n", id, err)
+				os.Exit(1)
+			}
+
+			fmt.Println("Forgotten:", id)
+		}
+	default:
+		fmt.Println("Usage: memories [list|forget <id>...]")
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/acai-travel/tech-challenge/internal/pb"
+)
+
+// personas runs the personas subcommands.
+func personas(ctx context.Context, cli pb.ChatService, args []string) {
+	if len(args) == 0 {
+		fmt.Println("Usage: personas list|show|create|update|delete [options] [name]")
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "list":
+		resp, err := cli.ListPersonas(ctx, &pb.ListPersonasRequest{})
+		if err != nil {
+			fmt.Printf("Error listing personas: %v\n", err)
+			os.Exit(1)
+		}
+
+		if len(resp.GetPersonas()) == 0 {
+			fmt.Println("No personas found.")
+			return
+		}
+
+		fmt.Println("NAME                 DESCRIPTION")
+		for _, p := range resp.GetPersonas() {
+			fmt.Printf("%-20s %s\n", p.GetName(), p.GetDescription())
+		}
+	case "show":
+		if len(args) < 2 {
+			fmt.Println("Error: Persona name is required")
+			os.Exit(1)
+		}
+
+		resp, err := cli.GetPersona(ctx, &pb.GetPersonaRequest{Name: args[1]})
+		if err != nil {
+			fmt.Printf("Error getting persona: %v\n", err)
+			os.Exit(1)
+		}
+
+		printPersona(resp.GetPersona())
+	case "create", "update":
+		fs := flag.NewFlagSet(args[0], flag.ExitOnError)
+		description := fs.String("description", "", "What the persona is for")
+		prompt := fs.String("prompt", "", "System prompt, or @file to read it from a file")
+		model := fs.String("model", "", "Model answering, the default reply model if empty")
+		temperature := fs.Float64("temperature", -1, "Sampling temperature between 0 and 2, the model default if not set")
+		tools := fs.String("tools", "", "Comma separated tools the persona may call, every enabled tool if empty")
+		_ = fs.Parse(args[1:])
+
+		if fs.NArg() != 1 {
+			fmt.Println("Error: Persona name is required")
+			os.Exit(1)
+		}
+
+		persona := &pb.Persona{
+			Name:         fs.Arg(0),
+			Description:  *description,
+			SystemPrompt: *prompt,
+			Model:        *model,
+		}
+
+		if path, ok := strings.CutPrefix(*prompt, "@"); ok {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				fmt.Printf("Error reading prompt: %v\n", err)
+				os.Exit(1)
+			}
+			persona.SystemPrompt = string(content)
+		}
+
+		if *temperature >= 0 {
+			persona.Temperature = temperature
+		}
+
+		if *tools != "" {
+			persona.Tools = strings.Split(*tools, ",")
+		}
+
+		var out *pb.Persona
+		var err error
+		if args[0] == "create" {
+			var resp *pb.CreatePersonaResponse
+			resp, err = cli.CreatePersona(ctx, &pb.CreatePersonaRequest{Persona: persona})
+			out = resp.GetPersona()
+		} else {
+			var resp *pb.UpdatePersonaResponse
+			resp, err = cli.UpdatePersona(ctx, &pb.UpdatePersonaRequest{Persona: persona})
+			out = resp.GetPersona()
+		}
+
+		if err != nil {
+			fmt.Printf("Error saving persona: %v\n", err)
+			os.Exit(1)
+		}
+
+		printPersona(out)
+	case "delete":
+		if len(args) < 2 {
+			fmt.Println("Error: Persona name is required")
+			os.Exit(1)
+		}
+
+		if _, err := cli.DeletePersona(ctx, &pb.DeletePersonaRequest{Name: args[1]}); err != nil {
+			fmt.Printf("Error deleting persona: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Println("Deleted:", args[1])
+	default:
+		fmt.Printf("Error: Unknown personas command %q\n", args[0])
+		os.Exit(1)
+	}
+}
+
+func printPersona(p *pb.Persona) {
+	fmt.Println("Name:", p.GetName())
+	if p.GetDescription() != "" {
+		fmt.Println("Description:", p.GetDescription())
+	}
+	if p.GetModel() != "" {
+		fmt.Println("Model:", p.GetModel())
+	}
+	if p.Temperature != nil {
+		fmt.Println("Temperature:", p.GetTemperature())
+	}
+	if len(p.GetTools()) > 0 {
+		fmt.Println("Tools:", strings.Join(p.GetTools(), ", "))
+	}
+	fmt.Printf("\n%s\n", p.GetSystemPrompt())
+}
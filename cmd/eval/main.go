@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/acai-travel/tech-challenge/internal/chat/prompts"
+	"github.com/acai-travel/tech-challenge/internal/config"
+	"github.com/acai-travel/tech-challenge/internal/eval"
+)
+
+func main() {
+	fs := flag.NewFlagSet("acai-eval", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Println("Usage: acai-eval [flags] suite.yaml")
+		fmt.Println("Runs a suite of conversations against the assistant and checks its replies.")
+		fmt.Println("The OpenAI models and prompt templates are configured as for the server, from")
+		fmt.Println("CONFIG_FILE and the environment.")
+		fmt.Println()
+		fs.PrintDefaults()
+	}
+
+	llm := fs.String("llm", "fake", "Where LLM answers come from: fake (scripted in the suite), replay or record a cassette, or live")
+	cassette := fs.String("cassette", "", "Recorded LLM answers, the suite file with a .cassette.json extension by default")
+	judgeModel := fs.String("judge-model", "gpt-4.1-mini", "Model grading judge assertions, outside of fake mode")
+	out := fs.String("out", "", "Write the JSON report to this file")
+	junit := fs.String("junit", "", "Write a JUnit XML report to this file")
+	baseline := fs.String("baseline", "", "JSON report of an earlier run to find regressions against")
+	verbose := fs.Bool("v", false, "Log what the assistant does")
+	_ = fs.Parse(os.Args[1:])
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	level := slog.LevelWarn
+	if *verbose {
+		level = slog.LevelInfo
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+
+	mode, err := eval.ParseMode(*llm)
+	if err != nil {
+		fail(err)
+	}
+
+	cfg, err := config.Load("acai-eval", nil)
+	if err != nil {
+		fail(err)
+	}
+
+	if (mode == eval.ModeRecord || mode == eval.ModeLive) && cfg.OpenAI.APIKey == "" {
+		fail(fmt.Errorf("%s mode calls OpenAI and needs OPENAI_API_KEY", mode))
+	}
+
+	suite, err := eval.Load(fs.Arg(0))
+	if err != nil {
+		fail(err)
+	}
+
+	if *cassette == "" {
+		*cassette = strings.TrimSuffix(fs.Arg(0), ".yaml") + ".cassette.json"
+	}
+
+	recorded := &eval.Cassette{}
+	if mode == eval.ModeReplay || mode == eval.ModeRecord {
+		if recorded, err = eval.LoadCassette(*cassette); err != nil {
+			fail(err)
+		}
+	}
+
+	templates, err := prompts.New(cfg.Prompts)
+	if err != nil {
+		fail(err)
+	}
+
+	backend, err := eval.NewBackend(mode, recorded, cfg.OpenAI.BaseURL, cfg.OpenAI.APIKey)
+	if err != nil {
+		fail(err)
+	}
+	defer backend.Close()
+
+	runner := &eval.Runner{OpenAI: cfg.OpenAI, Backend: backend, Templates: templates}
+	if mode != eval.ModeFake {
+		runner.Judge = eval.NewJudge(backend.URL(), "eval", *judgeModel)
+	}
+
+	report, err := runner.Run(context.Background(), suite)
+	if err != nil {
+		fail(err)
+	}
+
+	if mode == eval.ModeRecord {
+		if err := recorded.Save(*cassette); err != nil {
+			fail(err)
+		}
+	}
+
+	if *baseline != "" {
+		base, err := eval.LoadReport(*baseline)
+		if err != nil {
+			fail(err)
+		}
+		report.Compare(base)
+	}
+
+	report.WriteSummary(os.Stdout)
+
+	if *out != "" {
+		if err := writeFile(*out, report.WriteJSON); err != nil {
+			fail(err)
+		}
+	}
+
+	if *junit != "" {
+		if err := writeFile(*junit, report.WriteJUnit); err != nil {
+			fail(err)
+		}
+	}
+
+	// Against a baseline only regressions fail the run, so that known failures
+	// do not block changes that do not make them worse.
+	if len(report.Regressions) > 0 || *baseline == "" && report.Passed+report.Skipped < report.Total {
+		os.Exit(1)
+	}
+}
+
+func writeFile(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func fail(err error) {
+	fmt.Printf("Error: %v\n", err)
+	os.Exit(2)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/acai-travel/tech-challenge/internal/chat/model"
+	"github.com/acai-travel/tech-challenge/internal/config"
+	"github.com/acai-travel/tech-challenge/internal/encryption"
+	"github.com/acai-travel/tech-challenge/internal/mongox"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Printf("Usage: acai-migrate [command] [-config file] [flags]\n")
+		fmt.Println("Commands:")
+		fmt.Println("  messages   Move messages embedded in conversations into the messages collection")
+		fmt.Println("             and copy the owner of conversations onto their messages")
+		fmt.Println("  encrypt    Encrypt titles, messages and memories with the primary key of encryption.keys,")
+		fmt.Println("             after enabling encryption or adding a new key")
+	}
+
+	if len(os.Args) < 2 {
+		fmt.Println("Error: No command provided")
+		fmt.Println("")
+		flag.Usage()
+		os.Exit(-1)
+	}
+
+	cfg, err := config.Load("acai-migrate "+os.Args[1], os.Args[2:])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	repo := model.New(mongox.MustConnect(cfg.Mongo))
+
+	// Validated with the configuration.
+	keys, _ := encryption.ParseKeySet(cfg.Encryption.Keys)
+	repo.EncryptWith(keys)
+
+	switch os.Args[1] {
+	case "messages":
+		if err := repo.SetupMessageIndex(ctx); err != nil {
+			fmt.Printf("Error creating message index: %v\n", err)
+			os.Exit(1)
+		}
+
+		n, err := repo.MigrateEmbeddedMessages(ctx)
+		if err != nil {
+			fmt.Printf("Error migrating messages after %d conversations: %v\n", n, err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Migrated messages of %d conversations.\n", n)
+
+		owned, err := repo.MigrateMessageOwners(ctx)
+		if err != nil {
+			fmt.Printf("Error copying owners after %d messages: %v\n", owned, err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Copied the owner of %d messages.\n", owned)
+	case "encrypt":
+		if keys == nil {
+			fmt.Println("Error: encryption.keys is not set")
+			os.Exit(1)
+		}
+
+		stats, err := repo.Reencrypt(ctx)
+		if err != nil {
+			fmt.Printf("Error encrypting after %d conversations, %d messages and %d memories: %v\n", stats.Conversations, stats.Messages, stats.Memories, err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Encrypted %d conversations, %d messages and %d memories with key %s.\n", stats.Conversations, stats.Messages, stats.Memories, keys.Primary())
+	default:
+		fmt.Printf("Error: Unknown command %q\n", os.Args[1])
+		fmt.Println("")
+		flag.Usage()
+		os.Exit(-1)
+	}
+}
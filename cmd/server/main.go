@@ -2,79 +2,313 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/acai-travel/tech-challenge/internal/airport"
+	"github.com/acai-travel/tech-challenge/internal/auth"
 	"github.com/acai-travel/tech-challenge/internal/chat"
 	"github.com/acai-travel/tech-challenge/internal/chat/assistant"
+	"github.com/acai-travel/tech-challenge/internal/chat/guard"
 	"github.com/acai-travel/tech-challenge/internal/chat/model"
+	"github.com/acai-travel/tech-challenge/internal/chat/prompts"
+	"github.com/acai-travel/tech-challenge/internal/chat/tools/holidays"
+	"github.com/acai-travel/tech-challenge/internal/config"
+	"github.com/acai-travel/tech-challenge/internal/encryption"
 	"github.com/acai-travel/tech-challenge/internal/health"
 	"github.com/acai-travel/tech-challenge/internal/httpx"
+	"github.com/acai-travel/tech-challenge/internal/logx"
 	_ "github.com/acai-travel/tech-challenge/internal/metrics"
 	"github.com/acai-travel/tech-challenge/internal/mongox"
 	"github.com/acai-travel/tech-challenge/internal/pb"
+	"github.com/acai-travel/tech-challenge/internal/ratelimit"
 	"github.com/acai-travel/tech-challenge/internal/telemetry"
+	"github.com/acai-travel/tech-challenge/internal/weather"
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/twitchtv/twirp"
+	"go.opentelemetry.io/contrib/bridges/otelslog"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 func main() {
-	ctx := context.Background()
+	// The context is cancelled on SIGINT or SIGTERM, starting the shutdown.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	if os.Getenv("WEATHER_API_KEY") == "" {
-		slog.Warn("WEATHER_API_KEY is not set. Weather tools will fail.")
+	cfg, err := config.Load("acai-server", os.Args[1:])
+	if err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(2)
 	}
 
-	shutdown, err := telemetry.Init(ctx, "acai-chat-service")
+	shutdownTelemetry, err := telemetry.Init(ctx, cfg.Telemetry)
 	if err != nil {
 		slog.Error("Failed to init telemetry", "error", err)
 		os.Exit(1)
 	}
-	defer func() {
-		if err := shutdown(ctx); err != nil {
-			slog.Error("Failed to shutdown telemetry", "error", err)
-		}
-	}()
 
-	mongo := mongox.MustConnect()
+	var logHandlers []slog.Handler
+	if cfg.Telemetry.LogsEnabled {
+		logHandlers = append(logHandlers, otelslog.NewHandler(cfg.Telemetry.ServiceName))
+	}
+
+	logger, err := logx.New(os.Stderr, cfg.Log, logHandlers...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+
+	if cfg.OpenAI.APIKey == "" {
+		slog.Warn("OPENAI_API_KEY is not set. Replies will fail.")
+	}
+
+	if cfg.Tools.Weather.Enabled && cfg.Tools.Weather.APIKey == "" {
+		slog.Warn("WEATHER_API_KEY is not set. Weather tools will fail.")
+	}
+
+	mongo := mongox.MustConnect(cfg.Mongo)
 
 	repo := model.New(mongo)
 
-	// Setup TTL for conversations
-	if err := repo.SetupTTLIndex(ctx); err != nil {
-		slog.Warn("Failed to setup TTL index", "error", err)
+	// Validated with the configuration.
+	keys, _ := encryption.ParseKeySet(cfg.Encryption.Keys)
+	repo.EncryptWith(keys)
+	if keys != nil {
+		slog.Info("Conversation content is encrypted at rest", "key", keys.Primary())
+	}
+
+	policy := model.RetentionPolicy{
+		Default:       cfg.Retention.Default,
+		Mode:          model.RetentionMode(cfg.Retention.Mode),
+		SweepInterval: cfg.Retention.SweepInterval,
+	}
+
+	if err := repo.SetupRetention(ctx, policy); err != nil {
+		slog.Warn("Failed to setup retention", "error", err)
 	} else {
-		slog.Info("TTL index configured: conversations will be deleted after 1 hour of inactivity (previous 5 but changed to show old conversations in UI :)")
+		slog.Info("Retention configured", "retention", policy.Default, "mode", policy.Mode)
 	}
 
-	assist := assistant.New()
+	go repo.RunSweeper(ctx)
+
+	if err := repo.SetupMessageIndex(ctx); err != nil {
+		slog.Warn("Failed to setup message index", "error", err)
+	}
+
+	if err := repo.SetupSearchIndexes(ctx); err != nil {
+		slog.Warn("Failed to setup search indexes", "error", err)
+	}
+
+	if err := repo.SetupLineageIndex(ctx); err != nil {
+		slog.Warn("Failed to setup lineage index", "error", err)
+	}
+
+	if err := repo.SetupAuditIndexes(ctx); err != nil {
+		slog.Warn("Failed to setup audit indexes", "error", err)
+	}
+
+	if err := repo.SetupMemoryIndex(ctx); err != nil {
+		slog.Warn("Failed to setup memory index", "error", err)
+	}
+
+	templates, err := prompts.New(cfg.Prompts)
+	if err != nil {
+		slog.Error("Failed to load prompt templates", "error", err)
+		os.Exit(1)
+	}
+
+	guards, err := guard.New(cfg.Guardrails, cfg.OpenAI)
+	if err != nil {
+		slog.Error("Failed to load guardrails", "error", err)
+		os.Exit(1)
+	}
+
+	authn, err := authenticator(cfg.Auth)
+	if err != nil {
+		slog.Error("Invalid authentication configuration", "error", err)
+		os.Exit(1)
+	}
+
+	assist := assistant.New(cfg.OpenAI, cfg.Tools, repo, templates, guards)
+
+	// Without authentication every caller would share the same memories.
+	if cfg.Tools.Memory.Enabled && authn != nil {
+		assist.RememberWith(repo)
+	} else if cfg.Tools.Memory.Enabled {
+		slog.Warn("tools.memory.enabled requires authentication, memory is disabled.")
+	}
 
 	server := chat.NewServer(repo, assist)
 
 	// Configure handler
 	handler := mux.NewRouter()
+	// Tracing comes first so that the request span and ID are in the context of
+	// every log record, including the request log.
 	handler.Use(
+		otelhttp.NewMiddleware("server"),
+		httpx.RequestID(),
 		httpx.Logger(),
 		httpx.Recovery(),
-		otelhttp.NewMiddleware("server"),
+		httpx.AcceptLanguage(),
+	)
+
+	var rpc http.Handler = pb.NewChatServiceServer(server,
+		twirp.WithServerJSONSkipDefaults(true),
+		twirp.WithServerHooks(httpx.ServerHooks()),
 	)
 
-	handler.PathPrefix("/twirp/").Handler(pb.NewChatServiceServer(server, twirp.WithServerJSONSkipDefaults(true)))
+	limits := ratelimit.Limit{
+		RequestsPerMinute: cfg.RateLimit.RequestsPerMinute,
+		Burst:             cfg.RateLimit.Burst,
+		DailyTokens:       cfg.RateLimit.DailyTokens,
+	}
+
+	var keyLimits map[string]ratelimit.Limit
+	if authn != nil && authn.Keys != nil {
+		keyLimits = authn.Keys.Limits()
+	}
+
+	// Rate limiting runs after authentication to key callers by API key or user.
+	rpc = httpx.RateLimit(ratelimit.New(limits, keyLimits), cfg.RateLimit.TrustProxy)(rpc)
+
+	if authn != nil {
+		rpc = httpx.Auth(authn)(rpc)
+	} else {
+		slog.Warn("auth.keys_file and auth.jwks_file are not set. Authentication is disabled and every conversation is visible to everyone.")
+	}
+
+	// Requests are also throttled per client IP before authentication, so that
+	// guessing credentials is limited.
+	rpc = httpx.LimitIP(ratelimit.New(ratelimit.Limit{
+		RequestsPerMinute: cfg.RateLimit.IPRequestsPerMinute,
+		Burst:             cfg.RateLimit.IPBurst,
+	}, nil), cfg.RateLimit.TrustProxy)(rpc)
 
-	handler.Handle("/health", health.NewHandler(mongo))
+	// The audit log records the client IP of every RPC.
+	rpc = httpx.StoreClientIP(cfg.RateLimit.TrustProxy)(rpc)
+
+	handler.PathPrefix("/twirp/").Handler(rpc)
+
+	monitor := health.NewMonitor(cfg.Health.CheckInterval, cfg.Health.CheckTimeout)
+	monitor.Register(health.MongoChecker(mongo), true)
+	monitor.Register(health.CheckerFunc("openai", assist.Check), false)
+	if cfg.Tools.Weather.Enabled {
+		monitor.Register(health.CheckerFunc("weather_api", weather.NewClient(cfg.Tools.Weather.APIKey).Check), false)
+	}
+	if cfg.Tools.Airport.Enabled {
+		monitor.Register(health.CheckerFunc("airport_api", airport.Check), false)
+	}
+	if cfg.Tools.Holidays.Enabled {
+		monitor.Register(health.CheckerFunc("holiday_calendar", func(ctx context.Context) error {
+			return holidays.CheckCalendar(ctx, cfg.Tools.Holidays.CalendarURL)
+		}), false)
+	}
+
+	go monitor.Run(ctx)
+
+	healthHandler := health.NewHandler(monitor)
+	handler.Handle("/health", healthHandler)
+	handler.Handle("/readyz", healthHandler)
+	handler.HandleFunc("/livez", healthHandler.Live)
 
 	// This is for prometheus
 	handler.Handle("/metrics", promhttp.Handler())
 
-	fs := http.FileServer(http.Dir("cmd/server/static"))
+	fs := http.FileServer(http.Dir(cfg.Server.StaticDir))
 	handler.PathPrefix("/").Handler(fs)
 
+	srv := &http.Server{
+		Addr:              cfg.Server.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+
 	// Start the server
-	slog.Info("Starting the server...")
-	if err := http.ListenAndServe(":8080", handler); err != nil {
-		panic(err)
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("Starting the server...", "addr", cfg.Server.Addr)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	exitCode := 0
+
+	select {
+	case err := <-serveErr:
+		slog.Error("Server failed", "error", err)
+		exitCode = 1
+	case <-ctx.Done():
+		// A second signal kills the process right away.
+		stop()
+
+		slog.Info("Shutting down the server...", "drain_timeout", cfg.Server.ShutdownTimeout)
+		healthHandler.Drain()
+		time.Sleep(cfg.Server.ShutdownDelay)
+
+		// Shutdown stops accepting connections and waits for in-flight replies,
+		// which run on their own request context and are not cancelled.
+		drainCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		if err := srv.Shutdown(drainCtx); err != nil {
+			slog.Warn("In-flight requests did not complete in time", "error", err)
+			_ = srv.Close()
+			exitCode = 1
+		}
+		cancel()
+	}
+
+	cleanupCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+
+	if err := shutdownTelemetry(cleanupCtx); err != nil {
+		slog.Error("Failed to shutdown telemetry", "error", err)
+	}
+
+	if err := mongo.Client().Disconnect(cleanupCtx); err != nil {
+		slog.Error("Failed to disconnect from MongoDB", "error", err)
+	}
+
+	cancel()
+
+	slog.Info("Server stopped")
+	os.Exit(exitCode)
+}
+
+// authenticator loads the API keys and JWT signing keys files. It returns nil
+// when neither file is set.
+func authenticator(cfg config.Auth) (*auth.Authenticator, error) {
+	authn := &auth.Authenticator{}
+
+	if cfg.KeysFile != "" {
+		keys, err := auth.LoadKeyFile(cfg.KeysFile)
+		if err != nil {
+			return nil, err
+		}
+		authn.Keys = keys
 	}
+
+	if cfg.JWKSFile != "" {
+		verifier, err := auth.LoadJWKSFile(cfg.JWKSFile, cfg.JWTIssuer, cfg.JWTAudience)
+		if err != nil {
+			return nil, err
+		}
+		authn.JWT = verifier
+	}
+
+	if authn.Keys == nil && authn.JWT == nil {
+		return nil, nil
+	}
+
+	return authn, nil
 }
@@ -3,13 +3,21 @@ package airport
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+
+	"github.com/acai-travel/tech-challenge/internal/errs"
 )
 
-const baseURL = "https://airport-web.appspot.com/_ah/api/airportsapi/v1/airports"
+const (
+	baseURL = "https://airport-web.appspot.com/_ah/api/airportsapi/v1/airports"
+
+	// upstream names the airports API in errors.
+	upstream = "airport_api"
+)
 
 type AirportInfo struct {
 	ICAO       string `json:"ICAO"`
@@ -30,11 +38,17 @@ type ErrorResponse struct {
 	} `json:"error"`
 }
 
+// Check looks up Frankfurt airport, which is always known to the API.
+func Check(ctx context.Context) error {
+	_, err := GetAirportInfo(ctx, "EDDF")
+	return err
+}
+
 func GetAirportInfo(ctx context.Context, icaoCode string) (*AirportInfo, error) {
 	// Validate ICAO code (should be 4 characters, uppercase letters)
 	icaoCode = strings.ToUpper(strings.TrimSpace(icaoCode))
 	if len(icaoCode) != 4 {
-		return nil, fmt.Errorf("invalid ICAO code: must be 4 characters")
+		return nil, errs.InvalidInput("icao_code", "invalid ICAO code: must be 4 characters")
 	}
 
 	url := fmt.Sprintf("%s/%s", baseURL, icaoCode)
@@ -48,30 +62,30 @@ func GetAirportInfo(ctx context.Context, icaoCode string) (*AirportInfo, error)
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
+		return nil, errs.Unavailable(upstream, "request failed", err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, errs.Unavailable(upstream, "failed to read response body", err)
 	}
 
 	if resp.StatusCode == http.StatusNotFound {
 		var errResp ErrorResponse
 		if err := json.Unmarshal(body, &errResp); err != nil {
-			return nil, fmt.Errorf("airport not found: %s", icaoCode)
+			return nil, errs.NotFound(upstream, "airport not found: "+icaoCode)
 		}
-		return nil, fmt.Errorf("airport not found: %s", errResp.Error.Message)
+		return nil, errs.NotFound(upstream, "airport not found: "+errResp.Error.Message)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+		return nil, errs.Unavailable(upstream, fmt.Sprintf("API error (status %d)", resp.StatusCode), errors.New(string(body)))
 	}
 
 	var airportInfo AirportInfo
 	if err := json.Unmarshal(body, &airportInfo); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+		return nil, errs.Unavailable(upstream, "invalid response", err)
 	}
 
 	return &airportInfo, nil
@@ -0,0 +1,79 @@
+// Package auth identifies the caller of a request, either by API key or by a
+// bearer JWT, and carries the resulting principal through the context.
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+var (
+	ErrMissingCredentials = errors.New("missing credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Principal is the authenticated caller.
+type Principal struct {
+	// UserID owns the conversations created by the caller.
+	UserID string
+	// KeyID identifies the API key used, empty for JWTs.
+	KeyID string
+	// Admin callers may read the audit log.
+	Admin bool
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal of the request, if it was authenticated.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// UserID returns the ID of the authenticated user, or an empty string when
+// authentication is disabled.
+func UserID(ctx context.Context) string {
+	if p, ok := FromContext(ctx); ok {
+		return p.UserID
+	}
+	return ""
+}
+
+// IsAdmin reports whether the caller is an admin. When authentication is
+// disabled every caller is, as every conversation is visible to everyone.
+func IsAdmin(ctx context.Context) bool {
+	if p, ok := FromContext(ctx); ok {
+		return p.Admin
+	}
+	return true
+}
+
+// Authenticator resolves credentials to a principal. API keys are looked up in
+// the key store and bearer tokens shaped like a JWT are verified against the
+// JWKS; either may be nil to disable that kind of credential.
+type Authenticator struct {
+	Keys *KeyStore
+	JWT  *JWTVerifier
+}
+
+// Authenticate resolves an API key or bearer token.
+func (a *Authenticator) Authenticate(ctx context.Context, credential string) (*Principal, error) {
+	if credential == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	if a.JWT != nil && strings.Count(credential, ".") == 2 {
+		return a.JWT.Verify(ctx, credential)
+	}
+
+	if a.Keys != nil {
+		return a.Keys.Lookup(credential)
+	}
+
+	return nil, ErrInvalidCredentials
+}
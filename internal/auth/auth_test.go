@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestKeyStore_Lookup(t *testing.T) {
+	digest := sha256.Sum256([]byte("ci-secret"))
+
+	store, err := NewKeyStore([]KeyEntry{
+		{ID: "dev", UserID: "alice", Key: "dev-secret"},
+		{ID: "ci", UserID: "ci-bot", KeySHA256: hex.EncodeToString(digest[:])},
+		{ID: "compliance", UserID: "carol", Key: "admin-secret", Admin: true},
+	})
+	if err != nil {
+		t.Fatalf("NewKeyStore() error = %v", err)
+	}
+
+	tests := []struct {
+		key       string
+		wantUser  string
+		wantAdmin bool
+		wantErr   error
+	}{
+		{"dev-secret", "alice", false, nil},
+		{"ci-secret", "ci-bot", false, nil},
+		{"admin-secret", "carol", true, nil},
+		{"wrong", "", false, ErrInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			p, err := store.Lookup(tt.key)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Lookup() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if err == nil && p.UserID != tt.wantUser {
+				t.Errorf("Lookup() user = %s, want %s", p.UserID, tt.wantUser)
+			}
+
+			if err == nil && p.Admin != tt.wantAdmin {
+				t.Errorf("Lookup() admin = %v, want %v", p.Admin, tt.wantAdmin)
+			}
+		})
+	}
+}
+
+func TestNewKeyStore_Invalid(t *testing.T) {
+	tests := map[string][]KeyEntry{
+		"missing user":   {{ID: "a", Key: "x"}},
+		"missing key":    {{ID: "a", UserID: "u"}},
+		"both keys":      {{ID: "a", UserID: "u", Key: "x", KeySHA256: "00"}},
+		"invalid digest": {{ID: "a", UserID: "u", KeySHA256: "not-hex"}},
+		"duplicate id":   {{ID: "a", UserID: "u", Key: "x"}, {ID: "a", UserID: "v", Key: "y"}},
+	}
+
+	for name, keys := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewKeyStore(keys); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestJWTVerifier_Verify(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	jwks := fmt.Sprintf(`{"keys": [
+		{"kty": "RSA", "kid": "rsa-1", "n": %q, "e": %q},
+		{"kty": "oct", "kid": "hmac-1", "k": %q}
+	]}`,
+		base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		base64.RawURLEncoding.EncodeToString([]byte("shared-secret")))
+
+	verifier, err := NewJWTVerifier([]byte(jwks), "https://issuer.example.com", "acai-chat")
+	if err != nil {
+		t.Fatalf("NewJWTVerifier() error = %v", err)
+	}
+
+	claims := func(mods ...func(*jwt.RegisteredClaims)) jwt.RegisteredClaims {
+		c := jwt.RegisteredClaims{
+			Subject:   "alice",
+			Issuer:    "https://issuer.example.com",
+			Audience:  jwt.ClaimStrings{"acai-chat"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		}
+		for _, mod := range mods {
+			mod(&c)
+		}
+		return c
+	}
+
+	sign := func(method jwt.SigningMethod, kid string, signingKey any, c jwt.RegisteredClaims) string {
+		token := jwt.NewWithClaims(method, c)
+		token.Header["kid"] = kid
+		s, err := token.SignedString(signingKey)
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"valid RSA token", sign(jwt.SigningMethodRS256, "rsa-1", key, claims()), false},
+		{"valid HMAC token", sign(jwt.SigningMethodHS256, "hmac-1", []byte("shared-secret"), claims()), false},
+		{"expired", sign(jwt.SigningMethodRS256, "rsa-1", key, claims(func(c *jwt.RegisteredClaims) {
+			c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+		})), true},
+		{"missing expiry", sign(jwt.SigningMethodRS256, "rsa-1", key, claims(func(c *jwt.RegisteredClaims) {
+			c.ExpiresAt = nil
+		})), true},
+		{"wrong issuer", sign(jwt.SigningMethodRS256, "rsa-1", key, claims(func(c *jwt.RegisteredClaims) {
+			c.Issuer = "https://evil.example.com"
+		})), true},
+		{"wrong audience", sign(jwt.SigningMethodRS256, "rsa-1", key, claims(func(c *jwt.RegisteredClaims) {
+			c.Audience = jwt.ClaimStrings{"other"}
+		})), true},
+		{"missing subject", sign(jwt.SigningMethodRS256, "rsa-1", key, claims(func(c *jwt.RegisteredClaims) {
+			c.Subject = ""
+		})), true},
+		{"unknown key", sign(jwt.SigningMethodRS256, "rsa-2", key, claims()), true},
+		{"HMAC signed with RSA key ID", sign(jwt.SigningMethodHS256, "rsa-1", []byte("shared-secret"), claims()), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := verifier.Verify(context.Background(), tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil && !errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("expected ErrInvalidCredentials, got %v", err)
+			}
+
+			if err == nil && p.UserID != "alice" {
+				t.Errorf("Verify() user = %s, want alice", p.UserID)
+			}
+
+			if err == nil && p.Admin {
+				t.Error("Verify() admin = true, want false")
+			}
+		})
+	}
+
+	t.Run("admin role", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, tokenClaims{RegisteredClaims: claims(), Roles: []string{"support", "admin"}})
+		token.Header["kid"] = "rsa-1"
+		s, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+
+		p, err := verifier.Verify(context.Background(), s)
+		if err != nil {
+			t.Fatalf("Verify() error = %v", err)
+		}
+
+		if !p.Admin {
+			t.Error("Verify() admin = false, want true")
+		}
+	})
+}
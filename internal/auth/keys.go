@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/acai-travel/tech-challenge/internal/ratelimit"
+)
+
+// KeyFile is the format of the local API key file:
+//
+//	{
+//	  "keys": [
+//	    {"id": "ci", "user_id": "ci-bot", "key_sha256": "9f86d08..."},
+//	    {"id": "compliance", "user_id": "carol", "key_sha256": "60303ae...", "admin": true},
+//	    {"id": "dev", "user_id": "alice", "key": "dev-secret",
+//	     "limits": {"requests_per_minute": 120, "daily_tokens": 500000}}
+//	  ]
+//	}
+//
+// Keys should be stored as the hex SHA-256 of the key, plain keys are only
+// meant for local development. Keys with limits replace the default rate
+// limits for requests made with them. Admin keys may read the audit log.
+type KeyFile struct {
+	Keys []KeyEntry `json:"keys"`
+}
+
+type KeyEntry struct {
+	ID        string `json:"id"`
+	UserID    string `json:"user_id"`
+	Key       string `json:"key,omitempty"`
+	KeySHA256 string `json:"key_sha256,omitempty"`
+	Admin     bool   `json:"admin,omitempty"`
+
+	Limits *ratelimit.Limit `json:"limits,omitempty"`
+}
+
+// KeyStore validates API keys against a key file.
+type KeyStore struct {
+	entries []keyEntry
+}
+
+type keyEntry struct {
+	KeyEntry
+	hash [sha256.Size]byte
+}
+
+// LoadKeyFile reads and validates a key file.
+func LoadKeyFile(path string) (*KeyStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	var file KeyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse key file: %w", err)
+	}
+
+	return NewKeyStore(file.Keys)
+}
+
+func NewKeyStore(keys []KeyEntry) (*KeyStore, error) {
+	store := &KeyStore{}
+	ids := make(map[string]bool)
+
+	for i, k := range keys {
+		if k.ID == "" || k.UserID == "" {
+			return nil, fmt.Errorf("key %d: id and user_id are required", i)
+		}
+
+		if ids[k.ID] {
+			return nil, fmt.Errorf("key %s: duplicate id", k.ID)
+		}
+		ids[k.ID] = true
+
+		entry := keyEntry{KeyEntry: k}
+
+		switch {
+		case k.KeySHA256 != "" && k.Key != "":
+			return nil, fmt.Errorf("key %s: set either key or key_sha256", k.ID)
+		case k.KeySHA256 != "":
+			raw, err := hex.DecodeString(k.KeySHA256)
+			if err != nil || len(raw) != sha256.Size {
+				return nil, fmt.Errorf("key %s: key_sha256 must be a hex SHA-256 digest", k.ID)
+			}
+			copy(entry.hash[:], raw)
+		case k.Key != "":
+			entry.hash = sha256.Sum256([]byte(k.Key))
+		default:
+			return nil, fmt.Errorf("key %s: key or key_sha256 is required", k.ID)
+		}
+
+		store.entries = append(store.entries, entry)
+	}
+
+	return store, nil
+}
+
+// Lookup returns the principal owning the API key.
+func (s *KeyStore) Lookup(key string) (*Principal, error) {
+	hash := sha256.Sum256([]byte(key))
+
+	for _, e := range s.entries {
+		if subtle.ConstantTimeCompare(hash[:], e.hash[:]) == 1 {
+			return &Principal{UserID: e.UserID, KeyID: e.ID, Admin: e.Admin}, nil
+		}
+	}
+
+	return nil, ErrInvalidCredentials
+}
+
+// Limits returns the rate limits of the keys that override the defaults, by key ID.
+func (s *KeyStore) Limits() map[string]ratelimit.Limit {
+	limits := make(map[string]ratelimit.Limit)
+	for _, e := range s.entries {
+		if e.Limits != nil {
+			limits[e.ID] = *e.Limits
+		}
+	}
+	return limits
+}
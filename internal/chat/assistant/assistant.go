@@ -3,47 +3,165 @@ package assistant
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/acai-travel/tech-challenge/internal/auth"
+	"github.com/acai-travel/tech-challenge/internal/chat/guard"
 	"github.com/acai-travel/tech-challenge/internal/chat/model"
+	"github.com/acai-travel/tech-challenge/internal/chat/prompts"
 	"github.com/acai-travel/tech-challenge/internal/chat/tools"
 	"github.com/acai-travel/tech-challenge/internal/chat/tools/airport"
 	"github.com/acai-travel/tech-challenge/internal/chat/tools/date"
 	"github.com/acai-travel/tech-challenge/internal/chat/tools/holidays"
+	"github.com/acai-travel/tech-challenge/internal/chat/tools/memory"
 	timetools "github.com/acai-travel/tech-challenge/internal/chat/tools/time"
 	"github.com/acai-travel/tech-challenge/internal/chat/tools/weather"
+	"github.com/acai-travel/tech-challenge/internal/config"
+	"github.com/acai-travel/tech-challenge/internal/errs"
+	"github.com/acai-travel/tech-challenge/internal/httpx"
+	"github.com/acai-travel/tech-challenge/internal/metrics"
+	"github.com/acai-travel/tech-challenge/internal/ratelimit"
+	weatherapi "github.com/acai-travel/tech-challenge/internal/weather"
 	"github.com/openai/openai-go/v2"
+	"github.com/openai/openai-go/v2/option"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
 	"go.opentelemetry.io/otel/trace"
 )
 
+// upstream names OpenAI in errors.
+const upstream = "openai"
+
+// blockedReply replaces replies the output guardrails block.
+const blockedReply = "I'm sorry, but I can't help with that."
+
+// promptMemories is the number of memories added to the system prompt.
+const promptMemories = 10
+
+// DefaultPersona answers conversations started without a persona, or whose
+// persona was deleted. Its system prompt is the reply template.
+var DefaultPersona = model.Persona{
+	Name: "default",
+}
+
+// PersonaStore looks personas up by name.
+type PersonaStore interface {
+	GetPersona(ctx context.Context, name string) (*model.Persona, error)
+}
+
 type Assistant struct {
-	cli      openai.Client
-	registry *tools.Registry
-	tracer   trace.Tracer
+	cli           openai.Client
+	registry      *tools.Registry
+	personas      PersonaStore
+	prompts       *prompts.Registry
+	guard         *guard.Pipeline
+	memories      memory.Store
+	tracer        trace.Tracer
+	replyModel    openai.ChatModel
+	personaModels []string
+	titleModel    openai.ChatModel
+	maxIterations int
+	metrics       instruments
 }
 
-func New() *Assistant {
+// New creates an assistant calling OpenAI as configured, with the enabled tools.
+// Conversations started with a persona are answered as configured in personas,
+// which may be nil to always use DefaultPersona. System prompts are rendered
+// from templates, the built in ones when nil. Messages, tool results and
+// replies are screened by guards, none when nil.
+func New(cfg config.OpenAI, toolsCfg config.Tools, personas PersonaStore, templates *prompts.Registry, guards *guard.Pipeline) *Assistant {
+	return NewWithTools(cfg, EnabledTools(toolsCfg), personas, templates, guards)
+}
+
+// EnabledTools registers the tools enabled in cfg.
+func EnabledTools(toolsCfg config.Tools) *tools.Registry {
 	registry := tools.NewRegistry()
-	registry.Register(&weather.WeatherTool{})
-	registry.Register(&weather.ForecastTool{})
-	registry.Register(&date.DateTool{})
-	registry.Register(&holidays.HolidaysTool{})
-	registry.Register(&timetools.TimeInZoneTool{})
-	registry.Register(&airport.AirportTool{})
+	if toolsCfg.Weather.Enabled {
+		client := weatherapi.NewClient(toolsCfg.Weather.APIKey)
+		registry.Register(&weather.WeatherTool{Client: client})
+		registry.Register(&weather.ForecastTool{Client: client})
+	}
+	if toolsCfg.Date.Enabled {
+		registry.Register(&date.DateTool{})
+	}
+	if toolsCfg.Holidays.Enabled {
+		registry.Register(&holidays.HolidaysTool{CalendarURL: toolsCfg.Holidays.CalendarURL})
+	}
+	if toolsCfg.Time.Enabled {
+		registry.Register(&timetools.TimeInZoneTool{})
+	}
+	if toolsCfg.Airport.Enabled {
+		registry.Register(&airport.AirportTool{})
+	}
+
+	return registry
+}
+
+// NewWithTools creates an assistant calling the given tools, e.g. stubs for
+// evaluations, see New.
+func NewWithTools(cfg config.OpenAI, registry *tools.Registry, personas PersonaStore, templates *prompts.Registry, guards *guard.Pipeline) *Assistant {
+	if templates == nil {
+		templates = prompts.Builtin()
+	}
+
+	var opts []option.RequestOption
+	if cfg.APIKey != "" {
+		opts = append(opts, option.WithAPIKey(cfg.APIKey))
+	}
+	if cfg.BaseURL != "" {
+		opts = append(opts, option.WithBaseURL(cfg.BaseURL))
+	}
 
 	return &Assistant{
-		cli:      openai.NewClient(),
-		registry: registry,
-		tracer:   otel.Tracer("assistant"),
+		cli:           openai.NewClient(opts...),
+		registry:      registry,
+		personas:      personas,
+		prompts:       templates,
+		guard:         guards,
+		tracer:        otel.Tracer("assistant"),
+		replyModel:    openai.ChatModel(cfg.ReplyModel),
+		personaModels: personaModels(cfg),
+		titleModel:    openai.ChatModel(cfg.TitleModel),
+		maxIterations: cfg.MaxIterations,
+		metrics:       newInstruments(),
 	}
 }
 
+// RememberWith lets the model remember facts about users across
+// conversations in store, with the remember, recall and forget tools, and adds
+// the memories most relevant to the last user message to the system prompt.
+func (a *Assistant) RememberWith(store memory.Store) {
+	a.memories = store
+	a.registry.Register(&memory.RememberTool{Store: store})
+	a.registry.Register(&memory.RecallTool{Store: store})
+	a.registry.Register(&memory.ForgetTool{Store: store})
+}
+
+// Check lists the OpenAI models, failing on an invalid or revoked API key.
+func (a *Assistant) Check(ctx context.Context) error {
+	_, err := a.cli.Models.List(ctx)
+	return err
+}
+
+// Screen runs the input guardrails on a user message, returning it redacted,
+// or a blocked error.
+func (a *Assistant) Screen(ctx context.Context, text string) (string, error) {
+	return a.guard.Run(ctx, guard.StageInput, text)
+}
+
 func (a *Assistant) Title(ctx context.Context, conv *model.Conversation) (string, error) {
-	ctx, span := a.tracer.Start(ctx, "Assistant.Title")
+	ctx, span := a.tracer.Start(ctx, "Assistant.Title", trace.WithAttributes(
+		semconv.GenAIConversationID(conv.ID.Hex()),
+	))
 	defer span.End()
 
 	if len(conv.Messages) == 0 {
@@ -52,9 +170,14 @@ func (a *Assistant) Title(ctx context.Context, conv *model.Conversation) (string
 
 	slog.InfoContext(ctx, "Generating title for conversation", "conversation_id", conv.ID)
 
+	prompt, err := a.prompts.Render(prompts.Title, a.promptData(ctx))
+	if err != nil {
+		return "", err
+	}
+
 	// Build messages array with system instruction first
 	msgs := []openai.ChatCompletionMessageParamUnion{
-		openai.SystemMessage("You are a title generator. Create a concise, descriptive title that SUMMARIZES the topic of the user's question. Do NOT answer the question. The title should be 3-8 words maximum, no special characters or emojis. Examples: 'Weather in Barcelona', 'Today's Date', 'Upcoming Holidays'."),
+		openai.SystemMessage(prompt.Text),
 	}
 
 	for _, m := range conv.Messages {
@@ -63,18 +186,17 @@ func (a *Assistant) Title(ctx context.Context, conv *model.Conversation) (string
 		}
 	}
 
-	// We could also change the model to make it quicker (GPT-4o or GPT-3.5-turbo)
-	resp, err := a.cli.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
-		Model:    openai.ChatModelO1,
+	resp, err := a.complete(ctx, openai.ChatCompletionNewParams{
+		Model:    a.titleModel,
 		Messages: msgs,
-	})
+	}, semconv.GenAIConversationID(conv.ID.Hex()))
 
 	if err != nil {
 		return "", err
 	}
 
 	if len(resp.Choices) == 0 || strings.TrimSpace(resp.Choices[0].Message.Content) == "" {
-		return "", errors.New("empty response from OpenAI for title generation")
+		return "", errs.Unavailable(upstream, "empty response for title generation", nil)
 	}
 
 	title := resp.Choices[0].Message.Content
@@ -88,19 +210,32 @@ func (a *Assistant) Title(ctx context.Context, conv *model.Conversation) (string
 	return title, nil
 }
 
-func (a *Assistant) Reply(ctx context.Context, conv *model.Conversation) (string, error) {
-	ctx, span := a.tracer.Start(ctx, "Assistant.Reply")
+// Reply generates the next assistant message of the conversation, recording the
+// version of the system prompt it was generated with.
+func (a *Assistant) Reply(ctx context.Context, conv *model.Conversation) (*model.Message, error) {
+	ctx, span := a.tracer.Start(ctx, "Assistant.Reply", trace.WithAttributes(
+		semconv.GenAIConversationID(conv.ID.Hex()),
+	))
 	defer span.End()
 
 	if len(conv.Messages) == 0 {
-		return "", errors.New("conversation has no messages")
+		return nil, errors.New("conversation has no messages")
 	}
 
-	slog.InfoContext(ctx, "Generating reply for conversation", "conversation_id", conv.ID)
+	persona := a.persona(ctx, conv)
+	span.SetAttributes(semconv.GenAIAgentName(persona.Name))
+
+	prompt, err := a.systemPrompt(ctx, persona, a.recall(ctx, conv))
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(PromptVersionKey.String(prompt.Version))
+
+	slog.InfoContext(ctx, "Generating reply for conversation", "conversation_id", conv.ID, "persona", persona.Name, "prompt_version", prompt.Version)
 
 	// Build message history with system prompt
 	msgs := []openai.ChatCompletionMessageParamUnion{
-		openai.SystemMessage("You are a helpful, concise AI assistant specialized in Weather, Holidays, and German Airports (ICAO codes). You can answer general questions normally, but when doing so, briefly mention that your primary expertise lies in Weather, Holidays, and German Airports. Provide accurate, safe, and clear responses. IMPORTANT: When users ask about relative dates like 'tomorrow', 'next week', etc., ALWAYS call get_today_date first to get the current date, then calculate the target date from that result. Pay close attention to the year."),
+		openai.SystemMessage(prompt.Text),
 	}
 
 	for _, m := range conv.Messages {
@@ -112,21 +247,70 @@ func (a *Assistant) Reply(ctx context.Context, conv *model.Conversation) (string
 		}
 	}
 
-	toolDefs := a.registry.Definitions()
+	toolDefs := a.registry.Definitions(persona.Tools...)
 	iteration := 0
+	var called []string
+
+	// The reason the loop ended and the time spent in each phase are recorded
+	// once the reply is done, whichever way it ends.
+	reason := metrics.TerminationError
+	var llmTime, toolTime time.Duration
+	defer func() {
+		metrics.RecordReply(reason, iteration+1, llmTime, toolTime)
+	}()
 
 	for {
-		response, err := a.callGPT4(ctx, msgs, toolDefs)
+		// Each iteration is a paid call, so a caller running out of quota
+		// mid-loop is stopped before the next one.
+		if err := ratelimit.CheckQuota(ctx); err != nil {
+			reason = metrics.TerminationQuota
+			return nil, err
+		}
+
+		start := time.Now()
+		response, err := a.callGPT4(ctx, persona, msgs, toolDefs,
+			semconv.GenAIConversationID(conv.ID.Hex()),
+			IterationKey.Int(iteration),
+		)
+		llmTime += time.Since(start)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 
 		shouldContinue, finalAnswer := a.shouldContinue(ctx, response, iteration)
 		if !shouldContinue {
-			return finalAnswer, nil
+			reason = metrics.TerminationCompleted
+			if len(response.Choices[0].Message.ToolCalls) > 0 {
+				reason = metrics.TerminationMaxIterations
+			}
+			span.SetAttributes(IterationKey.Int(iteration))
+
+			if finalAnswer, err = a.guard.Run(ctx, guard.StageOutput, finalAnswer); err != nil {
+				finalAnswer = blockedReply
+			}
+
+			now := time.Now()
+			return &model.Message{
+				ID:            primitive.NewObjectID(),
+				Role:          model.RoleAssistant,
+				Content:       finalAnswer,
+				CreatedAt:     now,
+				UpdatedAt:     now,
+				PromptVersion: prompt.Version,
+				Model:         string(a.model(persona)),
+				Tools:         called,
+			}, nil
+		}
+
+		for _, call := range response.Choices[0].Message.ToolCalls {
+			if !slices.Contains(called, call.Function.Name) {
+				called = append(called, call.Function.Name)
+			}
 		}
 
-		msgs = a.executeTools(ctx, msgs, response)
+		start = time.Now()
+		msgs = a.executeTools(ctx, persona, msgs, response)
+		toolTime += time.Since(start)
 		iteration++
 	}
 }
@@ -137,8 +321,7 @@ func (a *Assistant) shouldContinue(ctx context.Context, response *openai.ChatCom
 		return false, response.Choices[0].Message.Content
 	}
 
-	const maxIterations = 15
-	if iteration >= maxIterations {
+	if iteration >= a.maxIterations {
 		slog.WarnContext(ctx, "Max iterations reached", "iteration", iteration)
 		return false, "I apologize, but I've reached the maximum number of processing steps. Please try rephrasing your question or breaking it into smaller parts."
 	}
@@ -147,68 +330,214 @@ func (a *Assistant) shouldContinue(ctx context.Context, response *openai.ChatCom
 	return true, ""
 }
 
-func (a *Assistant) callGPT4(ctx context.Context, msgs []openai.ChatCompletionMessageParamUnion, toolDefs []openai.ChatCompletionToolUnionParam) (*openai.ChatCompletion, error) {
-	resp, err := a.cli.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
-		Model:    openai.ChatModelGPT4_1,
+// persona returns the persona the conversation was started with, or
+// DefaultPersona.
+func (a *Assistant) persona(ctx context.Context, conv *model.Conversation) *model.Persona {
+	if conv.Persona == "" || a.personas == nil {
+		return &DefaultPersona
+	}
+
+	p, err := a.personas.GetPersona(ctx, conv.Persona)
+	if err != nil {
+		slog.WarnContext(ctx, "Persona not available, using the default one", "persona", conv.Persona, "error", err)
+		return &DefaultPersona
+	}
+
+	return p
+}
+
+// systemPrompt renders the system prompt of the persona with the memories of
+// the user, the reply template for personas without one. Persona prompts are
+// templates too, with the same data.
+func (a *Assistant) systemPrompt(ctx context.Context, persona *model.Persona, memories []string) (prompts.Prompt, error) {
+	data := a.promptData(ctx, persona.Tools...)
+	data.Memories = memories
+	if persona.SystemPrompt == "" {
+		return a.prompts.Render(prompts.Reply, data)
+	}
+
+	return a.prompts.RenderText("persona/"+persona.Name, persona.SystemPrompt, data)
+}
+
+// recall returns the memories of the user most relevant to the last message of
+// the conversation. Anonymous users have none, and replies go on without
+// memories when they can't be read.
+func (a *Assistant) recall(ctx context.Context, conv *model.Conversation) []string {
+	if a.memories == nil || auth.UserID(ctx) == "" {
+		return nil
+	}
+
+	memories, err := a.memories.RecallMemories(ctx, conv.Messages[len(conv.Messages)-1].Content, promptMemories)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to recall memories", "error", err)
+		return nil
+	}
+
+	var out []string
+	for _, m := range memories {
+		out = append(out, m.Content)
+	}
+	return out
+}
+
+// promptData are the template variables of a request, with the enabled tools
+// limited to the given ones, if any.
+func (a *Assistant) promptData(ctx context.Context, tools ...string) prompts.Data {
+	return prompts.Data{
+		Now:    time.Now().UTC(),
+		Locale: httpx.Locale(ctx),
+		Tools:  a.registry.Names(tools...),
+	}
+}
+
+// personaModels are the models personas may use, the reply model included.
+func personaModels(cfg config.OpenAI) []string {
+	models := []string{cfg.ReplyModel}
+	for _, m := range strings.Split(cfg.PersonaModels, ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			models = append(models, m)
+		}
+	}
+	return models
+}
+
+// CheckPersona returns an invalid input error when the persona uses a model
+// that is not allowed or a tool that is not registered.
+func (a *Assistant) CheckPersona(p *model.Persona) error {
+	if p.Model != "" && !slices.Contains(a.personaModels, p.Model) {
+		return errs.InvalidInput("persona.model", "must be one of "+strings.Join(a.personaModels, ", "))
+	}
+
+	for _, name := range p.Tools {
+		if _, ok := a.registry.Get(name); !ok {
+			return errs.InvalidInput("persona.tools", "unknown tool "+name+", must be one of "+strings.Join(a.registry.Names(), ", "))
+		}
+	}
+
+	return nil
+}
+
+// model is the model answering for the persona. Personas saved with a model
+// that is no longer allowed get the reply model.
+func (a *Assistant) model(persona *model.Persona) openai.ChatModel {
+	if persona.Model != "" && slices.Contains(a.personaModels, persona.Model) {
+		return openai.ChatModel(persona.Model)
+	}
+	return a.replyModel
+}
+
+func (a *Assistant) callGPT4(ctx context.Context, persona *model.Persona, msgs []openai.ChatCompletionMessageParamUnion, toolDefs []openai.ChatCompletionToolUnionParam, attrs ...attribute.KeyValue) (*openai.ChatCompletion, error) {
+	params := openai.ChatCompletionNewParams{
+		Model:    a.model(persona),
 		Messages: msgs,
 		Tools:    toolDefs,
-	})
+	}
+
+	if persona.Temperature != nil {
+		params.Temperature = openai.Float(*persona.Temperature)
+	}
+
+	resp, err := a.complete(ctx, params, attrs...)
 
 	if err != nil {
 		return nil, err
 	}
 
 	if len(resp.Choices) == 0 {
-		return nil, errors.New("no choices returned by OpenAI")
+		return nil, errs.Unavailable(upstream, "no choices returned", nil)
 	}
 
 	return resp, nil
 }
 
-func (a *Assistant) executeTools(ctx context.Context, msgs []openai.ChatCompletionMessageParamUnion, response *openai.ChatCompletion) []openai.ChatCompletionMessageParamUnion {
+func (a *Assistant) executeTools(ctx context.Context, persona *model.Persona, msgs []openai.ChatCompletionMessageParamUnion, response *openai.ChatCompletion) []openai.ChatCompletionMessageParamUnion {
 	message := response.Choices[0].Message
 
 	msgs = append(msgs, message.ToParam())
 
 	for _, call := range message.ToolCalls {
-		result := a.executeSingleTool(ctx, call)
+		result := a.executeSingleTool(ctx, persona, call)
 		msgs = append(msgs, openai.ToolMessage(result, call.ID))
 	}
 
 	return msgs
 }
 
-func (a *Assistant) executeSingleTool(ctx context.Context, call any) string {
-	type toolCall interface {
-		GetID() string
-		GetFunction() struct {
-			Name      string
-			Arguments string
-		}
-	}
-
-	tc, ok := call.(toolCall)
-	if !ok {
-		slog.WarnContext(ctx, "Unexpected tool call type")
-		return "Error: unexpected tool call type"
-	}
-
-	fn := tc.GetFunction()
+func (a *Assistant) executeSingleTool(ctx context.Context, persona *model.Persona, call openai.ChatCompletionMessageToolCallUnion) string {
+	fn := call.Function
 	slog.InfoContext(ctx, "Tool call received", "name", fn.Name, "args", fn.Arguments)
 
-	toolCtx, toolSpan := a.tracer.Start(ctx, "Tool.Execute", trace.WithAttributes(
-		attribute.String("tool.name", fn.Name),
+	toolCtx, toolSpan := a.tracer.Start(ctx, "execute_tool "+fn.Name, trace.WithAttributes(
+		semconv.GenAIOperationNameExecuteTool,
+		semconv.GenAIToolName(fn.Name),
+		semconv.GenAIToolCallID(call.ID),
+		semconv.GenAIToolType("function"),
 		attribute.String("tool.args", fn.Arguments),
 	))
 	defer toolSpan.End()
 
-	result, err := a.registry.Execute(toolCtx, fn.Name, fn.Arguments)
+	var result string
+	var err error
+	if len(persona.Tools) > 0 && !slices.Contains(persona.Tools, fn.Name) {
+		// The model was not offered the tool, but may still call it.
+		err = errs.NotFound("", "tool not found: "+fn.Name)
+	} else {
+		result, err = a.registry.Execute(toolCtx, fn.Name, fn.Arguments)
+	}
+
+	if err == nil {
+		// The model is told when a result was withheld, as for a failed call.
+		result, err = a.guard.Run(toolCtx, guard.StageTool, result)
+	}
+
 	if err != nil {
-		slog.ErrorContext(ctx, "Tool execution failed", "tool", fn.Name, "error", err)
+		kind := errs.KindOf(err)
+		if kind == "" {
+			kind = OutcomeError
+		}
+
+		slog.ErrorContext(ctx, "Tool execution failed", "tool", fn.Name, "kind", kind, "error", err)
 		toolSpan.RecordError(err)
 		toolSpan.SetStatus(codes.Error, err.Error())
-		return "Error executing tool: " + err.Error()
+		toolSpan.SetAttributes(semconv.ErrorTypeKey.String(string(kind)))
+		a.recordToolCall(ctx, fn.Name, string(kind))
+
+		// The model gets the kind of failure to decide whether to fix its
+		// arguments, try something else or apologize.
+		return fmt.Sprintf("Error executing tool (%s): %s", kind, err.Error())
 	}
 
+	a.recordToolCall(ctx, fn.Name, OutcomeOK)
 	return result
 }
+
+// llmError classifies a failed OpenAI call.
+func llmError(err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+
+	var apiErr *openai.Error
+	if !errors.As(err, &apiErr) {
+		return errs.Unavailable(upstream, "request failed", err)
+	}
+
+	switch {
+	case apiErr.StatusCode == http.StatusTooManyRequests && apiErr.Code != "insufficient_quota":
+		e := errs.RateLimited(upstream, "rate limited", 0)
+		if apiErr.Response != nil {
+			if seconds, err := strconv.Atoi(apiErr.Response.Header.Get("Retry-After")); err == nil {
+				e.RetryAfter = time.Duration(seconds) * time.Second
+			}
+		}
+		e.Err = err
+		return e
+	case apiErr.Code == "context_length_exceeded":
+		return errs.InvalidInput("message", "the conversation is too long for the model")
+	case apiErr.StatusCode == http.StatusBadRequest:
+		// A request the service built wrong.
+		return err
+	default:
+		return errs.Unavailable(upstream, "API error", err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/acai-travel/tech-challenge/internal/chat/assistant"
 	"github.com/acai-travel/tech-challenge/internal/chat/model"
+	"github.com/acai-travel/tech-challenge/internal/config"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -20,7 +21,9 @@ func TestAssistant_Title_Integration(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	assist := assistant.New()
+	cfg := config.Default()
+	cfg.OpenAI.APIKey = os.Getenv("OPENAI_API_KEY")
+	assist := assistant.New(cfg.OpenAI, cfg.Tools, nil, nil, nil)
 
 	conv := &model.Conversation{
 		ID: primitive.NewObjectID(),
@@ -0,0 +1,105 @@
+package assistant_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/acai-travel/tech-challenge/internal/auth"
+	"github.com/acai-travel/tech-challenge/internal/chat/assistant"
+	"github.com/acai-travel/tech-challenge/internal/chat/model"
+	"github.com/acai-travel/tech-challenge/internal/config"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryStore recalls its memories for any query, recording the queries.
+type memoryStore struct {
+	memories []*model.Memory
+	err      error
+	queries  []string
+}
+
+func (s *memoryStore) SaveMemory(ctx context.Context, m *model.Memory) error {
+	s.memories = append(s.memories, m)
+	return nil
+}
+
+func (s *memoryStore) RecallMemories(ctx context.Context, query string, limit int) ([]*model.Memory, error) {
+	s.queries = append(s.queries, query)
+	return s.memories[:min(len(s.memories), limit)], s.err
+}
+
+func (s *memoryStore) DeleteMemory(ctx context.Context, id string) error {
+	return nil
+}
+
+func TestAssistant_Reply_Memories(t *testing.T) {
+	var requests []completionRequest
+	cfg := config.Default()
+	cfg.OpenAI.APIKey = "test"
+	cfg.OpenAI.BaseURL = recordingOpenAI(t, &requests).URL
+	cfg.Tools = config.Tools{Date: config.Tool{Enabled: true}}
+
+	store := &memoryStore{memories: []*model.Memory{
+		{ID: primitive.NewObjectID(), Content: "Home airport is EDDF"},
+		{ID: primitive.NewObjectID(), Content: "Prefers Celsius"},
+	}}
+
+	assist := assistant.New(cfg.OpenAI, cfg.Tools, nil, nil, nil)
+	assist.RememberWith(store)
+
+	conv := &model.Conversation{
+		ID: primitive.NewObjectID(),
+		Messages: []*model.Message{
+			{Role: model.RoleUser, Content: "Hi"},
+			{Role: model.RoleAssistant, Content: "Hello!"},
+			{Role: model.RoleUser, Content: "Weather at my airport tomorrow?"},
+		},
+	}
+
+	ctx := auth.WithPrincipal(context.Background(), &auth.Principal{UserID: "alice"})
+	if _, err := assist.Reply(ctx, conv); err != nil {
+		t.Fatalf("Reply() error = %v", err)
+	}
+
+	if len(store.queries) != 1 || store.queries[0] != "Weather at my airport tomorrow?" {
+		t.Errorf("expected memories recalled for the last message, got %q", store.queries)
+	}
+
+	system := requests[0].Messages[0].Content
+	if !strings.Contains(system, "\n- Home airport is EDDF\n- Prefers Celsius") {
+		t.Errorf("expected the memories in the system prompt, got %q", system)
+	}
+
+	var tools []string
+	for _, tool := range requests[0].Tools {
+		tools = append(tools, tool.Function.Name)
+	}
+	if strings.Join(tools, ",") != "forget,get_today_date,recall,remember" {
+		t.Errorf("expected the memory tools, got %v", tools)
+	}
+
+	// Replies go on without memories when they can't be read.
+	store.err = errors.New("connection refused")
+	if _, err := assist.Reply(ctx, conv); err != nil {
+		t.Fatalf("Reply() error = %v", err)
+	}
+
+	if system := requests[1].Messages[0].Content; strings.Contains(system, "remember about the user") {
+		t.Errorf("expected no memories in the system prompt, got %q", system)
+	}
+
+	// Anonymous users have no memories to recall.
+	store.err = nil
+	if _, err := assist.Reply(context.Background(), conv); err != nil {
+		t.Fatalf("Reply() error = %v", err)
+	}
+
+	if len(store.queries) != 2 {
+		t.Errorf("expected no memories recalled for an anonymous user, got %q", store.queries)
+	}
+	if system := requests[2].Messages[0].Content; strings.Contains(system, "remember about the user") {
+		t.Errorf("expected no memories in the system prompt, got %q", system)
+	}
+}
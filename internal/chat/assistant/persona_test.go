@@ -0,0 +1,183 @@
+package assistant_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/acai-travel/tech-challenge/internal/chat/assistant"
+	"github.com/acai-travel/tech-challenge/internal/chat/model"
+	"github.com/acai-travel/tech-challenge/internal/chat/prompts"
+	"github.com/acai-travel/tech-challenge/internal/config"
+	"github.com/acai-travel/tech-challenge/internal/errs"
+	"github.com/acai-travel/tech-challenge/internal/httpx"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type personaStore map[string]*model.Persona
+
+func (s personaStore) GetPersona(ctx context.Context, name string) (*model.Persona, error) {
+	if p, ok := s[name]; ok {
+		return p, nil
+	}
+	return nil, errors.New("persona not found")
+}
+
+// completionRequest is the part of a chat completion request the persona
+// controls.
+type completionRequest struct {
+	Model       string   `json:"model"`
+	Temperature *float64 `json:"temperature"`
+	Messages    []struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	} `json:"messages"`
+	Tools []struct {
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	} `json:"tools"`
+}
+
+// recordingOpenAI answers every completion with a plain answer and records the
+// requests.
+func recordingOpenAI(t *testing.T, requests *[]completionRequest) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req completionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("invalid request: %v", err)
+		}
+		*requests = append(*requests, req)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"id":      "chatcmpl-1",
+			"object":  "chat.completion",
+			"created": 1,
+			"model":   req.Model,
+			"choices": []map[string]any{{"index": 0, "message": map[string]any{"role": "assistant", "content": "Hello!"}, "finish_reason": "stop"}},
+			"usage":   map[string]any{"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15},
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestAssistant_Reply_Persona(t *testing.T) {
+	temperature := 0.3
+	store := personaStore{
+		"concierge": {
+			Name:         "concierge",
+			SystemPrompt: "You are a hotel concierge.{{with .Locale}} Speak {{.}}.{{end}} Tools: {{join .Tools \", \"}}.",
+			Model:        "gpt-4.1-mini",
+			Temperature:  &temperature,
+			Tools:        []string{"get_today_date"},
+		},
+		// Saved before its model was removed from the allowed ones.
+		"retired": {
+			Name:         "retired",
+			SystemPrompt: "You are a travel agent.",
+			Model:        "gpt-3.5-turbo",
+		},
+	}
+
+	var requests []completionRequest
+	cfg := config.Default()
+	cfg.OpenAI.APIKey = "test"
+	cfg.OpenAI.BaseURL = recordingOpenAI(t, &requests).URL
+	cfg.OpenAI.PersonaModels = "gpt-4.1-mini"
+	cfg.Tools = config.Tools{Date: config.Tool{Enabled: true}, Time: config.Tool{Enabled: true}}
+	assist := assistant.New(cfg.OpenAI, cfg.Tools, store, nil, nil)
+
+	ctx := httpx.WithLocale(context.Background(), "de-DE")
+
+	var versions []string
+	for _, persona := range []string{"concierge", "deleted", "", "retired"} {
+		conv := &model.Conversation{
+			ID:       primitive.NewObjectID(),
+			Persona:  persona,
+			Messages: []*model.Message{{Role: model.RoleUser, Content: "Hi"}},
+		}
+
+		reply, err := assist.Reply(ctx, conv)
+		if err != nil {
+			t.Fatalf("Reply() error = %v", err)
+		}
+		versions = append(versions, reply.PromptVersion)
+	}
+
+	if len(requests) != 4 {
+		t.Fatalf("got %d requests, want 4", len(requests))
+	}
+
+	concierge := requests[0]
+	if concierge.Model != "gpt-4.1-mini" || concierge.Temperature == nil || *concierge.Temperature != 0.3 {
+		t.Errorf("persona model and temperature not used: %+v", concierge)
+	}
+	if concierge.Messages[0].Role != "system" || concierge.Messages[0].Content != "You are a hotel concierge. Speak de-DE. Tools: get_today_date." {
+		t.Errorf("persona system prompt not rendered: %+v", concierge.Messages[0])
+	}
+	if !strings.HasPrefix(versions[0], "persona/concierge@") {
+		t.Errorf("expected the persona prompt version, got %q", versions[0])
+	}
+	if len(concierge.Tools) != 1 || concierge.Tools[0].Function.Name != "get_today_date" {
+		t.Errorf("expected only the persona tools, got %+v", concierge.Tools)
+	}
+
+	// A deleted persona and no persona both get the default one.
+	want, err := prompts.Builtin().Render(prompts.Reply, prompts.Data{Locale: "de-DE", Tools: []string{"get_time_in_zone", "get_today_date"}})
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+
+	for i, req := range requests[1:3] {
+		if req.Model != cfg.OpenAI.ReplyModel || req.Temperature != nil || len(req.Tools) != 2 {
+			t.Errorf("expected the default persona, got %+v", req)
+		}
+		if req.Messages[0].Content != want.Text || versions[i+1] != want.Version {
+			t.Errorf("expected the reply template %s, got %s: %q", want.Version, versions[i+1], req.Messages[0].Content)
+		}
+	}
+
+	if retired := requests[3]; retired.Model != cfg.OpenAI.ReplyModel {
+		t.Errorf("expected a persona model no longer allowed to fall back to the reply model, got %q", retired.Model)
+	}
+}
+
+func TestAssistant_CheckPersona(t *testing.T) {
+	cfg := config.Default()
+	cfg.OpenAI.PersonaModels = "gpt-4.1-mini, o3"
+	cfg.Tools = config.Tools{Date: config.Tool{Enabled: true}}
+	assist := assistant.New(cfg.OpenAI, cfg.Tools, nil, nil, nil)
+
+	tests := []struct {
+		name     string
+		persona  model.Persona
+		argument string
+	}{
+		{"defaults", model.Persona{}, ""},
+		{"reply model", model.Persona{Model: cfg.OpenAI.ReplyModel}, ""},
+		{"allowed model", model.Persona{Model: "o3", Tools: []string{"get_today_date"}}, ""},
+		{"unknown model", model.Persona{Model: "gpt-5-pro"}, "persona.model"},
+		{"unknown tool", model.Persona{Tools: []string{"get_today_date", "get_weather"}}, "persona.tools"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := assist.CheckPersona(&tt.persona)
+
+			var e *errs.Error
+			switch {
+			case tt.argument == "" && err != nil:
+				t.Errorf("CheckPersona() error = %v", err)
+			case tt.argument != "" && (!errors.As(err, &e) || e.Kind != errs.KindInvalidInput || e.Argument != tt.argument):
+				t.Errorf("CheckPersona() error = %v, want invalid %s", err, tt.argument)
+			}
+		})
+	}
+}
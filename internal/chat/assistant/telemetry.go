@@ -0,0 +1,152 @@
+package assistant
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/acai-travel/tech-challenge/internal/ratelimit"
+	"github.com/openai/openai-go/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/semconv/v1.37.0/genaiconv"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// IterationKey is the agent loop iteration an LLM call belongs to, starting at
+// 0. The GenAI conventions have no attribute for it yet.
+const IterationKey = attribute.Key("gen_ai.agent.iteration")
+
+// PromptVersionKey is the version of the system prompt a reply is generated
+// with, see prompts.Prompt.
+const PromptVersionKey = attribute.Key("gen_ai.prompt.version")
+
+// Tool call outcomes, as counted by the tool calls metric.
+const (
+	OutcomeOK    = "ok"
+	OutcomeError = "error"
+)
+
+// instruments are the OTel metrics of the assistant, following the GenAI
+// semantic conventions where they define one.
+type instruments struct {
+	duration  genaiconv.ClientOperationDuration
+	tokens    genaiconv.ClientTokenUsage
+	toolCalls metric.Int64Counter
+}
+
+func newInstruments() instruments {
+	meter := otel.Meter("assistant")
+
+	duration, err := genaiconv.NewClientOperationDuration(meter,
+		metric.WithExplicitBucketBoundaries(0.01, 0.02, 0.04, 0.08, 0.16, 0.32, 0.64, 1.28, 2.56, 5.12, 10.24, 20.48, 40.96, 81.92),
+	)
+	if err != nil {
+		slog.Warn("Failed to create LLM duration histogram", "error", err)
+	}
+
+	tokens, err := genaiconv.NewClientTokenUsage(meter,
+		metric.WithExplicitBucketBoundaries(1, 4, 16, 64, 256, 1024, 4096, 16384, 65536, 262144, 1048576),
+	)
+	if err != nil {
+		slog.Warn("Failed to create LLM token usage histogram", "error", err)
+	}
+
+	toolCalls, err := meter.Int64Counter("gen_ai.tool.calls",
+		metric.WithDescription("Number of tool calls executed by the assistant, by tool and outcome."),
+		metric.WithUnit("{call}"),
+	)
+	if err != nil {
+		slog.Warn("Failed to create tool calls counter", "error", err)
+		toolCalls = noop.Int64Counter{}
+	}
+
+	return instruments{duration: duration, tokens: tokens, toolCalls: toolCalls}
+}
+
+// complete calls the chat completions API in a client span following the
+// GenAI conventions, and records its latency and token usage.
+func (a *Assistant) complete(ctx context.Context, params openai.ChatCompletionNewParams, attrs ...attribute.KeyValue) (*openai.ChatCompletion, error) {
+	requestModel := string(params.Model)
+
+	ctx, span := a.tracer.Start(ctx, "chat "+requestModel,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.GenAIOperationNameChat,
+			semconv.GenAIProviderNameOpenAI,
+			semconv.GenAIRequestModel(requestModel),
+		),
+		trace.WithAttributes(attrs...),
+	)
+	defer span.End()
+
+	if params.Temperature.Valid() {
+		span.SetAttributes(semconv.GenAIRequestTemperature(params.Temperature.Value))
+	}
+
+	start := time.Now()
+	resp, err := a.cli.Chat.Completions.New(ctx, params)
+	elapsed := time.Since(start).Seconds()
+
+	metricAttrs := []attribute.KeyValue{a.metrics.duration.AttrRequestModel(requestModel)}
+
+	if err != nil {
+		errType := errorType(err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.SetAttributes(semconv.ErrorTypeKey.String(string(errType)))
+
+		metricAttrs = append(metricAttrs, a.metrics.duration.AttrErrorType(errType))
+		a.metrics.duration.Record(ctx, elapsed, genaiconv.OperationNameChat, genaiconv.ProviderNameOpenAI, metricAttrs...)
+		return nil, llmError(err)
+	}
+
+	finishReasons := make([]string, len(resp.Choices))
+	for i, choice := range resp.Choices {
+		finishReasons[i] = choice.FinishReason
+	}
+
+	span.SetAttributes(
+		semconv.GenAIResponseID(resp.ID),
+		semconv.GenAIResponseModel(resp.Model),
+		semconv.GenAIResponseFinishReasons(finishReasons...),
+		semconv.GenAIUsageInputTokens(int(resp.Usage.PromptTokens)),
+		semconv.GenAIUsageOutputTokens(int(resp.Usage.CompletionTokens)),
+	)
+
+	metricAttrs = append(metricAttrs, a.metrics.duration.AttrResponseModel(resp.Model))
+	a.metrics.duration.Record(ctx, elapsed, genaiconv.OperationNameChat, genaiconv.ProviderNameOpenAI, metricAttrs...)
+	a.metrics.tokens.Record(ctx, resp.Usage.PromptTokens, genaiconv.OperationNameChat, genaiconv.ProviderNameOpenAI, genaiconv.TokenTypeInput, metricAttrs...)
+	a.metrics.tokens.Record(ctx, resp.Usage.CompletionTokens, genaiconv.OperationNameChat, genaiconv.ProviderNameOpenAI, genaiconv.TokenTypeOutput, metricAttrs...)
+
+	ratelimit.RecordTokens(ctx, resp.Usage.TotalTokens)
+
+	return resp, nil
+}
+
+// recordToolCall counts an executed tool call.
+func (a *Assistant) recordToolCall(ctx context.Context, name, outcome string) {
+	a.metrics.toolCalls.Add(ctx, 1, metric.WithAttributes(
+		semconv.GenAIToolName(name),
+		attribute.String("outcome", outcome),
+	))
+}
+
+// errorType is the error.type of a failed call: the HTTP status code of an API
+// error, timeout when the deadline passed and _OTHER for anything else.
+func errorType(err error) genaiconv.ErrorTypeAttr {
+	var apiErr *openai.Error
+	if errors.As(err, &apiErr) {
+		return genaiconv.ErrorTypeAttr(strconv.Itoa(apiErr.StatusCode))
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return genaiconv.ErrorTypeAttr("timeout")
+	}
+	return genaiconv.ErrorTypeOther
+}
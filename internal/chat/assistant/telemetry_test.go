@@ -0,0 +1,204 @@
+package assistant_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/acai-travel/tech-challenge/internal/chat/assistant"
+	"github.com/acai-travel/tech-challenge/internal/chat/model"
+	"github.com/acai-travel/tech-challenge/internal/config"
+	"github.com/acai-travel/tech-challenge/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// fakeOpenAI answers the first completion with a call to get_today_date and
+// the next ones with a plain answer.
+func fakeOpenAI(t *testing.T) *httptest.Server {
+	var calls atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		message := map[string]any{"role": "assistant", "content": "It is sunny."}
+		finishReason := "stop"
+
+		if calls.Add(1) == 1 {
+			message = map[string]any{
+				"role":    "assistant",
+				"content": "",
+				"tool_calls": []map[string]any{{
+					"id":       "call_1",
+					"type":     "function",
+					"function": map[string]any{"name": "get_today_date", "arguments": "{}"},
+				}},
+			}
+			finishReason = "tool_calls"
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"id":      "chatcmpl-1",
+			"object":  "chat.completion",
+			"created": 1,
+			"model":   "gpt-4.1-2025-04-14",
+			"choices": []map[string]any{{"index": 0, "message": message, "finish_reason": finishReason}},
+			"usage":   map[string]any{"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15},
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestAssistant_Reply_Telemetry(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	prevTP, prevMP := otel.GetTracerProvider(), otel.GetMeterProvider()
+	otel.SetTracerProvider(tp)
+	otel.SetMeterProvider(mp)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevTP)
+		otel.SetMeterProvider(prevMP)
+	})
+
+	cfg := config.Default()
+	cfg.OpenAI.APIKey = "test"
+	cfg.OpenAI.BaseURL = fakeOpenAI(t).URL
+	cfg.Tools = config.Tools{Date: config.Tool{Enabled: true}}
+	assist := assistant.New(cfg.OpenAI, cfg.Tools, nil, nil, nil)
+
+	conv := &model.Conversation{
+		ID:       primitive.NewObjectID(),
+		Messages: []*model.Message{{Role: model.RoleUser, Content: "What is the weather like today?"}},
+	}
+
+	completed := testutil.ToFloat64(metrics.ReplyTerminationsTotal.WithLabelValues(metrics.TerminationCompleted))
+
+	reply, err := assist.Reply(context.Background(), conv)
+	if err != nil {
+		t.Fatalf("Reply() error = %v", err)
+	}
+	if reply.Content != "It is sunny." {
+		t.Fatalf("Reply() = %q, want %q", reply.Content, "It is sunny.")
+	}
+	if !strings.HasPrefix(reply.PromptVersion, "reply@") {
+		t.Errorf("Reply() prompt version = %q, want the reply template", reply.PromptVersion)
+	}
+	if reply.Model != "gpt-4.1" || len(reply.Tools) != 1 || reply.Tools[0] != "get_today_date" {
+		t.Errorf("Reply() model = %q, tools = %v, want gpt-4.1 calling get_today_date", reply.Model, reply.Tools)
+	}
+
+	if got := testutil.ToFloat64(metrics.ReplyTerminationsTotal.WithLabelValues(metrics.TerminationCompleted)) - completed; got != 1 {
+		t.Errorf("got %v completed replies recorded, want 1", got)
+	}
+
+	t.Run("spans", func(t *testing.T) {
+		var chats []sdktrace.ReadOnlySpan
+		var tool sdktrace.ReadOnlySpan
+		for _, s := range spans.Ended() {
+			switch s.Name() {
+			case "chat gpt-4.1":
+				chats = append(chats, s)
+			case "execute_tool get_today_date":
+				tool = s
+			}
+		}
+
+		if len(chats) != 2 {
+			t.Fatalf("got %d chat spans, want 2", len(chats))
+		}
+		for i, s := range chats {
+			attrs := attributes(s.Attributes())
+			want := map[string]any{
+				"gen_ai.operation.name":          "chat",
+				"gen_ai.provider.name":           "openai",
+				"gen_ai.request.model":           "gpt-4.1",
+				"gen_ai.response.model":          "gpt-4.1-2025-04-14",
+				"gen_ai.usage.input_tokens":      int64(10),
+				"gen_ai.usage.output_tokens":     int64(5),
+				"gen_ai.agent.iteration":         int64(i),
+				"gen_ai.conversation.id":         conv.ID.Hex(),
+				"gen_ai.response.finish_reasons": []string{[]string{"tool_calls", "stop"}[i]},
+			}
+			for k, v := range want {
+				if got, _ := json.Marshal(attrs[k]); string(got) != mustJSON(v) {
+					t.Errorf("chat span %d: %s = %s, want %s", i, k, got, mustJSON(v))
+				}
+			}
+		}
+
+		if tool == nil {
+			t.Fatal("no execute_tool span")
+		}
+		attrs := attributes(tool.Attributes())
+		if attrs["gen_ai.tool.call.id"] != "call_1" || attrs["gen_ai.operation.name"] != "execute_tool" {
+			t.Errorf("unexpected execute_tool attributes: %v", attrs)
+		}
+	})
+
+	t.Run("metrics", func(t *testing.T) {
+		var rm metricdata.ResourceMetrics
+		if err := reader.Collect(context.Background(), &rm); err != nil {
+			t.Fatalf("Collect() error = %v", err)
+		}
+
+		got := map[string]metricdata.Aggregation{}
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				got[m.Name] = m.Data
+			}
+		}
+
+		duration, ok := got["gen_ai.client.operation.duration"].(metricdata.Histogram[float64])
+		if !ok || len(duration.DataPoints) != 1 || duration.DataPoints[0].Count != 2 {
+			t.Errorf("gen_ai.client.operation.duration = %+v, want 2 calls", got["gen_ai.client.operation.duration"])
+		}
+
+		tokens, ok := got["gen_ai.client.token.usage"].(metricdata.Histogram[int64])
+		if !ok || len(tokens.DataPoints) != 2 {
+			t.Fatalf("gen_ai.client.token.usage = %+v, want input and output points", got["gen_ai.client.token.usage"])
+		}
+		for _, dp := range tokens.DataPoints {
+			tokenType, _ := dp.Attributes.Value("gen_ai.token.type")
+			want := map[string]int64{"input": 20, "output": 10}[tokenType.AsString()]
+			if dp.Sum != want {
+				t.Errorf("%s tokens = %d, want %d", tokenType.AsString(), dp.Sum, want)
+			}
+		}
+
+		toolCalls, ok := got["gen_ai.tool.calls"].(metricdata.Sum[int64])
+		if !ok || len(toolCalls.DataPoints) != 1 || toolCalls.DataPoints[0].Value != 1 {
+			t.Fatalf("gen_ai.tool.calls = %+v, want 1 call", got["gen_ai.tool.calls"])
+		}
+		outcome, _ := toolCalls.DataPoints[0].Attributes.Value("outcome")
+		if outcome.AsString() != assistant.OutcomeOK {
+			t.Errorf("tool call outcome = %q, want %q", outcome.AsString(), assistant.OutcomeOK)
+		}
+	})
+}
+
+func attributes(kvs []attribute.KeyValue) map[string]any {
+	attrs := make(map[string]any, len(kvs))
+	for _, kv := range kvs {
+		attrs[string(kv.Key)] = kv.Value.AsInterface()
+	}
+	return attrs
+}
+
+func mustJSON(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,170 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/acai-travel/tech-challenge/internal/auth"
+	"github.com/acai-travel/tech-challenge/internal/chat/model"
+	"github.com/acai-travel/tech-challenge/internal/httpx"
+	"github.com/acai-travel/tech-challenge/internal/logx"
+	"github.com/acai-travel/tech-challenge/internal/metrics"
+	"github.com/acai-travel/tech-challenge/internal/pb"
+	"github.com/twitchtv/twirp"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxAuditConversationID caps the length of a conversation ID recorded as
+// sent, so that invalid IDs can't bloat the audit log.
+const maxAuditConversationID = 64
+
+// audit records an event of the action for each conversation, or a single one
+// without conversation IDs, with the outcome of err. Events that can't be
+// stored are logged and counted, the call does not fail because of them.
+func (s *Server) audit(ctx context.Context, action model.AuditAction, err error, conversationIDs ...string) {
+	if len(conversationIDs) == 0 {
+		conversationIDs = []string{""}
+	}
+
+	event := model.AuditEvent{
+		Timestamp: time.Now(),
+		Action:    action,
+		ClientIP:  httpx.ClientIP(ctx),
+		Outcome:   auditOutcome(err),
+		RequestID: logx.RequestID(ctx),
+	}
+
+	if p, ok := auth.FromContext(ctx); ok {
+		event.UserID = p.UserID
+		event.KeyID = p.KeyID
+	}
+
+	// Stored even when the caller went away.
+	ctx = context.WithoutCancel(ctx)
+
+	for _, id := range conversationIDs {
+		e := event
+		e.ID = primitive.NewObjectID()
+		e.ConversationID = id[:min(len(id), maxAuditConversationID)]
+
+		if err := s.repo.RecordAudit(ctx, &e); err != nil {
+			slog.ErrorContext(ctx, "Failed to record audit event", "action", action, "conversation_id", e.ConversationID, "error", err)
+			metrics.RecordAudit(string(action), false)
+			continue
+		}
+
+		metrics.RecordAudit(string(action), true)
+	}
+}
+
+// auditOutcome is ok without error, or the Twirp code the error is served with.
+func auditOutcome(err error) string {
+	if err == nil {
+		return model.AuditOutcomeOK
+	}
+
+	var te twirp.Error
+	if errors.As(err, &te) {
+		return string(te.Code())
+	}
+
+	return string(twirp.Internal)
+}
+
+func (s *Server) ListAuditEvents(ctx context.Context, req *pb.ListAuditEventsRequest) (_ *pb.ListAuditEventsResponse, err error) {
+	defer func() { s.audit(ctx, model.AuditLogList, err) }()
+
+	if !auth.IsAdmin(ctx) {
+		return nil, twirp.NewError(twirp.PermissionDenied, "the audit log is only available to admins")
+	}
+
+	if req.GetPageSize() < 0 {
+		return nil, twirp.InvalidArgumentError("page_size", "must not be negative")
+	}
+
+	filter, err := auditFilter(req.GetFilter())
+	if err != nil {
+		return nil, err
+	}
+
+	events, next, err := s.repo.ListAuditEvents(ctx, filter, model.AuditPage{
+		Size:  int(req.GetPageSize()),
+		Token: req.GetPageToken(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.ListAuditEventsResponse{NextPageToken: next}
+	for _, e := range events {
+		resp.Events = append(resp.Events, e.Proto())
+	}
+
+	return resp, nil
+}
+
+func (s *Server) ExportAuditEvents(ctx context.Context, req *pb.ExportAuditEventsRequest) (_ *pb.ExportAuditEventsResponse, err error) {
+	defer func() { s.audit(ctx, model.AuditLogExport, err) }()
+
+	if !auth.IsAdmin(ctx) {
+		return nil, twirp.NewError(twirp.PermissionDenied, "the audit log is only available to admins")
+	}
+
+	filter, err := auditFilter(req.GetFilter())
+	if err != nil {
+		return nil, err
+	}
+
+	events, next, err := s.repo.ExportAuditEvents(ctx, filter, req.GetPageToken())
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return nil, twirp.InternalErrorWith(err)
+		}
+	}
+
+	return &pb.ExportAuditEventsResponse{
+		Filename:      "audit-" + time.Now().UTC().Format("20060102T150405Z") + ".jsonl",
+		ContentType:   "application/jsonl",
+		Content:       buf.Bytes(),
+		NextPageToken: next,
+	}, nil
+}
+
+func auditFilter(f *pb.AuditFilter) (model.AuditFilter, error) {
+	filter := model.AuditFilter{
+		UserID:         f.GetUserId(),
+		Action:         model.AuditAction(f.GetAction()),
+		ConversationID: f.GetConversationId(),
+		Outcome:        f.GetOutcome(),
+	}
+
+	if filter.Action != "" && !slices.Contains(model.AuditActions, filter.Action) {
+		actions := make([]string, 0, len(model.AuditActions))
+		for _, a := range model.AuditActions {
+			actions = append(actions, string(a))
+		}
+		return filter, twirp.InvalidArgumentError("filter.action", "must be one of "+strings.Join(actions, ", "))
+	}
+
+	if f.GetFrom() != nil {
+		filter.From = f.GetFrom().AsTime()
+	}
+
+	if f.GetTo() != nil {
+		filter.To = f.GetTo().AsTime()
+	}
+
+	return filter, nil
+}
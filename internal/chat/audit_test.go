@@ -0,0 +1,249 @@
+package chat
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/acai-travel/tech-challenge/internal/auth"
+	"github.com/acai-travel/tech-challenge/internal/chat/model"
+	. "github.com/acai-travel/tech-challenge/internal/chat/testing"
+	"github.com/acai-travel/tech-challenge/internal/httpx"
+	"github.com/acai-travel/tech-challenge/internal/logx"
+	"github.com/acai-travel/tech-challenge/internal/pb"
+	"github.com/google/uuid"
+	"github.com/twitchtv/twirp"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestServer_Audit(t *testing.T) {
+	ctx := context.Background()
+
+	// caller returns the context of a request of a new user, whose audit events
+	// are removed after the test.
+	caller := func(t *testing.T) (context.Context, string) {
+		user := "auditee-" + uuid.NewString()
+		t.Cleanup(func() {
+			_, _ = ConnectMongo().Collection("audit").DeleteMany(ctx, bson.M{"user_id": user})
+		})
+
+		ctx := auth.WithPrincipal(ctx, &auth.Principal{UserID: user, KeyID: "dev"})
+		ctx = httpx.WithClientIP(ctx, "203.0.113.7")
+		ctx = logx.WithRequestID(ctx, "req-"+user)
+		return ctx, user
+	}
+
+	// Reads of the audit log are audited too, the admin's are removed after the
+	// test.
+	admin := auth.WithPrincipal(ctx, &auth.Principal{UserID: "compliance", Admin: true})
+	t.Cleanup(func() {
+		_, _ = ConnectMongo().Collection("audit").DeleteMany(ctx, bson.M{"user_id": "compliance"})
+	})
+
+	t.Run("records access and changes", WithFixture(func(t *testing.T, f *Fixture) {
+		ctx, user := caller(t)
+		c := f.CreateConversation(withTurns, func(c *model.Conversation) { c.Owner = user })
+		srv := NewServer(model.New(ConnectMongo()), &MockAssistant{})
+
+		if _, err := srv.DescribeConversation(ctx, &pb.DescribeConversationRequest{ConversationId: c.ID.Hex()}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, err := srv.ListConversations(ctx, &pb.ListConversationsRequest{}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, err := srv.DeleteConversation(ctx, &pb.DeleteConversationRequest{ConversationId: c.ID.Hex()}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		_, err := srv.DescribeConversation(ctx, &pb.DescribeConversationRequest{ConversationId: c.ID.Hex()})
+		if te, ok := err.(twirp.Error); !ok || te.Code() != twirp.NotFound {
+			t.Fatalf("expected the conversation to be deleted, got %v", err)
+		}
+
+		resp, err := srv.ListAuditEvents(admin, &pb.ListAuditEventsRequest{Filter: &pb.AuditFilter{UserId: user}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		want := []struct{ action, conversation, outcome string }{
+			{"describe", c.ID.Hex(), "not_found"},
+			{"delete", c.ID.Hex(), "ok"},
+			{"list", "", "ok"},
+			{"describe", c.ID.Hex(), "ok"},
+		}
+
+		if len(resp.GetEvents()) != len(want) {
+			t.Fatalf("expected %d events, got %v", len(want), resp.GetEvents())
+		}
+
+		for i, e := range resp.GetEvents() {
+			if e.GetAction() != want[i].action || e.GetConversationId() != want[i].conversation || e.GetOutcome() != want[i].outcome {
+				t.Errorf("event %d: expected %v, got %v", i, want[i], e)
+			}
+
+			if e.GetKeyId() != "dev" || e.GetClientIp() != "203.0.113.7" || e.GetRequestId() != "req-"+user || e.GetTimestamp() == nil {
+				t.Errorf("event %d: expected the caller and request, got %v", i, e)
+			}
+		}
+	}))
+
+	t.Run("filters and pages events", WithFixture(func(t *testing.T, f *Fixture) {
+		ctx, user := caller(t)
+		srv := NewServer(model.New(ConnectMongo()), &MockAssistant{})
+
+		for range 3 {
+			if _, err := srv.ListConversations(ctx, &pb.ListConversationsRequest{}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		_, _ = srv.DescribeConversation(ctx, &pb.DescribeConversationRequest{})
+
+		filter := &pb.AuditFilter{UserId: user, Action: "list"}
+		first, err := srv.ListAuditEvents(admin, &pb.ListAuditEventsRequest{Filter: filter, PageSize: 2})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(first.GetEvents()) != 2 || first.GetNextPageToken() == "" {
+			t.Fatalf("expected a full first page, got %v", first)
+		}
+
+		second, err := srv.ListAuditEvents(admin, &pb.ListAuditEventsRequest{Filter: filter, PageSize: 2, PageToken: first.GetNextPageToken()})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(second.GetEvents()) != 1 || second.GetNextPageToken() != "" {
+			t.Fatalf("expected the last event, got %v", second)
+		}
+
+		if second.GetEvents()[0].GetId() == first.GetEvents()[1].GetId() {
+			t.Error("expected pages not to overlap")
+		}
+
+		failed, err := srv.ListAuditEvents(admin, &pb.ListAuditEventsRequest{Filter: &pb.AuditFilter{UserId: user, Outcome: "invalid_argument"}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(failed.GetEvents()) != 1 || failed.GetEvents()[0].GetAction() != "describe" {
+			t.Errorf("expected the failed describe, got %v", failed.GetEvents())
+		}
+	}))
+
+	t.Run("exports events as JSONL", WithFixture(func(t *testing.T, f *Fixture) {
+		ctx, user := caller(t)
+		srv := NewServer(model.New(ConnectMongo()), &MockAssistant{})
+
+		_, _ = srv.ListConversations(ctx, &pb.ListConversationsRequest{})
+		_, _ = srv.SearchConversations(ctx, &pb.SearchConversationsRequest{})
+
+		resp, err := srv.ExportAuditEvents(admin, &pb.ExportAuditEventsRequest{Filter: &pb.AuditFilter{UserId: user}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if resp.GetContentType() != "application/jsonl" {
+			t.Errorf("expected JSONL, got %s", resp.GetContentType())
+		}
+
+		var actions []string
+		scanner := bufio.NewScanner(bytes.NewReader(resp.GetContent()))
+		for scanner.Scan() {
+			var e model.AuditEvent
+			if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+				t.Fatalf("invalid line %q: %v", scanner.Text(), err)
+			}
+
+			if e.UserID != user || e.ClientIP != "203.0.113.7" {
+				t.Errorf("unexpected event: %+v", e)
+			}
+			actions = append(actions, string(e.Action))
+		}
+
+		// Oldest first.
+		if len(actions) != 2 || actions[0] != "list" || actions[1] != "search" {
+			t.Errorf("expected list then search, got %v", actions)
+		}
+	}))
+
+	t.Run("exports events page by page", WithFixture(func(t *testing.T, f *Fixture) {
+		_, user := caller(t)
+		srv := NewServer(model.New(ConnectMongo()), &MockAssistant{})
+
+		start := time.Now().Add(-time.Hour)
+		events := make([]any, model.AuditExportPageSize+1)
+		for i := range events {
+			events[i] = &model.AuditEvent{ID: primitive.NewObjectID(), Timestamp: start.Add(time.Duration(i) * time.Millisecond), UserID: user, Action: model.AuditList, Outcome: model.AuditOutcomeOK}
+		}
+		if _, err := ConnectMongo().Collection("audit").InsertMany(ctx, events); err != nil {
+			t.Fatalf("failed to insert audit events: %v", err)
+		}
+
+		req := &pb.ExportAuditEventsRequest{Filter: &pb.AuditFilter{UserId: user}}
+
+		var pages [][]byte
+		for {
+			resp, err := srv.ExportAuditEvents(admin, req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			pages = append(pages, resp.GetContent())
+			if req.PageToken = resp.GetNextPageToken(); req.PageToken == "" {
+				break
+			}
+		}
+
+		if len(pages) != 2 || bytes.Count(pages[0], []byte("\n")) != model.AuditExportPageSize || bytes.Count(pages[1], []byte("\n")) != 1 {
+			t.Fatalf("expected a full page and the last event, got %d pages", len(pages))
+		}
+
+		var last model.AuditEvent
+		if err := json.Unmarshal(pages[1], &last); err != nil || last.ID != events[len(events)-1].(*model.AuditEvent).ID {
+			t.Errorf("expected the newest event last, got %+v, %v", last, err)
+		}
+	}))
+
+	t.Run("audit log requires an admin", WithFixture(func(t *testing.T, f *Fixture) {
+		ctx, user := caller(t)
+		srv := NewServer(model.New(ConnectMongo()), &MockAssistant{})
+
+		_, err := srv.ListAuditEvents(ctx, &pb.ListAuditEventsRequest{})
+		if te, ok := err.(twirp.Error); !ok || te.Code() != twirp.PermissionDenied {
+			t.Errorf("expected permission denied, got %v", err)
+		}
+
+		_, err = srv.ExportAuditEvents(ctx, &pb.ExportAuditEventsRequest{})
+		if te, ok := err.(twirp.Error); !ok || te.Code() != twirp.PermissionDenied {
+			t.Errorf("expected permission denied, got %v", err)
+		}
+
+		resp, err := srv.ListAuditEvents(admin, &pb.ListAuditEventsRequest{Filter: &pb.AuditFilter{UserId: user}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		events := resp.GetEvents()
+		if len(events) != 2 || events[0].GetAction() != "audit_export" || events[1].GetAction() != "audit_list" ||
+			events[0].GetOutcome() != "permission_denied" || events[1].GetOutcome() != "permission_denied" {
+			t.Errorf("expected the denied reads to be recorded, got %v", events)
+		}
+	}))
+
+	t.Run("unknown action", WithFixture(func(t *testing.T, f *Fixture) {
+		srv := NewServer(model.New(ConnectMongo()), &MockAssistant{})
+
+		_, err := srv.ListAuditEvents(admin, &pb.ListAuditEventsRequest{Filter: &pb.AuditFilter{Action: "read"}})
+		if te, ok := err.(twirp.Error); !ok || te.Code() != twirp.InvalidArgument {
+			t.Errorf("expected invalid argument, got %v", err)
+		}
+	}))
+}
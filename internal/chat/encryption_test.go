@@ -0,0 +1,246 @@
+package chat
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/acai-travel/tech-challenge/internal/auth"
+	"github.com/acai-travel/tech-challenge/internal/chat/model"
+	. "github.com/acai-travel/tech-challenge/internal/chat/testing"
+	"github.com/acai-travel/tech-challenge/internal/encryption"
+	"github.com/acai-travel/tech-challenge/internal/pb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestServer_Encryption(t *testing.T) {
+	ctx := context.Background()
+
+	// Reencrypt rewrites every document, so the test has a database of its own.
+	db := ConnectMongo().Client().Database(ConnectMongo().Name() + "_encryption")
+	t.Cleanup(func() { _ = db.Drop(ctx) })
+
+	keys := func(t *testing.T, s string) *encryption.KeySet {
+		t.Helper()
+		ks, err := encryption.ParseKeySet(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ks
+	}
+	k1 := "k1:" + base64.StdEncoding.EncodeToString([]byte(strings.Repeat("1", 32)))
+	k2 := "k2:" + base64.StdEncoding.EncodeToString([]byte(strings.Repeat("2", 32)))
+
+	raw := func(t *testing.T, collection string, id primitive.ObjectID) bson.M {
+		t.Helper()
+		var doc bson.M
+		if err := db.Collection(collection).FindOne(ctx, bson.M{"_id": id}).Decode(&doc); err != nil {
+			t.Fatalf("failed to read %s %s: %v", collection, id.Hex(), err)
+		}
+		return doc
+	}
+
+	keyOf := func(v any) string {
+		id, _ := encryption.KeyID(v.(string))
+		return id
+	}
+
+	// A conversation stored before encryption was enabled, with a message that
+	// looks encrypted.
+	lookalike := "enc:v1:k1:AAAA:BBBB is what I found in the database"
+	legacy := &model.Conversation{
+		ID:        primitive.NewObjectID(),
+		Title:     "Trip to Lisbon",
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Messages: []*model.Message{
+			{ID: primitive.NewObjectID(), Role: model.RoleUser, Content: "Hotels in Lisbon?", CreatedAt: time.Now(), UpdatedAt: time.Now()},
+			{ID: primitive.NewObjectID(), Role: model.RoleUser, Content: lookalike, CreatedAt: time.Now().Add(time.Second), UpdatedAt: time.Now()},
+		},
+	}
+	if err := model.New(db).CreateConversation(ctx, legacy); err != nil {
+		t.Fatalf("failed to create conversation: %v", err)
+	}
+
+	if old, err := model.New(db).DescribeConversation(ctx, legacy.ID.Hex()); err != nil || old.Messages[1].Content != lookalike {
+		t.Fatalf("expected the message that looks encrypted to be readable, got %v, %v", old, err)
+	}
+
+	repo := model.New(db)
+	repo.EncryptWith(keys(t, k1))
+	srv := NewServer(repo, &MockAssistant{
+		TitleFunc: func(ctx context.Context, conv *model.Conversation) (string, error) {
+			return "Passport renewal before Tokyo", nil
+		},
+		ReplyFunc: func(ctx context.Context, conv *model.Conversation) (string, error) {
+			return "Renew it at least 6 months before.", nil
+		},
+	})
+
+	started, err := srv.StartConversation(ctx, &pb.StartConversationRequest{Message: "My passport expires in May, I fly to Tokyo in April"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	id, _ := primitive.ObjectIDFromHex(started.GetConversationId())
+	if doc := raw(t, "conversations", id); keyOf(doc["subject"]) != "k1" {
+		t.Errorf("expected the title to be encrypted with k1, got %v", doc["subject"])
+	}
+
+	described, err := srv.DescribeConversation(ctx, &pb.DescribeConversationRequest{ConversationId: id.Hex()})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	conv := described.GetConversation()
+	if conv.GetTitle() != "Passport renewal before Tokyo" || conv.GetMessages()[1].GetContent() != "Renew it at least 6 months before." {
+		t.Errorf("expected plain text, got %v", conv)
+	}
+
+	first := conv.GetMessages()[0]
+	if _, err := srv.EditMessage(ctx, &pb.EditMessageRequest{ConversationId: id.Hex(), MessageId: first.GetId(), Content: "I fly to Tokyo in June"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Memories are only kept for authenticated users.
+	user := auth.WithPrincipal(ctx, &auth.Principal{UserID: "traveller"})
+	memory := &model.Memory{ID: primitive.NewObjectID(), Owner: "traveller", Content: "Home airport is EDDF", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if err := repo.SaveMemory(user, memory); err != nil {
+		t.Fatalf("SaveMemory() error = %v", err)
+	}
+	if doc := raw(t, "memories", memory.ID); keyOf(doc["content"]) != "k1" {
+		t.Errorf("expected the memory to be encrypted with k1, got %v", doc["content"])
+	}
+
+	firstID, _ := primitive.ObjectIDFromHex(first.GetId())
+	doc := raw(t, "messages", firstID)
+	versions := doc["versions"].(bson.A)
+	if keyOf(doc["content"]) != "k1" || keyOf(versions[0].(bson.M)["content"]) != "k1" {
+		t.Errorf("expected the content and earlier versions to be encrypted, got %v", doc)
+	}
+
+	described, err = srv.DescribeConversation(ctx, &pb.DescribeConversationRequest{ConversationId: id.Hex()})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	edited := described.GetConversation().GetMessages()[0]
+	if edited.GetContent() != "I fly to Tokyo in June" || edited.GetPreviousVersions()[0].GetContent() != "My passport expires in May, I fly to Tokyo in April" {
+		t.Errorf("expected the edited message in plain text, got %v", edited)
+	}
+
+	// Content stored in plain text stays readable.
+	if old, err := repo.DescribeConversation(ctx, legacy.ID.Hex()); err != nil || old.Title != "Trip to Lisbon" || old.Messages[0].Content != "Hotels in Lisbon?" {
+		t.Errorf("expected the legacy conversation to be readable, got %v, %v", old, err)
+	}
+
+	// Search matches the decrypted content.
+	for query, snippets := range map[string]int{"tokyo": 1, "tokyo -june": 0} {
+		found, err := srv.SearchConversations(ctx, &pb.SearchConversationsRequest{Query: query})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if hits := found.GetHits(); len(hits) != 1 || hits[0].GetConversationId() != id.Hex() || len(hits[0].GetTitleHighlights()) != 1 || len(hits[0].GetSnippets()) != snippets {
+			t.Errorf("search %q: expected the title and %d messages to match, got %v", query, snippets, hits)
+		}
+		if found.GetTruncated() {
+			t.Errorf("search %q: expected every message to be searched", query)
+		}
+	}
+
+	// Text indexes created before encryption was enabled are dropped, where
+	// the database supports them.
+	_ = model.New(db).SetupSearchIndexes(ctx)
+
+	if err := repo.SetupSearchIndexes(ctx); err != nil {
+		t.Fatalf("SetupSearchIndexes() error = %v", err)
+	}
+	if indexes, _ := db.Collection("conversations").Indexes().ListSpecifications(ctx); len(indexes) != 1 {
+		t.Errorf("expected no text index over ciphertext, got %v", indexes)
+	}
+	if indexes, _ := db.Collection("messages").Indexes().ListSpecifications(ctx); len(indexes) != 1 {
+		t.Errorf("expected no text index over ciphertext, got %v", indexes)
+	}
+
+	// Rotate to k2, keeping k1 to read what it encrypted.
+	rotated := model.New(db)
+	rotated.EncryptWith(keys(t, k2+","+k1))
+
+	stats, err := rotated.Reencrypt(ctx)
+	if err != nil {
+		t.Fatalf("Reencrypt() error = %v", err)
+	}
+	if stats.Conversations != 2 || stats.Messages != 4 || stats.Memories != 1 {
+		t.Errorf("expected 2 conversations, 4 messages and a memory encrypted, got %+v", stats)
+	}
+
+	if stats, _ := rotated.Reencrypt(ctx); stats != (model.ReencryptStats{}) {
+		t.Errorf("expected nothing left to encrypt, got %+v", stats)
+	}
+
+	if doc := raw(t, "messages", firstID); keyOf(doc["content"]) != "k2" || keyOf(doc["versions"].(bson.A)[0].(bson.M)["content"]) != "k2" {
+		t.Errorf("expected the message to be encrypted with k2, got %v", doc)
+	}
+
+	// A message whose content was rotated but not its earlier versions, as
+	// after an interrupted run, is rotated again.
+	stale, err := keys(t, k1).Encrypt("My passport expires in May, I fly to Tokyo in April", firstID.Hex())
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	if _, err := db.Collection("messages").UpdateOne(ctx, bson.M{"_id": firstID}, bson.M{"$set": bson.M{"versions.0.content": stale}}); err != nil {
+		t.Fatalf("failed to update message: %v", err)
+	}
+
+	if stats, err := rotated.Reencrypt(ctx); err != nil || stats.Messages != 1 {
+		t.Errorf("expected the message versions to be rotated, got %+v, %v", stats, err)
+	}
+	if doc := raw(t, "messages", firstID); keyOf(doc["versions"].(bson.A)[0].(bson.M)["content"]) != "k2" {
+		t.Errorf("expected the earlier version to be encrypted with k2, got %v", doc)
+	}
+	if doc := raw(t, "conversations", legacy.ID); keyOf(doc["subject"]) != "k2" {
+		t.Errorf("expected the legacy title to be encrypted with k2, got %v", doc["subject"])
+	}
+
+	// k1 is no longer needed.
+	current := model.New(db)
+	current.EncryptWith(keys(t, k2))
+	for _, cid := range []string{id.Hex(), legacy.ID.Hex()} {
+		if _, err := current.DescribeConversation(ctx, cid); err != nil {
+			t.Errorf("DescribeConversation(%s) error = %v", cid, err)
+		}
+	}
+
+	if old, err := current.DescribeConversation(ctx, legacy.ID.Hex()); err != nil || old.Messages[1].Content != lookalike {
+		t.Errorf("expected the message that looks encrypted to be kept, got %v, %v", old, err)
+	}
+
+	if memories, err := current.ListMemories(user); err != nil || len(memories) != 1 || memories[0].Content != "Home airport is EDDF" {
+		t.Errorf("ListMemories() = %v, %v, want the memory in plain text", memories, err)
+	}
+
+	// Without keys, encrypted content cannot be read.
+	if _, err := model.New(db).DescribeConversation(ctx, id.Hex()); err == nil || !strings.Contains(err.Error(), "no encryption keys") {
+		t.Errorf("expected an error without keys, got %v", err)
+	}
+	// Past the most recent messages, older ones are not searched and the
+	// results are flagged as truncated.
+	var older []any
+	for i := range 2000 {
+		at := time.Now().Add(-time.Duration(i+1) * time.Hour)
+		older = append(older, &model.Message{ID: primitive.NewObjectID(), ConversationID: legacy.ID, Role: model.RoleUser, Content: "Trains in Portugal?", CreatedAt: at, UpdatedAt: at})
+	}
+	if _, err := db.Collection("messages").InsertMany(ctx, older); err != nil {
+		t.Fatalf("failed to insert messages: %v", err)
+	}
+
+	found, err := NewServer(current, &MockAssistant{}).SearchConversations(ctx, &pb.SearchConversationsRequest{Query: "tokyo"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(found.GetHits()) != 1 || !found.GetTruncated() {
+		t.Errorf("expected the recent match and truncated results, got %v", found)
+	}
+}
@@ -0,0 +1,397 @@
+// Package export converts conversations to and from files: a lossless JSON
+// form to move conversations between environments, readable Markdown
+// transcripts and the OpenAI fine-tuning JSONL format.
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/acai-travel/tech-challenge/internal/chat/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Format string
+
+const (
+	FormatJSON     Format = "json"
+	FormatMarkdown Format = "markdown"
+	FormatJSONL    Format = "jsonl"
+)
+
+// version of the lossless JSON document.
+const version = 1
+
+func (f Format) ContentType() string {
+	switch f {
+	case FormatMarkdown:
+		return "text/markdown"
+	case FormatJSONL:
+		return "application/jsonl"
+	default:
+		return "application/json"
+	}
+}
+
+func (f Format) Extension() string {
+	switch f {
+	case FormatMarkdown:
+		return ".md"
+	case FormatJSONL:
+		return ".jsonl"
+	default:
+		return ".json"
+	}
+}
+
+type document struct {
+	Version       int             `json:"version"`
+	Conversations []*conversation `json:"conversations"`
+}
+
+type conversation struct {
+	ID         string     `json:"id"`
+	Title      string     `json:"title"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	Pinned     bool       `json:"pinned,omitempty"`
+	Retention  string     `json:"retention,omitempty"`
+	Persona    string     `json:"persona,omitempty"`
+	Ancestors  []string   `json:"ancestors,omitempty"`
+	ForkedFrom string     `json:"forked_from,omitempty"`
+	Messages   []*message `json:"messages"`
+}
+
+type message struct {
+	ID            string            `json:"id"`
+	Role          model.Role        `json:"role"`
+	Content       string            `json:"content"`
+	CreatedAt     time.Time         `json:"created_at"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+	Version       int               `json:"version,omitempty"`
+	Versions      []*messageVersion `json:"versions,omitempty"`
+	PromptVersion string            `json:"prompt_version,omitempty"`
+	Model         string            `json:"model,omitempty"`
+	Tools         []string          `json:"tools,omitempty"`
+}
+
+type messageVersion struct {
+	Version       int       `json:"version"`
+	Content       string    `json:"content"`
+	CreatedAt     time.Time `json:"created_at"`
+	PromptVersion string    `json:"prompt_version,omitempty"`
+}
+
+// fineTuningExample is a single line of the OpenAI fine-tuning format.
+type fineTuningExample struct {
+	Messages []fineTuningMessage `json:"messages"`
+}
+
+type fineTuningMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Encode writes the conversations, including their messages, in the given format.
+func Encode(w io.Writer, format Format, convs ...*model.Conversation) error {
+	switch format {
+	case FormatJSON:
+		return encodeJSON(w, convs)
+	case FormatMarkdown:
+		return encodeMarkdown(w, convs)
+	case FormatJSONL:
+		return encodeJSONL(w, convs)
+	default:
+		return fmt.Errorf("unsupported export format %q", format)
+	}
+}
+
+// Decode reads conversations written by Encode. The JSON form restores IDs
+// and timestamps, conversations read from JSONL get new IDs and the current
+// time. Markdown transcripts can't be decoded.
+func Decode(r io.Reader, format Format) ([]*model.Conversation, error) {
+	switch format {
+	case FormatJSON:
+		return decodeJSON(r)
+	case FormatJSONL:
+		return decodeJSONL(r)
+	default:
+		return nil, fmt.Errorf("unsupported import format %q", format)
+	}
+}
+
+func encodeJSON(w io.Writer, convs []*model.Conversation) error {
+	doc := document{Version: version, Conversations: []*conversation{}}
+
+	for _, c := range convs {
+		out := &conversation{
+			ID:        c.ID.Hex(),
+			Title:     c.Title,
+			CreatedAt: c.CreatedAt,
+			UpdatedAt: c.UpdatedAt,
+			Pinned:    c.Pinned,
+			Persona:   c.Persona,
+			Messages:  []*message{},
+		}
+
+		if c.Retention > 0 {
+			out.Retention = c.Retention.String()
+		}
+
+		for _, id := range c.Ancestors {
+			out.Ancestors = append(out.Ancestors, id.Hex())
+		}
+
+		if !c.ForkedFrom.IsZero() {
+			out.ForkedFrom = c.ForkedFrom.Hex()
+		}
+
+		for _, m := range c.Messages {
+			msg := &message{
+				ID:            m.ID.Hex(),
+				Role:          m.Role,
+				Content:       m.Content,
+				CreatedAt:     m.CreatedAt,
+				UpdatedAt:     m.UpdatedAt,
+				Version:       m.Version,
+				PromptVersion: m.PromptVersion,
+				Model:         m.Model,
+				Tools:         m.Tools,
+			}
+
+			for _, v := range m.Versions {
+				msg.Versions = append(msg.Versions, &messageVersion{Version: v.Version, Content: v.Content, CreatedAt: v.CreatedAt, PromptVersion: v.PromptVersion})
+			}
+
+			out.Messages = append(out.Messages, msg)
+		}
+
+		doc.Conversations = append(doc.Conversations, out)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+func decodeJSON(r io.Reader) ([]*model.Conversation, error) {
+	var doc document
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON export: %w", err)
+	}
+
+	if doc.Version != version {
+		return nil, fmt.Errorf("unsupported JSON export version %d", doc.Version)
+	}
+
+	var convs []*model.Conversation
+
+	for i, in := range doc.Conversations {
+		id, err := primitive.ObjectIDFromHex(in.ID)
+		if err != nil {
+			return nil, fmt.Errorf("conversation %d: invalid id %q", i, in.ID)
+		}
+
+		c := &model.Conversation{
+			ID:        id,
+			Title:     in.Title,
+			CreatedAt: in.CreatedAt,
+			UpdatedAt: in.UpdatedAt,
+			Pinned:    in.Pinned,
+			Persona:   in.Persona,
+		}
+
+		if in.Retention != "" {
+			if c.Retention, err = time.ParseDuration(in.Retention); err != nil {
+				return nil, fmt.Errorf("conversation %s: invalid retention %q", in.ID, in.Retention)
+			}
+		}
+
+		for _, ancestor := range in.Ancestors {
+			aid, err := primitive.ObjectIDFromHex(ancestor)
+			if err != nil {
+				return nil, fmt.Errorf("conversation %s: invalid ancestor %q", in.ID, ancestor)
+			}
+
+			c.Ancestors = append(c.Ancestors, aid)
+		}
+
+		if in.ForkedFrom != "" {
+			if c.ForkedFrom, err = primitive.ObjectIDFromHex(in.ForkedFrom); err != nil {
+				return nil, fmt.Errorf("conversation %s: invalid forked_from %q", in.ID, in.ForkedFrom)
+			}
+		}
+
+		for _, m := range in.Messages {
+			mid, err := primitive.ObjectIDFromHex(m.ID)
+			if err != nil {
+				return nil, fmt.Errorf("conversation %s: invalid message id %q", in.ID, m.ID)
+			}
+
+			if err := validateRole(m.Role); err != nil {
+				return nil, fmt.Errorf("conversation %s: %w", in.ID, err)
+			}
+
+			msg := &model.Message{
+				ID:            mid,
+				Role:          m.Role,
+				Content:       m.Content,
+				CreatedAt:     m.CreatedAt,
+				UpdatedAt:     m.UpdatedAt,
+				Version:       m.Version,
+				PromptVersion: m.PromptVersion,
+				Model:         m.Model,
+				Tools:         m.Tools,
+			}
+
+			for _, v := range m.Versions {
+				msg.Versions = append(msg.Versions, &model.MessageVersion{Version: v.Version, Content: v.Content, CreatedAt: v.CreatedAt, PromptVersion: v.PromptVersion})
+			}
+
+			c.Messages = append(c.Messages, msg)
+		}
+
+		convs = append(convs, c)
+	}
+
+	return convs, nil
+}
+
+func encodeMarkdown(w io.Writer, convs []*model.Conversation) error {
+	bw := bufio.NewWriter(w)
+
+	for i, c := range convs {
+		if i > 0 {
+			fmt.Fprint(bw, "\n---\n\n")
+		}
+
+		fmt.Fprintf(bw, "# %s\n\n", c.Title)
+		fmt.Fprintf(bw, "- ID: `%s`\n", c.ID.Hex())
+		fmt.Fprintf(bw, "- Started: %s\n", c.CreatedAt.UTC().Format(time.RFC1123))
+		fmt.Fprintf(bw, "- Updated: %s\n", c.UpdatedAt.UTC().Format(time.RFC1123))
+
+		for _, m := range c.Messages {
+			fmt.Fprintf(bw, "\n## %s, %s\n\n%s\n", roleTitle(m.Role), m.CreatedAt.UTC().Format(time.DateTime), m.Content)
+		}
+	}
+
+	return bw.Flush()
+}
+
+func roleTitle(r model.Role) string {
+	switch r {
+	case model.RoleUser:
+		return "User"
+	case model.RoleAssistant:
+		return "Assistant"
+	default:
+		return string(r)
+	}
+}
+
+func encodeJSONL(w io.Writer, convs []*model.Conversation) error {
+	enc := json.NewEncoder(w)
+
+	for _, c := range convs {
+		example := fineTuningExample{Messages: []fineTuningMessage{}}
+		for _, m := range c.Messages {
+			example.Messages = append(example.Messages, fineTuningMessage{Role: string(m.Role), Content: m.Content})
+		}
+
+		if err := enc.Encode(example); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func decodeJSONL(r io.Reader) ([]*model.Conversation, error) {
+	var convs []*model.Conversation
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	now := time.Now()
+
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		var example fineTuningExample
+		if err := json.Unmarshal(scanner.Bytes(), &example); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		c := &model.Conversation{
+			ID:        primitive.NewObjectID(),
+			Title:     "Imported conversation",
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+
+		titled := false
+
+		for _, m := range example.Messages {
+			// System prompts are not part of a conversation.
+			if m.Role == "system" {
+				continue
+			}
+
+			role := model.Role(m.Role)
+			if err := validateRole(role); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+
+			if role == model.RoleUser && !titled {
+				c.Title = titleFrom(m.Content)
+				titled = true
+			}
+
+			c.Messages = append(c.Messages, &model.Message{
+				ID:        primitive.NewObjectID(),
+				Role:      role,
+				Content:   m.Content,
+				CreatedAt: now,
+				UpdatedAt: now,
+			})
+		}
+
+		if len(c.Messages) == 0 {
+			return nil, fmt.Errorf("line %d: conversation has no messages", line)
+		}
+
+		convs = append(convs, c)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return convs, nil
+}
+
+func validateRole(r model.Role) error {
+	switch r {
+	case model.RoleUser, model.RoleAssistant:
+		return nil
+	default:
+		return fmt.Errorf("unsupported message role %q", r)
+	}
+}
+
+// titleFrom uses the first line of a message, cut to 80 characters, as title.
+func titleFrom(content string) string {
+	title, _, _ := strings.Cut(strings.TrimSpace(content), "\n")
+
+	if runes := []rune(title); len(runes) > 80 {
+		title = string(runes[:80])
+	}
+
+	return title
+}
@@ -0,0 +1,138 @@
+package export
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/acai-travel/tech-challenge/internal/chat/model"
+	"github.com/google/go-cmp/cmp"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func testConversation() *model.Conversation {
+	created := time.Date(2025, 8, 20, 10, 59, 7, 0, time.UTC)
+
+	return &model.Conversation{
+		ID:         primitive.NewObjectID(),
+		Title:      "Weather in Barcelona",
+		CreatedAt:  created,
+		UpdatedAt:  created.Add(time.Minute),
+		Pinned:     true,
+		Retention:  48 * time.Hour,
+		Persona:    "travel-agent",
+		Ancestors:  []primitive.ObjectID{primitive.NewObjectID()},
+		ForkedFrom: primitive.NewObjectID(),
+		Messages: []*model.Message{
+			{ID: primitive.NewObjectID(), Role: model.RoleUser, Content: "What is the weather like in Barcelona?", CreatedAt: created, UpdatedAt: created},
+			{ID: primitive.NewObjectID(), Role: model.RoleAssistant, Content: "Sunny, 25°C.", CreatedAt: created.Add(time.Minute), UpdatedAt: created.Add(2 * time.Minute),
+				Version: 2, Versions: []*model.MessageVersion{{Version: 1, Content: "Cloudy.", CreatedAt: created.Add(time.Minute)}}},
+		},
+	}
+}
+
+func TestJSON_RoundTrip(t *testing.T) {
+	c := testConversation()
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, FormatJSON, c); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	got, err := Decode(&buf, FormatJSON)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	if diff := cmp.Diff([]*model.Conversation{c}, got); diff != "" {
+		t.Errorf("round trip mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestJSON_Decode_InvalidVersion(t *testing.T) {
+	_, err := Decode(strings.NewReader(`{"version": 2, "conversations": []}`), FormatJSON)
+	if err == nil || !strings.Contains(err.Error(), "version") {
+		t.Errorf("expected version error, got %v", err)
+	}
+}
+
+func TestMarkdown_Encode(t *testing.T) {
+	c := testConversation()
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, FormatMarkdown, c); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	for _, want := range []string{
+		"# Weather in Barcelona\n",
+		"- ID: `" + c.ID.Hex() + "`\n",
+		"## User, 2025-08-20 10:59:07\n\nWhat is the weather like in Barcelona?\n",
+		"## Assistant, 2025-08-20 11:00:07\n\nSunny, 25°C.\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected transcript to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+
+	if _, err := Decode(&buf, FormatMarkdown); err == nil {
+		t.Error("expected Markdown import to fail")
+	}
+}
+
+func TestJSONL_RoundTrip(t *testing.T) {
+	c := testConversation()
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, FormatJSONL, c, c); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	want := `{"messages":[{"role":"user","content":"What is the weather like in Barcelona?"},{"role":"assistant","content":"Sunny, 25°C."}]}`
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 2 || lines[0] != want {
+		t.Fatalf("unexpected JSONL output:\n%s", buf.String())
+	}
+
+	got, err := Decode(&buf, FormatJSONL)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("expected 2 conversations, got %d", len(got))
+	}
+
+	if got[0].ID == got[1].ID || got[0].ID == c.ID {
+		t.Error("expected imported conversations to get new IDs")
+	}
+
+	if got[0].Title != "What is the weather like in Barcelona?" {
+		t.Errorf("expected title from first user message, got %q", got[0].Title)
+	}
+
+	if len(got[0].Messages) != 2 || got[0].Messages[1].Content != "Sunny, 25°C." {
+		t.Errorf("unexpected messages: %v", got[0].Messages)
+	}
+}
+
+func TestJSONL_Decode_SkipsSystemPrompt(t *testing.T) {
+	in := `{"messages":[{"role":"system","content":"Be nice"},{"role":"user","content":"Hi"},{"role":"assistant","content":"Hello"}]}`
+
+	got, err := Decode(strings.NewReader(in), FormatJSONL)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	if len(got) != 1 || len(got[0].Messages) != 2 {
+		t.Fatalf("expected one conversation with 2 messages, got %v", got)
+	}
+}
+
+func TestJSONL_Decode_InvalidRole(t *testing.T) {
+	in := `{"messages":[{"role":"tool","content":"{}"}]}`
+
+	if _, err := Decode(strings.NewReader(in), FormatJSONL); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("expected error on line 1, got %v", err)
+	}
+}
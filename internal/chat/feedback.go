@@ -0,0 +1,84 @@
+package chat
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/acai-travel/tech-challenge/internal/auth"
+	"github.com/acai-travel/tech-challenge/internal/chat/model"
+	"github.com/acai-travel/tech-challenge/internal/metrics"
+	"github.com/acai-travel/tech-challenge/internal/pb"
+	"github.com/twitchtv/twirp"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxFeedbackComment is the length of a feedback comment, in characters.
+const maxFeedbackComment = 2000
+
+func (s *Server) SubmitFeedback(ctx context.Context, req *pb.SubmitFeedbackRequest) (*pb.SubmitFeedbackResponse, error) {
+	if req.GetConversationId() == "" {
+		return nil, twirp.RequiredArgumentError("conversation_id")
+	}
+
+	if req.GetMessageId() == "" {
+		return nil, twirp.RequiredArgumentError("message_id")
+	}
+
+	rating := model.RatingFromProto(req.GetRating())
+	if rating == "" {
+		return nil, twirp.RequiredArgumentError("rating")
+	}
+
+	if req.GetCategory() != "" && !slices.Contains(model.FeedbackCategories, req.GetCategory()) {
+		return nil, twirp.InvalidArgumentError("category", "must be one of "+strings.Join(model.FeedbackCategories, ", "))
+	}
+
+	comment := strings.TrimSpace(req.GetComment())
+	if utf8.RuneCountInString(comment) > maxFeedbackComment {
+		return nil, twirp.InvalidArgumentError("comment", "must be at most 2000 characters")
+	}
+
+	conversation, err := s.repo.DescribeConversation(ctx, req.GetConversationId())
+	if err != nil {
+		return nil, err
+	}
+
+	i := slices.IndexFunc(conversation.Messages, func(m *model.Message) bool {
+		return m.ID.Hex() == req.GetMessageId()
+	})
+
+	if i < 0 {
+		return nil, twirp.NotFoundError("message not found")
+	}
+
+	msg := conversation.Messages[i]
+	if msg.Role != model.RoleAssistant {
+		return nil, twirp.InvalidArgumentError("message_id", "only replies can be rated")
+	}
+
+	feedback := &model.Feedback{
+		ID:             primitive.NewObjectID(),
+		ConversationID: conversation.ID,
+		MessageID:      msg.ID,
+		Owner:          auth.UserID(ctx),
+		Rating:         rating,
+		Category:       req.GetCategory(),
+		Comment:        comment,
+		MessageVersion: msg.CurrentVersion(),
+		Model:          msg.Model,
+		Tools:          msg.Tools,
+		PromptVersion:  msg.PromptVersion,
+		CreatedAt:      time.Now(),
+	}
+
+	if err := s.repo.SaveFeedback(ctx, feedback); err != nil {
+		return nil, twirp.InternalErrorWith(err)
+	}
+
+	metrics.RecordFeedback(string(rating), msg.Model, msg.Tools)
+
+	return &pb.SubmitFeedbackResponse{Feedback: feedback.Proto()}, nil
+}
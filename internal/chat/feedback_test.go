@@ -0,0 +1,118 @@
+package chat
+
+import (
+	"context"
+	"testing"
+
+	"github.com/acai-travel/tech-challenge/internal/chat/model"
+	. "github.com/acai-travel/tech-challenge/internal/chat/testing"
+	"github.com/acai-travel/tech-challenge/internal/metrics"
+	"github.com/acai-travel/tech-challenge/internal/pb"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/twitchtv/twirp"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestServer_SubmitFeedback(t *testing.T) {
+	ctx := context.Background()
+
+	// withRatedReply makes the last message a reply that called tools.
+	withRatedReply := func(c *model.Conversation) {
+		withTurns(c)
+		reply := c.Messages[len(c.Messages)-1]
+		reply.Model = "gpt-test"
+		reply.Tools = []string{"get_weather"}
+		reply.PromptVersion = "reply@test"
+	}
+
+	cleanup := func(t *testing.T, c *model.Conversation) {
+		t.Cleanup(func() {
+			_, _ = ConnectMongo().Collection("feedback").DeleteMany(ctx, bson.M{"conversation_id": c.ID})
+		})
+	}
+
+	t.Run("submit feedback replaces earlier feedback", WithFixture(func(t *testing.T, f *Fixture) {
+		c := f.CreateConversation(withRatedReply)
+		cleanup(t, c)
+		srv := NewServer(model.New(ConnectMongo()), &MockAssistant{})
+		reply := c.Messages[len(c.Messages)-1]
+
+		down := testutil.ToFloat64(metrics.FeedbackTotal.WithLabelValues("down", "gpt-test"))
+		downTool := testutil.ToFloat64(metrics.FeedbackToolsTotal.WithLabelValues("down", "get_weather"))
+
+		first, err := srv.SubmitFeedback(ctx, &pb.SubmitFeedbackRequest{
+			ConversationId: c.ID.Hex(),
+			MessageId:      reply.ID.Hex(),
+			Rating:         pb.Feedback_UP,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		second, err := srv.SubmitFeedback(ctx, &pb.SubmitFeedbackRequest{
+			ConversationId: c.ID.Hex(),
+			MessageId:      reply.ID.Hex(),
+			Rating:         pb.Feedback_DOWN,
+			Category:       "inaccurate",
+			Comment:        "  It was sunny.  ",
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		got := second.GetFeedback()
+		if got.GetId() != first.GetFeedback().GetId() {
+			t.Errorf("expected the feedback to be replaced, got IDs %s and %s", first.GetFeedback().GetId(), got.GetId())
+		}
+
+		if got.GetRating() != pb.Feedback_DOWN || got.GetCategory() != "inaccurate" || got.GetComment() != "It was sunny." {
+			t.Errorf("unexpected feedback: %v", got)
+		}
+
+		if got.GetModel() != "gpt-test" || len(got.GetTools()) != 1 || got.GetPromptVersion() != "reply@test" || got.GetMessageVersion() != 1 {
+			t.Errorf("expected how the reply was generated, got %v", got)
+		}
+
+		n, err := ConnectMongo().Collection("feedback").CountDocuments(ctx, bson.M{"message_id": reply.ID})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if n != 1 {
+			t.Errorf("expected 1 feedback stored, got %d", n)
+		}
+
+		if got := testutil.ToFloat64(metrics.FeedbackTotal.WithLabelValues("down", "gpt-test")) - down; got != 1 {
+			t.Errorf("expected 1 down rating counted for the model, got %v", got)
+		}
+		if got := testutil.ToFloat64(metrics.FeedbackToolsTotal.WithLabelValues("down", "get_weather")) - downTool; got != 1 {
+			t.Errorf("expected 1 down rating counted for the tool, got %v", got)
+		}
+	}))
+
+	t.Run("invalid feedback should fail", WithFixture(func(t *testing.T, f *Fixture) {
+		c := f.CreateConversation(withRatedReply)
+		srv := NewServer(model.New(ConnectMongo()), &MockAssistant{})
+		reply := c.Messages[len(c.Messages)-1].ID.Hex()
+
+		tests := []struct {
+			name string
+			req  *pb.SubmitFeedbackRequest
+			code twirp.ErrorCode
+		}{
+			{"missing rating", &pb.SubmitFeedbackRequest{ConversationId: c.ID.Hex(), MessageId: reply}, twirp.InvalidArgument},
+			{"unknown category", &pb.SubmitFeedbackRequest{ConversationId: c.ID.Hex(), MessageId: reply, Rating: pb.Feedback_UP, Category: "great"}, twirp.InvalidArgument},
+			{"user message", &pb.SubmitFeedbackRequest{ConversationId: c.ID.Hex(), MessageId: c.Messages[0].ID.Hex(), Rating: pb.Feedback_UP}, twirp.InvalidArgument},
+			{"unknown message", &pb.SubmitFeedbackRequest{ConversationId: c.ID.Hex(), MessageId: c.ID.Hex(), Rating: pb.Feedback_UP}, twirp.NotFound},
+			{"unknown conversation", &pb.SubmitFeedbackRequest{ConversationId: reply, MessageId: reply, Rating: pb.Feedback_UP}, twirp.NotFound},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := srv.SubmitFeedback(ctx, tt.req)
+				if te, ok := err.(twirp.Error); !ok || te.Code() != tt.code {
+					t.Fatalf("expected twirp.%s error, got %v", tt.code, err)
+				}
+			})
+		}
+	}))
+}
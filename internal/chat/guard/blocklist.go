@@ -0,0 +1,69 @@
+package guard
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Blocklist blocks user messages and replies containing any of its terms, as
+// whole words, ignoring case.
+type Blocklist struct {
+	pattern *regexp.Regexp
+}
+
+// NewBlocklist creates a blocklist of terms, which may be phrases. An empty
+// blocklist blocks nothing.
+func NewBlocklist(terms ...string) *Blocklist {
+	var quoted []string
+	for _, t := range terms {
+		if t = strings.TrimSpace(t); t != "" {
+			quoted = append(quoted, regexp.QuoteMeta(t))
+		}
+	}
+
+	if len(quoted) == 0 {
+		return &Blocklist{}
+	}
+
+	return &Blocklist{pattern: regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)}
+}
+
+// ReadBlocklist reads a term per line, skipping blank lines and # comments.
+func ReadBlocklist(r io.Reader) (*Blocklist, error) {
+	var terms []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		terms = append(terms, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return NewBlocklist(terms...), nil
+}
+
+func (b *Blocklist) Name() string {
+	return "blocklist"
+}
+
+func (b *Blocklist) Check(ctx context.Context, stage Stage, text string) (Result, error) {
+	res := Result{Text: text}
+	if stage == StageTool || b.pattern == nil {
+		return res, nil
+	}
+
+	// The term is not reported, so as not to spread it to logs and metrics.
+	if b.pattern.MatchString(text) {
+		res.Findings = append(res.Findings, Finding{Kind: "term", Action: ActionBlocked})
+	}
+
+	return res, nil
+}
@@ -0,0 +1,145 @@
+// Package guard screens the content flowing through the assistant: user
+// messages before they are stored or sent to OpenAI, tool results before the
+// model reads them and replies before the user does. Checks redact what must
+// not be kept, such as personal data, or block the content altogether.
+package guard
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/acai-travel/tech-challenge/internal/config"
+	"github.com/acai-travel/tech-challenge/internal/errs"
+	"github.com/acai-travel/tech-challenge/internal/metrics"
+)
+
+// Stage is where content is screened.
+type Stage string
+
+const (
+	// StageInput is a user message.
+	StageInput Stage = "input"
+	// StageTool is the result of a tool call.
+	StageTool Stage = "tool"
+	// StageOutput is a reply of the assistant.
+	StageOutput Stage = "output"
+)
+
+// Action is what a check did about a finding.
+type Action string
+
+const (
+	ActionRedacted Action = "redacted"
+	ActionBlocked  Action = "blocked"
+)
+
+// Finding is something a check found, e.g. an email address.
+type Finding struct {
+	Kind   string
+	Action Action
+}
+
+// Result is the content after a check, redacted if need be, with what the
+// check found in it.
+type Result struct {
+	Text     string
+	Findings []Finding
+}
+
+func (r Result) blocked() (Finding, bool) {
+	for _, f := range r.Findings {
+		if f.Action == ActionBlocked {
+			return f, true
+		}
+	}
+	return Finding{}, false
+}
+
+// Check screens content. Checks return the text unchanged at stages they do
+// not apply to.
+type Check interface {
+	Name() string
+	Check(ctx context.Context, stage Stage, text string) (Result, error)
+}
+
+// Pipeline runs checks in order, each on the text redacted by the previous ones.
+// A nil pipeline lets everything through.
+type Pipeline struct {
+	checks []Check
+}
+
+func NewPipeline(checks ...Check) *Pipeline {
+	return &Pipeline{checks: checks}
+}
+
+// New creates the pipeline of the checks enabled in cfg. Moderation calls the
+// OpenAI API configured in openaiCfg.
+func New(cfg config.Guardrails, openaiCfg config.OpenAI) (*Pipeline, error) {
+	var checks []Check
+	if cfg.PII {
+		checks = append(checks, PII{})
+	}
+
+	if cfg.BlocklistFile != "" {
+		f, err := os.Open(cfg.BlocklistFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		blocklist, err := ReadBlocklist(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", cfg.BlocklistFile, err)
+		}
+		checks = append(checks, blocklist)
+	}
+
+	if cfg.Injection {
+		checks = append(checks, Injection{})
+	}
+
+	// Moderation comes last so that personal data is redacted before it is sent.
+	if cfg.Moderation {
+		checks = append(checks, NewModeration(openaiCfg, cfg.ModerationModel))
+	}
+
+	return NewPipeline(checks...), nil
+}
+
+// Run screens text at stage, returning it redacted, or a blocked error when a
+// check refuses it. Checks that fail are logged and skipped, so that an outage
+// of the moderation API does not take the assistant down. Findings are logged
+// and counted, without the content.
+func (p *Pipeline) Run(ctx context.Context, stage Stage, text string) (string, error) {
+	if p == nil {
+		return text, nil
+	}
+
+	for _, c := range p.checks {
+		res, err := c.Check(ctx, stage, text)
+		if err != nil {
+			slog.WarnContext(ctx, "Guardrail check failed", "stage", stage, "check", c.Name(), "error", err)
+			metrics.RecordGuardrail(string(stage), c.Name(), "none", "error")
+			continue
+		}
+
+		for _, f := range res.Findings {
+			metrics.RecordGuardrail(string(stage), c.Name(), f.Kind, string(f.Action))
+		}
+
+		if f, ok := res.blocked(); ok {
+			slog.WarnContext(ctx, "Guardrail blocked content", "stage", stage, "check", c.Name(), "kind", f.Kind)
+			return "", errs.Blocked(fmt.Sprintf("blocked by the %s guardrail (%s)", c.Name(), f.Kind))
+		}
+
+		if len(res.Findings) > 0 {
+			slog.InfoContext(ctx, "Guardrail redacted content", "stage", stage, "check", c.Name(), "findings", len(res.Findings))
+		}
+
+		text = res.Text
+	}
+
+	return text, nil
+}
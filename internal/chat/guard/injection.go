@@ -0,0 +1,44 @@
+package guard
+
+import (
+	"context"
+	"regexp"
+)
+
+// injectionPatterns are phrases tool results have no reason to contain, but
+// that text planted in a web page or calendar may use to take over the model.
+var injectionPatterns = []struct {
+	kind    string
+	pattern *regexp.Regexp
+}{
+	{"override", regexp.MustCompile(`(?i)\b(?:ignore|disregard|forget|override)\b.{0,40}\b(?:previous|prior|above|earlier|all|your|system)\b.{0,20}\b(?:instructions?|prompts?|rules|directions)\b`)},
+	{"new_instructions", regexp.MustCompile(`(?i)\b(?:new|updated|additional)\s+(?:system\s+)?instructions?\s*:`)},
+	{"role", regexp.MustCompile(`(?i)\byou\s+are\s+now\b|\bfrom\s+now\s+on,?\s+you\b|\bact\s+as\s+(?:an?\s+)?(?:unrestricted|jailbroken|different)\b`)},
+	{"prompt_leak", regexp.MustCompile(`(?i)\b(?:reveal|print|repeat|show)\b.{0,20}\b(?:system\s+prompt|your\s+instructions)\b`)},
+	{"secrecy", regexp.MustCompile(`(?i)\b(?:do\s+not|don't|never)\s+(?:tell|inform|mention\s+(?:this\s+)?to)\s+the\s+user\b`)},
+	{"markup", regexp.MustCompile(`(?im)<\|(?:im_start|im_end|system|endoftext)\|>|\[/?(?:INST|SYS)\]|<<SYS>>|^\s*#{2,}\s*(?:system|instruction)`)},
+}
+
+// Injection blocks tool results that look like prompt injection, so that the
+// model gets an error instead of instructions it should not follow.
+type Injection struct{}
+
+func (Injection) Name() string {
+	return "injection"
+}
+
+func (Injection) Check(ctx context.Context, stage Stage, text string) (Result, error) {
+	res := Result{Text: text}
+	if stage != StageTool {
+		return res, nil
+	}
+
+	for _, p := range injectionPatterns {
+		if p.pattern.MatchString(text) {
+			res.Findings = append(res.Findings, Finding{Kind: p.kind, Action: ActionBlocked})
+			break
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,82 @@
+package guard
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+
+	"github.com/acai-travel/tech-challenge/internal/config"
+	"github.com/openai/openai-go/v2"
+	"github.com/openai/openai-go/v2/option"
+)
+
+// Moderation blocks user messages the OpenAI moderation API flags, e.g. as
+// harassment.
+type Moderation struct {
+	cli   openai.Client
+	model string
+}
+
+func NewModeration(cfg config.OpenAI, model string) *Moderation {
+	var opts []option.RequestOption
+	if cfg.APIKey != "" {
+		opts = append(opts, option.WithAPIKey(cfg.APIKey))
+	}
+	if cfg.BaseURL != "" {
+		opts = append(opts, option.WithBaseURL(cfg.BaseURL))
+	}
+
+	return &Moderation{cli: openai.NewClient(opts...), model: model}
+}
+
+func (m *Moderation) Name() string {
+	return "moderation"
+}
+
+func (m *Moderation) Check(ctx context.Context, stage Stage, text string) (Result, error) {
+	res := Result{Text: text}
+	if stage != StageInput {
+		return res, nil
+	}
+
+	resp, err := m.cli.Moderations.New(ctx, openai.ModerationNewParams{
+		Input: openai.ModerationNewParamsInputUnion{OfString: openai.String(text)},
+		Model: openai.ModerationModel(m.model),
+	})
+	if err != nil {
+		return res, err
+	}
+
+	for _, r := range resp.Results {
+		if !r.Flagged {
+			continue
+		}
+
+		res.Findings = append(res.Findings, Finding{Kind: flaggedCategory(r), Action: ActionBlocked})
+		break
+	}
+
+	return res, nil
+}
+
+// flaggedCategory names the first flagged category, in alphabetical order.
+func flaggedCategory(r openai.Moderation) string {
+	var categories map[string]bool
+	if err := json.Unmarshal([]byte(r.Categories.RawJSON()), &categories); err != nil {
+		return "flagged"
+	}
+
+	var flagged []string
+	for name, ok := range categories {
+		if ok {
+			flagged = append(flagged, name)
+		}
+	}
+
+	if len(flagged) == 0 {
+		return "flagged"
+	}
+
+	slices.Sort(flagged)
+	return flagged[0]
+}
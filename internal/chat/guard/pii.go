@@ -0,0 +1,105 @@
+package guard
+
+import (
+	"context"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)
+	ibanPattern  = regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,3})?\b`)
+	// Passport numbers have no common format, so only those introduced as
+	// such are found, rather than every flight number and booking reference.
+	passportPattern = regexp.MustCompile(`(?i)(passport(?:\s+(?:no\.?|number|#))?\s*[:#]?\s*)([A-Z0-9]{6,9})\b`)
+	phonePattern    = regexp.MustCompile(`(?:\+|\(|\b)\d[\d ().-]{6,}\d\b`)
+	usPhonePattern  = regexp.MustCompile(`^\d{3}[-. ]\d{3}[-. ]\d{4}$`)
+)
+
+// PII redacts email addresses, phone numbers, IBANs and passport numbers at
+// every stage, replacing them with placeholders such as [EMAIL].
+type PII struct{}
+
+func (PII) Name() string {
+	return "pii"
+}
+
+func (PII) Check(ctx context.Context, stage Stage, text string) (Result, error) {
+	var findings []Finding
+	redact := func(kind, placeholder string) func(string) string {
+		return func(string) string {
+			findings = append(findings, Finding{Kind: kind, Action: ActionRedacted})
+			return placeholder
+		}
+	}
+
+	text = emailPattern.ReplaceAllStringFunc(text, redact("email", "[EMAIL]"))
+
+	text = ibanPattern.ReplaceAllStringFunc(text, func(s string) string {
+		if !validIBAN(s) {
+			return s
+		}
+		return redact("iban", "[IBAN]")(s)
+	})
+
+	text = passportPattern.ReplaceAllStringFunc(text, func(s string) string {
+		m := passportPattern.FindStringSubmatch(s)
+		// A number is needed, not just a word such as "passport number please".
+		if !strings.ContainsAny(m[2], "0123456789") {
+			return s
+		}
+		return m[1] + redact("passport", "[PASSPORT]")(m[2])
+	})
+
+	text = phonePattern.ReplaceAllStringFunc(text, func(s string) string {
+		if !phoneNumber(s) {
+			return s
+		}
+		return redact("phone", "[PHONE]")(s)
+	})
+
+	return Result{Text: text, Findings: findings}, nil
+}
+
+// phoneNumber tells phone numbers from other digit runs, such as dates: they
+// have 9 to 15 digits and are international (+49 …), national (069 …, (069) …)
+// or in the US format (555-123-4567).
+func phoneNumber(s string) bool {
+	digits := 0
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			digits++
+		}
+	}
+
+	if digits < 9 || digits > 15 {
+		return false
+	}
+
+	return s[0] == '+' || s[0] == '(' || s[0] == '0' || usPhonePattern.MatchString(s)
+}
+
+// validIBAN checks the mod 97 checksum of an IBAN.
+func validIBAN(s string) bool {
+	s = strings.ReplaceAll(s, " ", "")
+	if len(s) < 15 || len(s) > 34 {
+		return false
+	}
+
+	var digits strings.Builder
+	for _, r := range s[4:] + s[:4] {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r >= 'A' && r <= 'Z':
+			digits.WriteString(strconv.Itoa(int(r - 'A' + 10)))
+		default:
+			return false
+		}
+	}
+
+	n, ok := new(big.Int).SetString(digits.String(), 10)
+	return ok && new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
@@ -0,0 +1,34 @@
+package chat
+
+import (
+	"context"
+
+	"github.com/acai-travel/tech-challenge/internal/pb"
+	"github.com/twitchtv/twirp"
+)
+
+func (s *Server) ListMemories(ctx context.Context, req *pb.ListMemoriesRequest) (*pb.ListMemoriesResponse, error) {
+	memories, err := s.repo.ListMemories(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.ListMemoriesResponse{}
+	for _, m := range memories {
+		resp.Memories = append(resp.Memories, m.Proto())
+	}
+
+	return resp, nil
+}
+
+func (s *Server) DeleteMemory(ctx context.Context, req *pb.DeleteMemoryRequest) (*pb.DeleteMemoryResponse, error) {
+	if req.GetMemoryId() == "" {
+		return nil, twirp.RequiredArgumentError("memory_id")
+	}
+
+	if err := s.repo.DeleteMemory(ctx, req.GetMemoryId()); err != nil {
+		return nil, err
+	}
+
+	return &pb.DeleteMemoryResponse{}, nil
+}
@@ -0,0 +1,160 @@
+package chat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/acai-travel/tech-challenge/internal/auth"
+	"github.com/acai-travel/tech-challenge/internal/chat/model"
+	. "github.com/acai-travel/tech-challenge/internal/chat/testing"
+	"github.com/acai-travel/tech-challenge/internal/pb"
+	"github.com/google/uuid"
+	"github.com/twitchtv/twirp"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestServer_Memories(t *testing.T) {
+	ctx := context.Background()
+
+	// user returns the context of a new user, whose memories are removed after
+	// the test.
+	user := func(t *testing.T) context.Context {
+		id := "rememberer-" + uuid.NewString()
+		t.Cleanup(func() {
+			_, _ = ConnectMongo().Collection("memories").DeleteMany(ctx, bson.M{"owner": id})
+		})
+		return auth.WithPrincipal(ctx, &auth.Principal{UserID: id})
+	}
+
+	remember := func(t *testing.T, ctx context.Context, repo *model.Repository, content string, at time.Time) *model.Memory {
+		t.Helper()
+		m := &model.Memory{ID: primitive.NewObjectID(), Owner: auth.UserID(ctx), Content: content, CreatedAt: at, UpdatedAt: at}
+		if err := repo.SaveMemory(ctx, m); err != nil {
+			t.Fatalf("SaveMemory() error = %v", err)
+		}
+		return m
+	}
+
+	t.Run("recall ranks memories by shared words, then recency", WithFixture(func(t *testing.T, f *Fixture) {
+		ctx := user(t)
+		repo := model.New(ConnectMongo())
+		now := time.Now()
+
+		remember(t, ctx, repo, "Home airport is EDDF", now.Add(-3*time.Hour))
+		remember(t, ctx, repo, "Prefers Celsius", now.Add(-2*time.Hour))
+		remember(t, ctx, repo, "Travels with a dog", now.Add(-time.Hour))
+
+		memories, err := repo.RecallMemories(ctx, "Flights from my airport?", 2)
+		if err != nil {
+			t.Fatalf("RecallMemories() error = %v", err)
+		}
+
+		if len(memories) != 2 || memories[0].Content != "Home airport is EDDF" || memories[1].Content != "Travels with a dog" {
+			t.Errorf("expected the airport then the latest memory, got %v", memories)
+		}
+	}))
+
+	t.Run("remembering a fact again refreshes it", WithFixture(func(t *testing.T, f *Fixture) {
+		ctx := user(t)
+		repo := model.New(ConnectMongo())
+		now := time.Now()
+
+		first := remember(t, ctx, repo, "Prefers Celsius", now.Add(-time.Hour))
+		remember(t, ctx, repo, "Home airport is EDDF", now.Add(-time.Minute))
+		again := remember(t, ctx, repo, "prefers celsius", now)
+
+		if again.ID != first.ID {
+			t.Errorf("expected the memory to keep its ID %s, got %s", first.ID.Hex(), again.ID.Hex())
+		}
+
+		memories, err := repo.ListMemories(ctx)
+		if err != nil {
+			t.Fatalf("ListMemories() error = %v", err)
+		}
+
+		if len(memories) != 2 || memories[0].Content != "Prefers Celsius" {
+			t.Errorf("expected the refreshed memory first, got %v", memories)
+		}
+	}))
+
+	t.Run("users list and delete their own memories", WithFixture(func(t *testing.T, f *Fixture) {
+		alice, bob := user(t), user(t)
+		repo := model.New(ConnectMongo())
+		srv := NewServer(repo, &MockAssistant{})
+
+		m := remember(t, alice, repo, "Home airport is EDDF", time.Now())
+
+		resp, err := srv.ListMemories(bob, &pb.ListMemoriesRequest{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(resp.GetMemories()) != 0 {
+			t.Errorf("expected bob to have no memories, got %v", resp.GetMemories())
+		}
+
+		_, err = srv.DeleteMemory(bob, &pb.DeleteMemoryRequest{MemoryId: m.ID.Hex()})
+		if te, ok := err.(twirp.Error); !ok || te.Code() != twirp.NotFound {
+			t.Errorf("expected bob not to find alice's memory, got %v", err)
+		}
+
+		resp, err = srv.ListMemories(alice, &pb.ListMemoriesRequest{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(resp.GetMemories()) != 1 || resp.GetMemories()[0].GetContent() != "Home airport is EDDF" {
+			t.Fatalf("expected alice's memory, got %v", resp.GetMemories())
+		}
+
+		if _, err := srv.DeleteMemory(alice, &pb.DeleteMemoryRequest{MemoryId: m.ID.Hex()}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		resp, err = srv.ListMemories(alice, &pb.ListMemoriesRequest{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(resp.GetMemories()) != 0 {
+			t.Errorf("expected the memory to be deleted, got %v", resp.GetMemories())
+		}
+	}))
+
+	t.Run("anonymous callers have no memories", WithFixture(func(t *testing.T, f *Fixture) {
+		repo := model.New(ConnectMongo())
+		srv := NewServer(repo, &MockAssistant{})
+		now := time.Now()
+
+		denied := func(t *testing.T, name string, err error) {
+			t.Helper()
+			if te, ok := err.(twirp.Error); !ok || te.Code() != twirp.PermissionDenied {
+				t.Errorf("%s: expected permission denied, got %v", name, err)
+			}
+		}
+
+		err := repo.SaveMemory(ctx, &model.Memory{ID: primitive.NewObjectID(), Content: "Home airport is EDDF", CreatedAt: now, UpdatedAt: now})
+		denied(t, "SaveMemory", err)
+
+		_, err = repo.RecallMemories(ctx, "Flights from my airport?", 10)
+		denied(t, "RecallMemories", err)
+
+		_, err = srv.ListMemories(ctx, &pb.ListMemoriesRequest{})
+		denied(t, "ListMemories", err)
+
+		_, err = srv.DeleteMemory(ctx, &pb.DeleteMemoryRequest{MemoryId: primitive.NewObjectID().Hex()})
+		denied(t, "DeleteMemory", err)
+
+		if n, err := ConnectMongo().Collection("memories").CountDocuments(ctx, bson.M{"owner": bson.M{"$exists": false}}); err != nil || n != 0 {
+			t.Errorf("expected no memory without an owner, got %d, %v", n, err)
+		}
+	}))
+
+	t.Run("delete memory requires an ID", WithFixture(func(t *testing.T, f *Fixture) {
+		srv := NewServer(model.New(ConnectMongo()), &MockAssistant{})
+
+		_, err := srv.DeleteMemory(ctx, &pb.DeleteMemoryRequest{})
+		if te, ok := err.(twirp.Error); !ok || te.Code() != twirp.InvalidArgument {
+			t.Errorf("expected invalid argument, got %v", err)
+		}
+	}))
+}
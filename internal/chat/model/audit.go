@@ -0,0 +1,219 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/acai-travel/tech-challenge/internal/pb"
+	"github.com/twitchtv/twirp"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	auditCollection = "audit"
+
+	// DefaultAuditPageSize is the number of audit events returned by a page
+	// without a size.
+	DefaultAuditPageSize = 100
+	// AuditExportPageSize is the number of audit events exported at once.
+	AuditExportPageSize = 5000
+)
+
+type AuditAction string
+
+const (
+	AuditStart      AuditAction = "start"
+	AuditContinue   AuditAction = "continue"
+	AuditEdit       AuditAction = "edit"
+	AuditRegenerate AuditAction = "regenerate"
+	AuditFork       AuditAction = "fork"
+	AuditPin        AuditAction = "pin"
+	AuditDelete     AuditAction = "delete"
+	AuditImport     AuditAction = "import"
+	AuditDescribe   AuditAction = "describe"
+	AuditList       AuditAction = "list"
+	AuditSearch     AuditAction = "search"
+	AuditExport     AuditAction = "export"
+	// AuditLogList and AuditLogExport record reads of the audit log itself,
+	// including those denied to non-admins.
+	AuditLogList   AuditAction = "audit_list"
+	AuditLogExport AuditAction = "audit_export"
+)
+
+// AuditActions are the actions audit events are recorded for.
+var AuditActions = []AuditAction{
+	AuditStart, AuditContinue, AuditEdit, AuditRegenerate, AuditFork, AuditPin, AuditDelete, AuditImport,
+	AuditDescribe, AuditList, AuditSearch, AuditExport, AuditLogList, AuditLogExport,
+}
+
+// AuditOutcomeOK is the outcome of a successful call, failed calls have the
+// Twirp error code as outcome.
+const AuditOutcomeOK = "ok"
+
+// AuditEvent records who accessed or changed which conversation, and whether
+// they succeeded. The conversation ID is kept as sent, as it may not be valid.
+type AuditEvent struct {
+	ID             primitive.ObjectID `bson:"_id" json:"id"`
+	Timestamp      time.Time          `bson:"timestamp" json:"timestamp"`
+	UserID         string             `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	KeyID          string             `bson:"key_id,omitempty" json:"key_id,omitempty"`
+	Action         AuditAction        `bson:"action" json:"action"`
+	ConversationID string             `bson:"conversation_id,omitempty" json:"conversation_id,omitempty"`
+	ClientIP       string             `bson:"client_ip,omitempty" json:"client_ip,omitempty"`
+	Outcome        string             `bson:"outcome" json:"outcome"`
+	RequestID      string             `bson:"request_id,omitempty" json:"request_id,omitempty"`
+}
+
+func (e *AuditEvent) Proto() *pb.AuditEvent {
+	return &pb.AuditEvent{
+		Id:             e.ID.Hex(),
+		Timestamp:      timestamppb.New(e.Timestamp),
+		UserId:         e.UserID,
+		KeyId:          e.KeyID,
+		Action:         string(e.Action),
+		ConversationId: e.ConversationID,
+		ClientIp:       e.ClientIP,
+		Outcome:        e.Outcome,
+		RequestId:      e.RequestID,
+	}
+}
+
+// AuditFilter selects the audit events matching every field set. From and To
+// restrict events to that range.
+type AuditFilter struct {
+	UserID         string
+	Action         AuditAction
+	ConversationID string
+	Outcome        string
+	From           time.Time
+	To             time.Time
+}
+
+func (f AuditFilter) bson() bson.M {
+	filter := bson.M{}
+
+	if f.UserID != "" {
+		filter["user_id"] = f.UserID
+	}
+
+	if f.Action != "" {
+		filter["action"] = f.Action
+	}
+
+	if f.ConversationID != "" {
+		filter["conversation_id"] = f.ConversationID
+	}
+
+	if f.Outcome != "" {
+		filter["outcome"] = f.Outcome
+	}
+
+	timestamp := bson.M{}
+	if !f.From.IsZero() {
+		timestamp["$gte"] = f.From
+	}
+	if !f.To.IsZero() {
+		timestamp["$lt"] = f.To
+	}
+	if len(timestamp) > 0 {
+		filter["timestamp"] = timestamp
+	}
+
+	return filter
+}
+
+// AuditPage selects a page of audit events, newest first. A zero Size returns
+// DefaultAuditPageSize events.
+type AuditPage struct {
+	Size  int
+	Token string
+}
+
+// SetupAuditIndexes creates the indexes used to list audit events by time,
+// user and conversation.
+func (r *Repository) SetupAuditIndexes(ctx context.Context) error {
+	_, err := r.conn.Collection(auditCollection).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "timestamp", Value: -1}}},
+		{Keys: bson.D{{Key: "conversation_id", Value: 1}, {Key: "timestamp", Value: -1}}},
+	})
+	return err
+}
+
+// RecordAudit appends an event to the audit log. The repository never updates
+// or deletes audit events, retention neither, but nothing in the database
+// prevents it: that takes a MongoDB user with no other write access to the
+// collection.
+func (r *Repository) RecordAudit(ctx context.Context, e *AuditEvent) error {
+	_, err := r.conn.Collection(auditCollection).InsertOne(ctx, e)
+	return err
+}
+
+// ListAuditEvents returns a page of the audit events matching the filter,
+// newest first, along with the token of the next page or an empty string if
+// there are no more events.
+func (r *Repository) ListAuditEvents(ctx context.Context, f AuditFilter, page AuditPage) ([]*AuditEvent, string, error) {
+	size := page.Size
+	if size <= 0 {
+		size = DefaultAuditPageSize
+	}
+
+	return r.auditPage(ctx, f, page.Token, min(size, MaxPageSize), -1)
+}
+
+// ExportAuditEvents returns a page of AuditExportPageSize audit events matching
+// the filter, oldest first, along with the token of the next page or an empty
+// string if there are no more events.
+func (r *Repository) ExportAuditEvents(ctx context.Context, f AuditFilter, token string) ([]*AuditEvent, string, error) {
+	return r.auditPage(ctx, f, token, AuditExportPageSize, 1)
+}
+
+// auditPage returns size audit events matching the filter after the one of
+// the page token, in ascending (1) or descending (-1) order.
+func (r *Repository) auditPage(ctx context.Context, f AuditFilter, token string, size, order int) ([]*AuditEvent, string, error) {
+	filter := f.bson()
+
+	if token != "" {
+		cursor, err := decodePageToken(token)
+		if err != nil {
+			return nil, "", twirp.InvalidArgumentError("page_token", err.Error())
+		}
+
+		after := "$lt"
+		if order > 0 {
+			after = "$gt"
+		}
+
+		filter = bson.M{"$and": bson.A{filter, bson.M{"$or": bson.A{
+			bson.M{"timestamp": bson.M{after: cursor.CreatedAt}},
+			bson.M{"timestamp": cursor.CreatedAt, "_id": bson.M{after: cursor.ID}},
+		}}}}
+	}
+
+	// Fetch one extra event to find out whether there is a next page.
+	opts := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: order}, {Key: "_id", Value: order}}).
+		SetLimit(int64(size + 1))
+
+	cursor, err := r.conn.Collection(auditCollection).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var events []*AuditEvent
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, "", err
+	}
+
+	if len(events) > size {
+		events = events[:size]
+		last := events[size-1]
+		return events, encodePageToken(last.Timestamp, last.ID), nil
+	}
+
+	return events, "", nil
+}
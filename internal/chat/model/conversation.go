@@ -1,6 +1,7 @@
 package model
 
 import (
+	"slices"
 	"time"
 
 	"github.com/acai-travel/tech-challenge/internal/pb"
@@ -13,7 +14,63 @@ type Conversation struct {
 	Title     string             `bson:"subject"`
 	CreatedAt time.Time          `bson:"created_at"`
 	UpdatedAt time.Time          `bson:"updated_at"`
-	Messages  []*Message         `bson:"messages"`
+	// Owner is the ID of the user who started the conversation, empty when
+	// authentication is disabled.
+	Owner string `bson:"owner,omitempty"`
+
+	// Pinned conversations never expire.
+	Pinned bool `bson:"pinned"`
+	// Retention overrides the default retention policy when set.
+	Retention time.Duration `bson:"retention,omitempty"`
+	// RetentionClass and ExpiresAt are derived from the fields above on save.
+	RetentionClass RetentionClass `bson:"retention_class"`
+	ExpiresAt      *time.Time     `bson:"expires_at,omitempty"`
+
+	// Persona is the name of the persona answering, empty for the default one.
+	Persona string `bson:"persona,omitempty"`
+
+	// Ancestors are the conversations this one was forked from, the first one
+	// first and its parent last, see Repository.Tree.
+	Ancestors []primitive.ObjectID `bson:"ancestors,omitempty"`
+	// ForkedFrom is the last message copied from the parent.
+	ForkedFrom primitive.ObjectID `bson:"forked_from,omitempty"`
+
+	// Messages are stored in their own collection, see Repository.ListMessages.
+	Messages []*Message `bson:"-"`
+}
+
+// ParentID is the conversation this one was forked from, if any.
+func (c *Conversation) ParentID() (primitive.ObjectID, bool) {
+	if len(c.Ancestors) == 0 {
+		return primitive.NilObjectID, false
+	}
+
+	return c.Ancestors[len(c.Ancestors)-1], true
+}
+
+// Fork copies the conversation, up to and including its message at index i,
+// into a new conversation that descends from it. Copied messages get new IDs
+// and keep their timestamps. The fork is not stored.
+func (c *Conversation) Fork(i int, now time.Time) *Conversation {
+	fork := &Conversation{
+		ID:         primitive.NewObjectID(),
+		Title:      c.Title,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		Owner:      c.Owner,
+		Retention:  c.Retention,
+		Persona:    c.Persona,
+		Ancestors:  append(slices.Clone(c.Ancestors), c.ID),
+		ForkedFrom: c.Messages[i].ID,
+	}
+
+	for _, m := range c.Messages[:i+1] {
+		msg := *m
+		msg.ID = primitive.NewObjectID()
+		fork.Messages = append(fork.Messages, &msg)
+	}
+
+	return fork
 }
 
 func (c *Conversation) Proto() *pb.Conversation {
@@ -21,6 +78,17 @@ func (c *Conversation) Proto() *pb.Conversation {
 		Id:        c.ID.Hex(),
 		Title:     c.Title,
 		Timestamp: timestamppb.New(c.UpdatedAt),
+		Pinned:    c.Pinned,
+		Persona:   c.Persona,
+	}
+
+	if c.ExpiresAt != nil {
+		proto.ExpiresAt = timestamppb.New(*c.ExpiresAt)
+	}
+
+	if parent, ok := c.ParentID(); ok {
+		proto.ParentId = parent.Hex()
+		proto.ForkedFromMessageId = c.ForkedFrom.Hex()
 	}
 
 	for _, m := range c.Messages {
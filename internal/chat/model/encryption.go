@@ -0,0 +1,230 @@
+package model
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/acai-travel/tech-challenge/internal/encryption"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EncryptWith encrypts conversation titles, message content, earlier versions
+// included, and memories with keys when they are stored, and decrypts them
+// when they are read. Values are bound to the ID of their document. Without
+// keys, as by default, they are stored in plain text. Values stored in plain
+// text stay readable once keys are set; Reencrypt encrypts them.
+func (r *Repository) EncryptWith(keys *encryption.KeySet) {
+	r.keys = keys
+}
+
+// Encrypted reports whether content is encrypted when stored.
+func (r *Repository) Encrypted() bool {
+	return r.keys != nil
+}
+
+// sealConversation returns a copy of c to store, with its title encrypted.
+func (r *Repository) sealConversation(c *Conversation) (*Conversation, error) {
+	title, err := r.keys.Encrypt(c.Title, c.ID.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := *c
+	sealed.Title = title
+	return &sealed, nil
+}
+
+func (r *Repository) openConversation(c *Conversation) error {
+	title, err := r.keys.Decrypt(c.Title, c.ID.Hex())
+	if err != nil {
+		return fmt.Errorf("conversation %s: %w", c.ID.Hex(), err)
+	}
+
+	c.Title = title
+	return nil
+}
+
+// sealMessage returns a copy of m to store, with its content encrypted.
+func (r *Repository) sealMessage(m *Message) (*Message, error) {
+	sealed := *m
+
+	var err error
+	if sealed.Content, err = r.keys.Encrypt(m.Content, m.ID.Hex()); err != nil {
+		return nil, err
+	}
+
+	sealed.Versions = make([]*MessageVersion, 0, len(m.Versions))
+	for _, v := range m.Versions {
+		version := *v
+		if version.Content, err = r.keys.Encrypt(v.Content, m.ID.Hex()); err != nil {
+			return nil, err
+		}
+		sealed.Versions = append(sealed.Versions, &version)
+	}
+
+	return &sealed, nil
+}
+
+func (r *Repository) openMessage(m *Message) error {
+	var err error
+	if m.Content, err = r.keys.Decrypt(m.Content, m.ID.Hex()); err != nil {
+		return fmt.Errorf("message %s: %w", m.ID.Hex(), err)
+	}
+
+	for _, v := range m.Versions {
+		if v.Content, err = r.keys.Decrypt(v.Content, m.ID.Hex()); err != nil {
+			return fmt.Errorf("message %s: %w", m.ID.Hex(), err)
+		}
+	}
+
+	return nil
+}
+
+// ReencryptStats counts the documents Reencrypt rewrote.
+type ReencryptStats struct {
+	Conversations int
+	Messages      int
+	Memories      int
+}
+
+// Reencrypt encrypts every title, message and memory with the primary key:
+// values in plain text are encrypted and values of other keys get their data
+// key rewrapped. Run after adding a new primary key, the old keys can be
+// removed once it is done. It is safe to run more than once, and to interrupt.
+func (r *Repository) Reencrypt(ctx context.Context) (ReencryptStats, error) {
+	var stats ReencryptStats
+
+	if r.keys == nil {
+		return stats, fmt.Errorf("no encryption keys configured")
+	}
+
+	var err error
+
+	if stats.Conversations, err = r.reencryptField(ctx, conversationCollection, "subject"); err != nil {
+		return stats, err
+	}
+
+	stats.Messages, err = reencrypt(ctx, r.conn.Collection(messageCollection),
+		bson.M{"_id": 1, "content": 1, "versions": 1},
+		func(m *Message) (primitive.ObjectID, bson.M, bson.M, error) {
+			set, err := r.rotateMessage(m)
+			return m.ID, messageMatch(m), set, err
+		})
+	if err != nil {
+		return stats, err
+	}
+
+	stats.Memories, err = r.reencryptField(ctx, memoryCollection, "content")
+	return stats, err
+}
+
+// reencryptField encrypts a string field of every document of the collection
+// with the primary key, bound to the document ID.
+func (r *Repository) reencryptField(ctx context.Context, collection, field string) (int, error) {
+	return reencrypt(ctx, r.conn.Collection(collection), bson.M{"_id": 1, field: 1},
+		func(doc *bson.Raw) (primitive.ObjectID, bson.M, bson.M, error) {
+			id, _ := doc.Lookup("_id").ObjectIDOK()
+			value, _ := doc.Lookup(field).StringValueOK()
+
+			rotated, changed, err := r.keys.Rotate(value, id.Hex())
+			if err != nil || !changed {
+				return id, nil, nil, err
+			}
+
+			return id, bson.M{field: value}, bson.M{field: rotated}, nil
+		})
+}
+
+// reencrypt calls rotate with every document of the collection, read with the
+// projection, and sets the fields it returns on the documents still matching
+// the values it read, so that documents changed in the meantime are left
+// alone. It returns the number of documents updated.
+func reencrypt[T any](ctx context.Context, coll *mongo.Collection, projection bson.M, rotate func(*T) (id primitive.ObjectID, match, set bson.M, err error)) (int, error) {
+	cursor, err := coll.Find(ctx, bson.M{}, options.Find().SetProjection(projection))
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		_ = cursor.Close(ctx)
+	}()
+
+	updated := 0
+
+	for cursor.Next(ctx) {
+		var doc T
+		if err := cursor.Decode(&doc); err != nil {
+			return updated, err
+		}
+
+		id, match, set, err := rotate(&doc)
+		if err != nil {
+			return updated, fmt.Errorf("%s %s: %w", coll.Name(), id.Hex(), err)
+		}
+
+		if len(set) == 0 {
+			continue
+		}
+
+		match["_id"] = id
+		if _, err := coll.UpdateOne(ctx, match, bson.M{"$set": set}); err != nil {
+			return updated, fmt.Errorf("%s %s: %w", coll.Name(), id.Hex(), err)
+		}
+
+		updated++
+	}
+
+	return updated, cursor.Err()
+}
+
+// messageMatch matches the content and earlier versions of m as read, so that
+// messages whose versions alone still need rotating are updated too, unless
+// they were edited in the meantime.
+func messageMatch(m *Message) bson.M {
+	match := bson.M{"content": m.Content}
+
+	if len(m.Versions) > 0 {
+		versions := make(bson.A, 0, len(m.Versions))
+		for _, v := range m.Versions {
+			versions = append(versions, v.Content)
+		}
+		match["versions.content"] = bson.M{"$all": versions}
+	}
+
+	return match
+}
+
+// rotateMessage returns the fields of m to update for its content and
+// versions to be encrypted with the primary key, none when they already are.
+func (r *Repository) rotateMessage(m *Message) (bson.M, error) {
+	set := bson.M{}
+
+	content, changed, err := r.keys.Rotate(m.Content, m.ID.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	if changed {
+		set["content"] = content
+	}
+
+	versions := make([]*MessageVersion, 0, len(m.Versions))
+	rotated := false
+	for _, v := range m.Versions {
+		version := *v
+		if version.Content, changed, err = r.keys.Rotate(v.Content, m.ID.Hex()); err != nil {
+			return nil, err
+		}
+		rotated = rotated || changed
+		versions = append(versions, &version)
+	}
+
+	if rotated {
+		set["versions"] = versions
+	}
+
+	return set, nil
+}
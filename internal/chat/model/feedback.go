@@ -0,0 +1,108 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/acai-travel/tech-challenge/internal/pb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const feedbackCollection = "feedback"
+
+type Rating string
+
+const (
+	RatingUp   Rating = "up"
+	RatingDown Rating = "down"
+)
+
+func RatingFromProto(r pb.Feedback_Rating) Rating {
+	switch r {
+	case pb.Feedback_UP:
+		return RatingUp
+	case pb.Feedback_DOWN:
+		return RatingDown
+	default:
+		return ""
+	}
+}
+
+func (r Rating) Proto() pb.Feedback_Rating {
+	switch r {
+	case RatingUp:
+		return pb.Feedback_UP
+	case RatingDown:
+		return pb.Feedback_DOWN
+	default:
+		return pb.Feedback_UNKNOWN
+	}
+}
+
+// FeedbackCategories are the reasons a user can give for a rating.
+var FeedbackCategories = []string{"helpful", "inaccurate", "incomplete", "off_topic", "harmful", "other"}
+
+// Feedback is the rating of a reply by a user. It keeps how the reply was
+// generated, as the message may be regenerated or deleted later.
+type Feedback struct {
+	ID             primitive.ObjectID `bson:"_id"`
+	ConversationID primitive.ObjectID `bson:"conversation_id"`
+	MessageID      primitive.ObjectID `bson:"message_id"`
+	Owner          string             `bson:"owner,omitempty"`
+	Rating         Rating             `bson:"rating"`
+	Category       string             `bson:"category,omitempty"`
+	Comment        string             `bson:"comment,omitempty"`
+
+	MessageVersion int      `bson:"message_version"`
+	Model          string   `bson:"model,omitempty"`
+	Tools          []string `bson:"tools,omitempty"`
+	PromptVersion  string   `bson:"prompt_version,omitempty"`
+
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+func (f *Feedback) Proto() *pb.Feedback {
+	return &pb.Feedback{
+		Id:             f.ID.Hex(),
+		ConversationId: f.ConversationID.Hex(),
+		MessageId:      f.MessageID.Hex(),
+		Rating:         f.Rating.Proto(),
+		Category:       f.Category,
+		Comment:        f.Comment,
+		MessageVersion: int32(f.MessageVersion),
+		Model:          f.Model,
+		Tools:          f.Tools,
+		PromptVersion:  f.PromptVersion,
+		CreatedAt:      timestamppb.New(f.CreatedAt),
+	}
+}
+
+// SaveFeedback stores feedback on a message, replacing the earlier feedback of
+// the same owner on it, whose ID is kept.
+func (r *Repository) SaveFeedback(ctx context.Context, f *Feedback) error {
+	coll := r.conn.Collection(feedbackCollection)
+
+	filter := bson.M{"message_id": f.MessageID, "owner": f.Owner}
+	if f.Owner == "" {
+		// Anonymous feedback is stored without an owner.
+		filter["owner"] = nil
+	}
+
+	var existing Feedback
+	err := coll.FindOne(ctx, filter, options.FindOne().SetProjection(bson.M{"_id": 1})).Decode(&existing)
+
+	switch {
+	case err == nil:
+		f.ID = existing.ID
+	case !errors.Is(err, mongo.ErrNoDocuments):
+		return err
+	}
+
+	_, err = coll.ReplaceOne(ctx, bson.M{"_id": f.ID}, f, options.Replace().SetUpsert(true))
+	return err
+}
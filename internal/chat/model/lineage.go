@@ -0,0 +1,119 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"slices"
+
+	"github.com/acai-travel/tech-challenge/internal/pb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// TreeNode is a conversation in a tree of forks.
+type TreeNode struct {
+	ID primitive.ObjectID
+	// Conversation is nil when the conversation was deleted but some of its
+	// forks were not.
+	Conversation *Conversation
+	Forks        []*TreeNode
+}
+
+// SetupLineageIndex creates the index used to find the forks of a
+// conversation.
+func (r *Repository) SetupLineageIndex(ctx context.Context) error {
+	indexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: "ancestors", Value: 1}},
+	}
+
+	_, err := r.conn.Collection(conversationCollection).Indexes().CreateOne(ctx, indexModel)
+	return err
+}
+
+// Tree returns the tree of forks the conversation belongs to, starting from
+// the conversation all of them descend from. Conversations are loaded without
+// their messages.
+func (r *Repository) Tree(ctx context.Context, c *Conversation) (*TreeNode, error) {
+	root := c.ID
+	if len(c.Ancestors) > 0 {
+		root = c.Ancestors[0]
+	}
+
+	cursor, err := r.conn.Collection(conversationCollection).Find(ctx,
+		scope(ctx, bson.M{"$or": bson.A{bson.M{"_id": root}, bson.M{"ancestors": root}}}))
+	if err != nil {
+		return nil, err
+	}
+
+	var convs []*Conversation
+	if err := cursor.All(ctx, &convs); err != nil {
+		return nil, err
+	}
+
+	for _, conv := range convs {
+		if err := r.openConversation(conv); err != nil {
+			return nil, err
+		}
+	}
+
+	nodes := map[primitive.ObjectID]*TreeNode{}
+
+	var node func(id primitive.ObjectID, ancestors []primitive.ObjectID) *TreeNode
+	node = func(id primitive.ObjectID, ancestors []primitive.ObjectID) *TreeNode {
+		if n, ok := nodes[id]; ok {
+			return n
+		}
+
+		n := &TreeNode{ID: id}
+		nodes[id] = n
+
+		if len(ancestors) > 0 {
+			parent := node(ancestors[len(ancestors)-1], ancestors[:len(ancestors)-1])
+			parent.Forks = append(parent.Forks, n)
+		}
+
+		return n
+	}
+
+	for _, conv := range convs {
+		node(conv.ID, conv.Ancestors).Conversation = conv
+	}
+
+	// The conversation itself is always part of its tree, even if it was
+	// deleted in the meantime.
+	node(c.ID, c.Ancestors)
+
+	// Object IDs start with their creation time, so this lists forks oldest
+	// first, deleted ones included.
+	for _, n := range nodes {
+		slices.SortFunc(n.Forks, func(a, b *TreeNode) int {
+			return bytes.Compare(a.ID[:], b.ID[:])
+		})
+	}
+
+	return nodes[root], nil
+}
+
+func (n *TreeNode) Proto() *pb.ConversationNode {
+	proto := &pb.ConversationNode{
+		ConversationId: n.ID.Hex(),
+		Deleted:        n.Conversation == nil,
+	}
+
+	if c := n.Conversation; c != nil {
+		proto.Title = c.Title
+		proto.Timestamp = timestamppb.New(c.CreatedAt)
+
+		if !c.ForkedFrom.IsZero() {
+			proto.ForkedFromMessageId = c.ForkedFrom.Hex()
+		}
+	}
+
+	for _, fork := range n.Forks {
+		proto.Forks = append(proto.Forks, fork.Proto())
+	}
+
+	return proto
+}
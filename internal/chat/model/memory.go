@@ -0,0 +1,194 @@
+package model
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/acai-travel/tech-challenge/internal/auth"
+	"github.com/acai-travel/tech-challenge/internal/errs"
+	"github.com/acai-travel/tech-challenge/internal/pb"
+	"github.com/twitchtv/twirp"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	memoryCollection = "memories"
+
+	// MaxMemories caps the number of memories of a user.
+	MaxMemories = 100
+	// MaxMemoryLength is the length of a memory, in characters.
+	MaxMemoryLength = 500
+)
+
+// Memory is a fact about a user, such as their home airport, kept across
+// conversations.
+type Memory struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	Owner     string             `bson:"owner,omitempty"`
+	Content   string             `bson:"content"`
+	CreatedAt time.Time          `bson:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at"`
+}
+
+func (m *Memory) Proto() *pb.Memory {
+	return &pb.Memory{
+		Id:        m.ID.Hex(),
+		Content:   m.Content,
+		CreatedAt: timestamppb.New(m.CreatedAt),
+		UpdatedAt: timestamppb.New(m.UpdatedAt),
+	}
+}
+
+// errAnonymousMemory is returned to anonymous callers, who would otherwise
+// all share the memories of the empty owner.
+var errAnonymousMemory = twirp.NewError(twirp.PermissionDenied, "memories are only kept for authenticated users")
+
+// SetupMemoryIndex creates the index used to read the memories of a user.
+func (r *Repository) SetupMemoryIndex(ctx context.Context) error {
+	_, err := r.conn.Collection(memoryCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "owner", Value: 1}, {Key: "updated_at", Value: -1}},
+	})
+	return err
+}
+
+// SaveMemory stores a memory of the authenticated user. A memory with the same
+// content, ignoring case, is refreshed instead, keeping its ID. Users have at
+// most MaxMemories memories.
+func (r *Repository) SaveMemory(ctx context.Context, m *Memory) error {
+	if auth.UserID(ctx) == "" {
+		return errAnonymousMemory
+	}
+
+	memories, err := r.ListMemories(ctx)
+	if err != nil {
+		return err
+	}
+
+	coll := r.conn.Collection(memoryCollection)
+
+	for _, existing := range memories {
+		if strings.EqualFold(existing.Content, m.Content) {
+			m.ID = existing.ID
+			m.CreatedAt = existing.CreatedAt
+			_, err := coll.UpdateOne(ctx, bson.M{"_id": m.ID}, bson.M{"$set": bson.M{"updated_at": m.UpdatedAt}})
+			return err
+		}
+	}
+
+	if len(memories) >= MaxMemories {
+		return errs.InvalidInput("content", fmt.Sprintf("the user already has %d memories, forget one first", MaxMemories))
+	}
+
+	content, err := r.keys.Encrypt(m.Content, m.ID.Hex())
+	if err != nil {
+		return err
+	}
+
+	sealed := *m
+	sealed.Content = content
+
+	_, err = coll.InsertOne(ctx, &sealed)
+	return err
+}
+
+// ListMemories returns the memories of the authenticated user, most recently
+// updated first.
+func (r *Repository) ListMemories(ctx context.Context) ([]*Memory, error) {
+	if auth.UserID(ctx) == "" {
+		return nil, errAnonymousMemory
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}, {Key: "_id", Value: -1}})
+
+	cursor, err := r.conn.Collection(memoryCollection).Find(ctx, scope(ctx, bson.M{}), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var memories []*Memory
+	if err := cursor.All(ctx, &memories); err != nil {
+		return nil, err
+	}
+
+	for _, m := range memories {
+		if m.Content, err = r.keys.Decrypt(m.Content, m.ID.Hex()); err != nil {
+			return nil, fmt.Errorf("memory %s: %w", m.ID.Hex(), err)
+		}
+	}
+
+	return memories, nil
+}
+
+// RecallMemories returns up to limit memories of the authenticated user, those
+// sharing the most words with query first, then the most recently updated
+// ones. Memories are ranked here rather than by a text index as they may be
+// encrypted.
+func (r *Repository) RecallMemories(ctx context.Context, query string, limit int) ([]*Memory, error) {
+	memories, err := r.ListMemories(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	terms := memoryTerms(query)
+	scores := make(map[primitive.ObjectID]int, len(memories))
+	for _, m := range memories {
+		for term := range memoryTerms(m.Content) {
+			if terms[term] {
+				scores[m.ID]++
+			}
+		}
+	}
+
+	// Stable, so that memories scoring the same stay most recent first.
+	slices.SortStableFunc(memories, func(a, b *Memory) int {
+		return cmp.Compare(scores[b.ID], scores[a.ID])
+	})
+
+	return memories[:min(len(memories), limit)], nil
+}
+
+// memoryTerms are the lowercase words of text, skipping words shorter than
+// three letters, which are mostly stop words.
+func memoryTerms(text string) map[string]bool {
+	terms := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len([]rune(word)) >= 3 {
+			terms[word] = true
+		}
+	}
+	return terms
+}
+
+// DeleteMemory deletes a memory of the authenticated user.
+func (r *Repository) DeleteMemory(ctx context.Context, id string) error {
+	if auth.UserID(ctx) == "" {
+		return errAnonymousMemory
+	}
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return twirp.NotFoundError("invalid memory ID")
+	}
+
+	res, err := r.conn.Collection(memoryCollection).DeleteOne(ctx, scope(ctx, bson.M{"_id": oid}))
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedCount == 0 {
+		return twirp.NotFoundError("memory not found")
+	}
+
+	return nil
+}
@@ -9,18 +9,89 @@ import (
 )
 
 type Message struct {
-	ID        primitive.ObjectID `bson:"_id"`
-	Role      Role               `bson:"role"`
-	Content   string             `bson:"content"`
-	CreatedAt time.Time          `bson:"created_at"`
-	UpdatedAt time.Time          `bson:"updated_at"`
+	ID             primitive.ObjectID `bson:"_id"`
+	ConversationID primitive.ObjectID `bson:"conversation_id"`
+	// Owner is the owner of the conversation, kept on its messages so that they
+	// can be searched without looking up every conversation of the user.
+	Owner     string    `bson:"owner,omitempty"`
+	Role      Role      `bson:"role"`
+	Content   string    `bson:"content"`
+	CreatedAt time.Time `bson:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at"`
+
+	// Version counts the revisions of Content, from 1. Messages stored before
+	// messages could be edited have none, which also means 1.
+	Version int `bson:"version,omitempty"`
+	// Versions are the earlier revisions of Content, oldest first.
+	Versions []*MessageVersion `bson:"versions,omitempty"`
+	// PromptVersion is the version of the system prompt a reply was generated
+	// with, see prompts.Prompt.
+	PromptVersion string `bson:"prompt_version,omitempty"`
+	// Model generated a reply, calling Tools.
+	Model string   `bson:"model,omitempty"`
+	Tools []string `bson:"tools,omitempty"`
+}
+
+// MessageVersion is an earlier revision of a message, replaced by an edit or
+// a regenerated reply.
+type MessageVersion struct {
+	Version   int       `bson:"version"`
+	Content   string    `bson:"content"`
+	CreatedAt time.Time `bson:"created_at"`
+
+	PromptVersion string `bson:"prompt_version,omitempty"`
+}
+
+// CurrentVersion is the version of Content.
+func (m *Message) CurrentVersion() int {
+	return max(m.Version, 1)
+}
+
+// Revise replaces the content, keeping the current one as an earlier version.
+func (m *Message) Revise(content string, at time.Time) {
+	m.Versions = append(m.Versions, &MessageVersion{
+		Version:       m.CurrentVersion(),
+		Content:       m.Content,
+		CreatedAt:     m.UpdatedAt,
+		PromptVersion: m.PromptVersion,
+	})
+
+	m.Version = m.CurrentVersion() + 1
+	m.Content = content
+	m.UpdatedAt = at
+	m.PromptVersion = ""
+	m.Model = ""
+	m.Tools = nil
+}
+
+// ReviseReply replaces the content of a reply with a regenerated one.
+func (m *Message) ReviseReply(reply *Message) {
+	m.Revise(reply.Content, reply.UpdatedAt)
+	m.PromptVersion = reply.PromptVersion
+	m.Model = reply.Model
+	m.Tools = reply.Tools
 }
 
 func (m *Message) Proto() *pb.Conversation_Message {
-	return &pb.Conversation_Message{
-		Id:        m.ID.Hex(),
-		Role:      m.Role.Proto(),
-		Content:   m.Content,
-		Timestamp: timestamppb.New(m.CreatedAt),
+	proto := &pb.Conversation_Message{
+		Id:            m.ID.Hex(),
+		Role:          m.Role.Proto(),
+		Content:       m.Content,
+		Timestamp:     timestamppb.New(m.CreatedAt),
+		Version:       int32(m.CurrentVersion()),
+		PromptVersion: m.PromptVersion,
+		Model:         m.Model,
+		Tools:         m.Tools,
 	}
+
+	for _, v := range m.Versions {
+		proto.PreviousVersions = append(proto.PreviousVersions, &pb.Conversation_Message_Version{
+			Version:       int32(v.Version),
+			Content:       v.Content,
+			Timestamp:     timestamppb.New(v.CreatedAt),
+			PromptVersion: v.PromptVersion,
+		})
+	}
+
+	return proto
 }
@@ -0,0 +1,107 @@
+package model
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MigrateEmbeddedMessages moves messages embedded in conversation documents,
+// as stored by earlier versions, into the messages collection. It is safe to
+// run more than once: messages that were already copied are left untouched.
+// It returns the number of conversations migrated.
+func (r *Repository) MigrateEmbeddedMessages(ctx context.Context) (int, error) {
+	conversations := r.conn.Collection(conversationCollection)
+	messages := r.conn.Collection(messageCollection)
+
+	cursor, err := conversations.Find(ctx, bson.M{"messages": bson.M{"$exists": true}},
+		options.Find().SetProjection(bson.M{"_id": 1, "owner": 1, "messages": 1}))
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		_ = cursor.Close(ctx)
+	}()
+
+	migrated := 0
+
+	for cursor.Next(ctx) {
+		var legacy struct {
+			ID       primitive.ObjectID `bson:"_id"`
+			Owner    string             `bson:"owner"`
+			Messages []*Message         `bson:"messages"`
+		}
+
+		if err := cursor.Decode(&legacy); err != nil {
+			return migrated, err
+		}
+
+		for _, m := range legacy.Messages {
+			m.ConversationID = legacy.ID
+			m.Owner = legacy.Owner
+
+			sealed, err := r.sealMessage(m)
+			if err != nil {
+				return migrated, fmt.Errorf("conversation %s: %w", legacy.ID.Hex(), err)
+			}
+
+			_, err = messages.ReplaceOne(ctx, bson.M{"_id": m.ID}, sealed, options.Replace().SetUpsert(true))
+			if err != nil {
+				return migrated, fmt.Errorf("conversation %s: %w", legacy.ID.Hex(), err)
+			}
+		}
+
+		_, err := conversations.UpdateOne(ctx, bson.M{"_id": legacy.ID}, bson.M{"$unset": bson.M{"messages": ""}})
+		if err != nil {
+			return migrated, fmt.Errorf("conversation %s: %w", legacy.ID.Hex(), err)
+		}
+
+		migrated++
+	}
+
+	return migrated, cursor.Err()
+}
+
+// MigrateMessageOwners copies the owner of every conversation onto its
+// messages, which earlier versions stored without one. It returns the number
+// of messages updated.
+func (r *Repository) MigrateMessageOwners(ctx context.Context) (int64, error) {
+	cursor, err := r.conn.Collection(conversationCollection).Find(ctx,
+		bson.M{"owner": bson.M{"$exists": true, "$ne": ""}},
+		options.Find().SetProjection(bson.M{"_id": 1, "owner": 1}))
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		_ = cursor.Close(ctx)
+	}()
+
+	var updated int64
+
+	for cursor.Next(ctx) {
+		var c struct {
+			ID    primitive.ObjectID `bson:"_id"`
+			Owner string             `bson:"owner"`
+		}
+
+		if err := cursor.Decode(&c); err != nil {
+			return updated, err
+		}
+
+		res, err := r.conn.Collection(messageCollection).UpdateMany(ctx,
+			bson.M{"conversation_id": c.ID, "owner": bson.M{"$ne": c.Owner}},
+			bson.M{"$set": bson.M{"owner": c.Owner}})
+		if err != nil {
+			return updated, fmt.Errorf("conversation %s: %w", c.ID.Hex(), err)
+		}
+
+		updated += res.ModifiedCount
+	}
+
+	return updated, cursor.Err()
+}
@@ -0,0 +1,56 @@
+package model
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MaxPageSize caps the number of messages returned by a single page.
+const MaxPageSize = 500
+
+// MessagePage selects a window of a conversation's messages ordered by
+// creation time. A zero Size returns every message after Token.
+type MessagePage struct {
+	Size  int
+	Token string
+}
+
+// pageCursor is the position of the last item returned in a page.
+type pageCursor struct {
+	CreatedAt time.Time
+	ID        primitive.ObjectID
+}
+
+func encodePageToken(createdAt time.Time, id primitive.ObjectID) string {
+	raw := strconv.FormatInt(createdAt.UnixMilli(), 10) + ":" + id.Hex()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodePageToken(token string) (*pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("malformed page token")
+	}
+
+	millis, hex, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, fmt.Errorf("malformed page token")
+	}
+
+	ms, err := strconv.ParseInt(millis, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("malformed page token")
+	}
+
+	id, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		return nil, fmt.Errorf("malformed page token")
+	}
+
+	return &pageCursor{CreatedAt: time.UnixMilli(ms), ID: id}, nil
+}
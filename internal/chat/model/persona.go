@@ -0,0 +1,140 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/acai-travel/tech-challenge/internal/pb"
+	"github.com/twitchtv/twirp"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const personaCollection = "personas"
+
+// Persona is a named configuration of the assistant a conversation can be
+// started with.
+type Persona struct {
+	Name         string `bson:"_id"`
+	Description  string `bson:"description,omitempty"`
+	SystemPrompt string `bson:"system_prompt"`
+	// Model answers the user, the default reply model when empty.
+	Model string `bson:"model,omitempty"`
+	// Temperature is the sampling temperature, the model default when nil.
+	Temperature *float64 `bson:"temperature,omitempty"`
+	// Tools are the names of the tools the persona may call, every enabled tool
+	// when empty.
+	Tools     []string  `bson:"tools,omitempty"`
+	CreatedAt time.Time `bson:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
+// PersonaFromProto reads a persona sent by a client, without its timestamps.
+func PersonaFromProto(p *pb.Persona) *Persona {
+	persona := &Persona{
+		Name:         p.GetName(),
+		Description:  p.GetDescription(),
+		SystemPrompt: p.GetSystemPrompt(),
+		Model:        p.GetModel(),
+		Tools:        p.GetTools(),
+	}
+
+	if p.Temperature != nil {
+		temperature := p.GetTemperature()
+		persona.Temperature = &temperature
+	}
+
+	return persona
+}
+
+func (p *Persona) Proto() *pb.Persona {
+	return &pb.Persona{
+		Name:         p.Name,
+		Description:  p.Description,
+		SystemPrompt: p.SystemPrompt,
+		Model:        p.Model,
+		Temperature:  p.Temperature,
+		Tools:        p.Tools,
+		CreatedAt:    timestamppb.New(p.CreatedAt),
+		UpdatedAt:    timestamppb.New(p.UpdatedAt),
+	}
+}
+
+func (r *Repository) CreatePersona(ctx context.Context, p *Persona) error {
+	_, err := r.conn.Collection(personaCollection).InsertOne(ctx, p)
+	if mongo.IsDuplicateKeyError(err) {
+		return twirp.NewError(twirp.AlreadyExists, "persona already exists")
+	}
+
+	return err
+}
+
+func (r *Repository) GetPersona(ctx context.Context, name string) (*Persona, error) {
+	var p Persona
+
+	err := r.conn.Collection(personaCollection).FindOne(ctx, bson.M{"_id": name}).Decode(&p)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, twirp.NotFoundError("persona not found")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// ListPersonas returns every persona, by name.
+func (r *Repository) ListPersonas(ctx context.Context) ([]*Persona, error) {
+	cursor, err := r.conn.Collection(personaCollection).Find(ctx, bson.M{},
+		options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	var items []*Persona
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// UpdatePersona replaces a persona, keeping its creation time.
+func (r *Repository) UpdatePersona(ctx context.Context, p *Persona) error {
+	existing, err := r.GetPersona(ctx, p.Name)
+	if err != nil {
+		return err
+	}
+
+	p.CreatedAt = existing.CreatedAt
+
+	res, err := r.conn.Collection(personaCollection).ReplaceOne(ctx, bson.M{"_id": p.Name}, p)
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return twirp.NotFoundError("persona not found")
+	}
+
+	return nil
+}
+
+// DeletePersona deletes a persona. Conversations started with it get the
+// default persona from then on.
+func (r *Repository) DeletePersona(ctx context.Context, name string) error {
+	res, err := r.conn.Collection(personaCollection).DeleteOne(ctx, bson.M{"_id": name})
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedCount == 0 {
+		return twirp.NotFoundError("persona not found")
+	}
+
+	return nil
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 
+	"github.com/acai-travel/tech-challenge/internal/auth"
+	"github.com/acai-travel/tech-challenge/internal/encryption"
 	"github.com/twitchtv/twirp"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -13,39 +15,72 @@ import (
 
 const (
 	conversationCollection = "conversations"
+	messageCollection      = "messages"
 )
 
 type Repository struct {
-	conn *mongo.Database
+	conn      *mongo.Database
+	retention RetentionPolicy
+	keys      *encryption.KeySet
+
+	// orphanCursor is the conversation ID the next sweep looks for orphaned
+	// messages after.
+	orphanCursor primitive.ObjectID
+}
+
+// scope restricts a conversation filter to the conversations of the
+// authenticated user. Without a user, as when authentication is disabled or in
+// background jobs, every conversation matches.
+func scope(ctx context.Context, filter bson.M) bson.M {
+	if uid := auth.UserID(ctx); uid != "" {
+		filter["owner"] = uid
+	}
+
+	return filter
 }
 
 func New(conn *mongo.Database) *Repository {
 	return &Repository{
-		conn: conn,
+		conn:      conn,
+		retention: DefaultRetentionPolicy,
 	}
 }
 
-// SetupTTLIndex creates a TTL index on the updated_at field to automatically
-// delete conversations that haven't been updated in 1 hour.
-func (r *Repository) SetupTTLIndex(ctx context.Context) error {
-	collection := r.conn.Collection(conversationCollection)
-
+// SetupMessageIndex creates the index used to read a conversation's messages
+// in chronological order.
+func (r *Repository) SetupMessageIndex(ctx context.Context) error {
 	indexModel := mongo.IndexModel{
-		Keys: bson.D{{Key: "updated_at", Value: 1}},
-		Options: options.Index().
-			SetExpireAfterSeconds(3600),
+		Keys: bson.D{{Key: "conversation_id", Value: 1}, {Key: "created_at", Value: 1}},
 	}
 
-	_, err := collection.Indexes().CreateOne(ctx, indexModel)
+	_, err := r.conn.Collection(messageCollection).Indexes().CreateOne(ctx, indexModel)
 	return err
 }
 
 func (r *Repository) CreateConversation(ctx context.Context, c *Conversation) error {
-	_, err := r.conn.Collection(conversationCollection).InsertOne(ctx, c)
-	return err
+	applyRetention(c)
+
+	sealed, err := r.sealConversation(c)
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.conn.Collection(conversationCollection).InsertOne(ctx, sealed); err != nil {
+		return err
+	}
+
+	if err := r.AppendMessages(ctx, c, c.Messages...); err != nil {
+		// Don't leave a conversation without its messages behind.
+		_, _ = r.conn.Collection(conversationCollection).DeleteOne(ctx, bson.M{"_id": c.ID})
+		_, _ = r.conn.Collection(messageCollection).DeleteMany(ctx, bson.M{"conversation_id": c.ID})
+		return err
+	}
+
+	return nil
 }
 
-func (r *Repository) DescribeConversation(ctx context.Context, id string) (*Conversation, error) {
+// GetConversation loads a conversation without its messages.
+func (r *Repository) GetConversation(ctx context.Context, id string) (*Conversation, error) {
 	var c Conversation
 
 	oid, err := primitive.ObjectIDFromHex(id)
@@ -53,7 +88,7 @@ func (r *Repository) DescribeConversation(ctx context.Context, id string) (*Conv
 		return nil, twirp.NotFoundError("invalid conversation ID")
 	}
 
-	err = r.conn.Collection(conversationCollection).FindOne(ctx, map[string]any{"_id": oid}).Decode(&c)
+	err = r.conn.Collection(conversationCollection).FindOne(ctx, scope(ctx, bson.M{"_id": oid})).Decode(&c)
 	if errors.Is(err, mongo.ErrNoDocuments) {
 		return nil, twirp.NotFoundError("conversation not found")
 	}
@@ -62,15 +97,142 @@ func (r *Repository) DescribeConversation(ctx context.Context, id string) (*Conv
 		return nil, err
 	}
 
+	if err := r.openConversation(&c); err != nil {
+		return nil, err
+	}
+
 	return &c, nil
 }
 
+// DescribeConversation loads a conversation together with all of its messages.
+func (r *Repository) DescribeConversation(ctx context.Context, id string) (*Conversation, error) {
+	c, err := r.GetConversation(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Messages, _, err = r.ListMessages(ctx, c.ID, MessagePage{})
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// ListMessages returns a page of the conversation's messages in chronological
+// order, along with the token of the next page or an empty string if there are
+// no more messages.
+func (r *Repository) ListMessages(ctx context.Context, conversationID primitive.ObjectID, page MessagePage) ([]*Message, string, error) {
+	filter := bson.M{"conversation_id": conversationID}
+
+	if page.Token != "" {
+		cursor, err := decodePageToken(page.Token)
+		if err != nil {
+			return nil, "", twirp.InvalidArgumentError("page_token", err.Error())
+		}
+
+		filter["$or"] = bson.A{
+			bson.M{"created_at": bson.M{"$gt": cursor.CreatedAt}},
+			bson.M{"created_at": cursor.CreatedAt, "_id": bson.M{"$gt": cursor.ID}},
+		}
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+
+	size := min(page.Size, MaxPageSize)
+	if size > 0 {
+		// Fetch one extra message to find out whether there is a next page.
+		opts.SetLimit(int64(size + 1))
+	}
+
+	cursor, err := r.conn.Collection(messageCollection).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var items []*Message
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, "", err
+	}
+
+	for _, m := range items {
+		if err := r.openMessage(m); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if size > 0 && len(items) > size {
+		items = items[:size]
+		return items, encodePageToken(items[size-1].CreatedAt, items[size-1].ID), nil
+	}
+
+	return items, "", nil
+}
+
+// AppendMessages stores new messages for the given conversation.
+func (r *Repository) AppendMessages(ctx context.Context, c *Conversation, msgs ...*Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	docs := make([]any, 0, len(msgs))
+	for _, m := range msgs {
+		m.ConversationID = c.ID
+		m.Owner = c.Owner
+
+		sealed, err := r.sealMessage(m)
+		if err != nil {
+			return err
+		}
+		docs = append(docs, sealed)
+	}
+
+	_, err := r.conn.Collection(messageCollection).InsertMany(ctx, docs)
+	return err
+}
+
+// UpdateMessage replaces a stored message, e.g. after Message.Revise.
+func (r *Repository) UpdateMessage(ctx context.Context, m *Message) error {
+	sealed, err := r.sealMessage(m)
+	if err != nil {
+		return err
+	}
+
+	res, err := r.conn.Collection(messageCollection).ReplaceOne(ctx,
+		bson.M{"_id": m.ID, "conversation_id": m.ConversationID}, sealed)
+
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return twirp.NotFoundError("message not found")
+	}
+
+	return nil
+}
+
+// DeleteMessagesAfter deletes the messages that come after m in its
+// conversation, in the order of ListMessages.
+func (r *Repository) DeleteMessagesAfter(ctx context.Context, m *Message) error {
+	_, err := r.conn.Collection(messageCollection).DeleteMany(ctx, bson.M{
+		"conversation_id": m.ConversationID,
+		"$or": bson.A{
+			bson.M{"created_at": bson.M{"$gt": m.CreatedAt}},
+			bson.M{"created_at": m.CreatedAt, "_id": bson.M{"$gt": m.ID}},
+		},
+	})
+
+	return err
+}
+
 func (r *Repository) ListConversations(ctx context.Context) ([]*Conversation, error) {
 	opts := options.Find().
 		SetSort(bson.D{{Key: "created_at", Value: -1}})
 
 	cursor, err := r.conn.Collection(conversationCollection).
-		Find(ctx, map[string]any{}, opts)
+		Find(ctx, scope(ctx, bson.M{}), opts)
 
 	if err != nil {
 		return nil, err
@@ -89,6 +251,10 @@ func (r *Repository) ListConversations(ctx context.Context) ([]*Conversation, er
 			return nil, err
 		}
 
+		if err := r.openConversation(&c); err != nil {
+			return nil, err
+		}
+
 		items = append(items, &c)
 	}
 
@@ -99,23 +265,46 @@ func (r *Repository) ListConversations(ctx context.Context) ([]*Conversation, er
 	return items, nil
 }
 
+// UpdateConversation updates the conversation document. Messages are not
+// touched, use AppendMessages to add new ones.
 func (r *Repository) UpdateConversation(ctx context.Context, c *Conversation) error {
-	_, err := r.conn.Collection(conversationCollection).UpdateOne(ctx,
-		map[string]any{"_id": c.ID},
-		map[string]any{"$set": c})
+	applyRetention(c)
 
-	if errors.Is(err, mongo.ErrNoDocuments) {
+	sealed, err := r.sealConversation(c)
+	if err != nil {
+		return err
+	}
+
+	res, err := r.conn.Collection(conversationCollection).UpdateOne(ctx,
+		scope(ctx, bson.M{"_id": c.ID}),
+		bson.M{"$set": sealed})
+
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
 		return twirp.NotFoundError("conversation not found")
 	}
 
-	return err
+	return nil
 }
 
 func (r *Repository) DeleteConversation(ctx context.Context, id string) error {
-	_, err := r.conn.Collection(conversationCollection).DeleteOne(ctx, map[string]any{"_id": id})
-	if errors.Is(err, mongo.ErrNoDocuments) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return twirp.NotFoundError("invalid conversation ID")
+	}
+
+	res, err := r.conn.Collection(conversationCollection).DeleteOne(ctx, scope(ctx, bson.M{"_id": oid}))
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedCount == 0 {
 		return twirp.NotFoundError("conversation not found")
 	}
 
+	_, err = r.conn.Collection(messageCollection).DeleteMany(ctx, bson.M{"conversation_id": oid})
 	return err
 }
@@ -0,0 +1,397 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RetentionClass tells which rule decides when a conversation expires.
+type RetentionClass string
+
+const (
+	// RetentionDefault conversations expire after the deployment-wide period of inactivity.
+	RetentionDefault RetentionClass = "default"
+	// RetentionCustom conversations expire at their own ExpiresAt.
+	RetentionCustom RetentionClass = "custom"
+	// RetentionPinned conversations never expire.
+	RetentionPinned RetentionClass = "pinned"
+)
+
+// RetentionMode selects how expired conversations are removed.
+type RetentionMode string
+
+const (
+	// RetentionModeTTL relies on MongoDB TTL indexes.
+	RetentionModeTTL RetentionMode = "ttl"
+	// RetentionModeSweeper periodically deletes expired conversations, for
+	// backends without native TTL support.
+	RetentionModeSweeper RetentionMode = "sweeper"
+)
+
+const (
+	defaultTTLIndex = "retention_default_ttl"
+	customTTLIndex  = "retention_custom_ttl"
+)
+
+type RetentionPolicy struct {
+	// Default is the inactivity period after which conversations are deleted,
+	// zero keeps conversations forever.
+	Default time.Duration
+	// Mode selects how expired conversations are removed.
+	Mode RetentionMode
+	// SweepInterval is how often the sweeper runs.
+	SweepInterval time.Duration
+}
+
+// DefaultRetentionPolicy deletes conversations after one hour of inactivity.
+var DefaultRetentionPolicy = RetentionPolicy{
+	Default:       time.Hour,
+	Mode:          RetentionModeTTL,
+	SweepInterval: time.Minute,
+}
+
+func (p RetentionPolicy) Validate() error {
+	if p.Default < 0 {
+		return fmt.Errorf("retention must not be negative")
+	}
+
+	if p.Default > 0 && p.Default < time.Second {
+		return fmt.Errorf("retention must be at least one second")
+	}
+
+	switch p.Mode {
+	case RetentionModeTTL, RetentionModeSweeper:
+	default:
+		return fmt.Errorf("unknown retention mode %q", p.Mode)
+	}
+
+	if p.SweepInterval <= 0 {
+		return fmt.Errorf("sweep interval must be positive")
+	}
+
+	return nil
+}
+
+// applyRetention derives the retention class and expiry of a conversation
+// from its settings, it must be called every time the conversation is saved.
+func applyRetention(c *Conversation) {
+	switch {
+	case c.Pinned:
+		c.RetentionClass = RetentionPinned
+		c.ExpiresAt = nil
+	case c.Retention > 0:
+		expires := c.UpdatedAt.Add(c.Retention)
+		c.RetentionClass = RetentionCustom
+		c.ExpiresAt = &expires
+	default:
+		c.RetentionClass = RetentionDefault
+		c.ExpiresAt = nil
+	}
+}
+
+// SetupRetention applies the retention policy. In TTL mode it migrates the TTL
+// indexes to the policy: the legacy index on updated_at is dropped, an
+// existing index with a different expiry is changed in place with collMod and
+// missing indexes are created. Conversations saved before retention classes
+// existed are assigned the default class.
+func (r *Repository) SetupRetention(ctx context.Context, policy RetentionPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+
+	r.retention = policy
+
+	collection := r.conn.Collection(conversationCollection)
+
+	_, err := collection.UpdateMany(ctx,
+		bson.M{"retention_class": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"retention_class": RetentionDefault}})
+	if err != nil {
+		return fmt.Errorf("failed to backfill retention class: %w", err)
+	}
+
+	if policy.Mode != RetentionModeTTL {
+		return nil
+	}
+
+	existing, err := r.ttlIndexes(ctx)
+	if err != nil {
+		return err
+	}
+
+	for name, ttl := range existing {
+		switch name {
+		case defaultTTLIndex:
+			if policy.Default == 0 {
+				slog.InfoContext(ctx, "Dropping default retention TTL index, conversations no longer expire")
+				if _, err := collection.Indexes().DropOne(ctx, name); err != nil {
+					return fmt.Errorf("failed to drop index %s: %w", name, err)
+				}
+			} else if want := int32(policy.Default.Seconds()); ttl != want {
+				slog.InfoContext(ctx, "Changing default retention TTL", "from_seconds", ttl, "to_seconds", want)
+				err := r.conn.RunCommand(ctx, bson.D{
+					{Key: "collMod", Value: conversationCollection},
+					{Key: "index", Value: bson.D{
+						{Key: "name", Value: name},
+						{Key: "expireAfterSeconds", Value: want},
+					}},
+				}).Err()
+				if err != nil {
+					return fmt.Errorf("failed to change index %s: %w", name, err)
+				}
+			}
+		case customTTLIndex:
+		default:
+			// TTL indexes created before retention policies expired every
+			// conversation, pinned ones included.
+			slog.InfoContext(ctx, "Dropping legacy TTL index", "index", name)
+			if _, err := collection.Indexes().DropOne(ctx, name); err != nil {
+				return fmt.Errorf("failed to drop index %s: %w", name, err)
+			}
+		}
+	}
+
+	var missing []mongo.IndexModel
+
+	if _, ok := existing[defaultTTLIndex]; !ok && policy.Default > 0 {
+		missing = append(missing, mongo.IndexModel{
+			Keys: bson.D{{Key: "updated_at", Value: 1}},
+			Options: options.Index().
+				SetName(defaultTTLIndex).
+				SetExpireAfterSeconds(int32(policy.Default.Seconds())).
+				SetPartialFilterExpression(bson.M{"retention_class": RetentionDefault}),
+		})
+	}
+
+	if _, ok := existing[customTTLIndex]; !ok {
+		missing = append(missing, mongo.IndexModel{
+			Keys: bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().
+				SetName(customTTLIndex).
+				SetExpireAfterSeconds(0).
+				SetPartialFilterExpression(bson.M{"retention_class": RetentionCustom}),
+		})
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	_, err = collection.Indexes().CreateMany(ctx, missing)
+	return err
+}
+
+// ttlIndexes returns the expiry in seconds of every TTL index on the
+// conversations collection, by index name.
+func (r *Repository) ttlIndexes(ctx context.Context) (map[string]int32, error) {
+	cursor, err := r.conn.Collection(conversationCollection).Indexes().List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list indexes: %w", err)
+	}
+
+	var specs []struct {
+		Name               string `bson:"name"`
+		ExpireAfterSeconds *int32 `bson:"expireAfterSeconds"`
+	}
+
+	if err := cursor.All(ctx, &specs); err != nil {
+		return nil, fmt.Errorf("failed to list indexes: %w", err)
+	}
+
+	indexes := make(map[string]int32)
+	for _, s := range specs {
+		if s.ExpireAfterSeconds != nil {
+			indexes[s.Name] = *s.ExpireAfterSeconds
+		}
+	}
+
+	return indexes, nil
+}
+
+// sweepBatch is the number of conversations deleted, and of messages checked
+// for orphans, at a time.
+const sweepBatch = 1000
+
+// SweepExpired deletes conversations that expired before now, along with their
+// messages, when the policy uses the sweeper, and in every mode removes a batch
+// of messages left behind by conversations deleted through a TTL index. It
+// returns the number of deleted conversations.
+func (r *Repository) SweepExpired(ctx context.Context, now time.Time) (int64, error) {
+	var deleted int64
+
+	if r.retention.Mode == RetentionModeSweeper {
+		expired := bson.A{
+			bson.M{"retention_class": RetentionCustom, "expires_at": bson.M{"$lte": now}},
+		}
+
+		if r.retention.Default > 0 {
+			expired = append(expired, bson.M{
+				"retention_class": RetentionDefault,
+				"updated_at":      bson.M{"$lte": now.Add(-r.retention.Default)},
+			})
+		}
+
+		for {
+			n, err := r.deleteExpired(ctx, bson.M{"$or": expired})
+			deleted += n
+			if err != nil {
+				return deleted, err
+			}
+
+			if n < sweepBatch {
+				break
+			}
+		}
+	}
+
+	if err := r.purgeOrphanedMessages(ctx); err != nil {
+		return deleted, err
+	}
+
+	return deleted, nil
+}
+
+// deleteExpired deletes up to sweepBatch conversations matching filter. Their
+// messages are deleted first, so that a failure leaves the conversations to
+// the next sweep rather than their messages behind.
+func (r *Repository) deleteExpired(ctx context.Context, filter bson.M) (int64, error) {
+	conversations := r.conn.Collection(conversationCollection)
+
+	cursor, err := conversations.Find(ctx, filter,
+		options.Find().SetProjection(bson.M{"_id": 1}).SetLimit(sweepBatch))
+	if err != nil {
+		return 0, fmt.Errorf("failed to list expired conversations: %w", err)
+	}
+
+	var found []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+
+	if err := cursor.All(ctx, &found); err != nil {
+		return 0, fmt.Errorf("failed to list expired conversations: %w", err)
+	}
+
+	if len(found) == 0 {
+		return 0, nil
+	}
+
+	ids := make(bson.A, len(found))
+	for i, c := range found {
+		ids[i] = c.ID
+	}
+
+	if _, err := r.conn.Collection(messageCollection).DeleteMany(ctx, bson.M{"conversation_id": bson.M{"$in": ids}}); err != nil {
+		return 0, fmt.Errorf("failed to delete messages of expired conversations: %w", err)
+	}
+
+	res, err := conversations.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired conversations: %w", err)
+	}
+
+	return res.DeletedCount, nil
+}
+
+// purgeOrphanedMessages deletes the messages of missing conversations among
+// the next sweepBatch messages by conversation ID, so that every sweep does a
+// bounded amount of work. It continues where the previous sweep stopped, and
+// starts over once it has been through every message. Conversations are looked
+// up separately rather than with $lookup, which not every backend supports.
+func (r *Repository) purgeOrphanedMessages(ctx context.Context) error {
+	cursor, err := r.conn.Collection(messageCollection).Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"conversation_id": bson.M{"$gt": r.orphanCursor}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "conversation_id", Value: 1}}}},
+		{{Key: "$limit", Value: sweepBatch}},
+		{{Key: "$group", Value: bson.M{"_id": "$conversation_id"}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list conversations of messages: %w", err)
+	}
+
+	var referenced []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+
+	if err := cursor.All(ctx, &referenced); err != nil {
+		return fmt.Errorf("failed to list conversations of messages: %w", err)
+	}
+
+	if len(referenced) == 0 {
+		r.orphanCursor = primitive.NilObjectID
+		return nil
+	}
+
+	ids := make(bson.A, len(referenced))
+	for i, c := range referenced {
+		ids[i] = c.ID
+
+		if bytes.Compare(c.ID[:], r.orphanCursor[:]) > 0 {
+			r.orphanCursor = c.ID
+		}
+	}
+
+	cursor, err = r.conn.Collection(conversationCollection).Find(ctx,
+		bson.M{"_id": bson.M{"$in": ids}},
+		options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return fmt.Errorf("failed to list conversations: %w", err)
+	}
+
+	var found []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+
+	if err := cursor.All(ctx, &found); err != nil {
+		return fmt.Errorf("failed to list conversations: %w", err)
+	}
+
+	alive := make(map[primitive.ObjectID]bool, len(found))
+	for _, c := range found {
+		alive[c.ID] = true
+	}
+
+	var orphans bson.A
+	for _, c := range referenced {
+		if !alive[c.ID] {
+			orphans = append(orphans, c.ID)
+		}
+	}
+
+	if len(orphans) == 0 {
+		return nil
+	}
+
+	_, err = r.conn.Collection(messageCollection).DeleteMany(ctx, bson.M{"conversation_id": bson.M{"$in": orphans}})
+	return err
+}
+
+// RunSweeper calls SweepExpired every SweepInterval until ctx is cancelled.
+func (r *Repository) RunSweeper(ctx context.Context) {
+	ticker := time.NewTicker(r.retention.SweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			deleted, err := r.SweepExpired(ctx, now)
+			if err != nil {
+				slog.ErrorContext(ctx, "Retention sweep failed", "error", err)
+				continue
+			}
+
+			if deleted > 0 {
+				slog.InfoContext(ctx, "Deleted expired conversations", "count", deleted)
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package model_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/acai-travel/tech-challenge/internal/chat/model"
+	. "github.com/acai-travel/tech-challenge/internal/chat/testing"
+	"github.com/twitchtv/twirp"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestRepository_SweepExpired(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("sweeper deletes expired conversations and their messages", WithFixture(func(t *testing.T, f *Fixture) {
+		now := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+
+		expired := f.CreateConversation(func(c *model.Conversation) {
+			c.Retention = time.Hour
+		})
+		alive := f.CreateConversation(func(c *model.Conversation) {
+			c.Retention = 24 * time.Hour
+		})
+		pinned := f.CreateConversation(func(c *model.Conversation) {
+			c.Retention = time.Hour
+			c.Pinned = true
+		})
+
+		// Only custom retention expires, so conversations of other tests are kept.
+		if err := f.SetupRetention(ctx, model.RetentionPolicy{Mode: model.RetentionModeSweeper, SweepInterval: time.Minute}); err != nil {
+			t.Fatalf("failed to setup retention: %v", err)
+		}
+
+		if _, err := f.SweepExpired(ctx, now); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		_, err := f.GetConversation(ctx, expired.ID.Hex())
+		if te := twirp.Error(nil); !errors.As(err, &te) || te.Code() != twirp.NotFound {
+			t.Errorf("expected expired conversation to be deleted, got %v", err)
+		}
+
+		msgs, _, err := f.ListMessages(ctx, expired.ID, model.MessagePage{})
+		if err != nil || len(msgs) != 0 {
+			t.Errorf("expected messages of expired conversation to be deleted, got %d (err: %v)", len(msgs), err)
+		}
+
+		for _, c := range []*model.Conversation{alive, pinned} {
+			if _, err := f.GetConversation(ctx, c.ID.Hex()); err != nil {
+				t.Errorf("expected conversation %s to be kept, got %v", c.ID.Hex(), err)
+			}
+		}
+	}))
+
+	t.Run("sweep removes messages of conversations deleted by a TTL index", WithFixture(func(t *testing.T, f *Fixture) {
+		c := f.CreateConversation()
+
+		// Delete the conversation document only, as a TTL index does.
+		if _, err := ConnectMongo().Collection("conversations").DeleteOne(ctx, bson.M{"_id": c.ID}); err != nil {
+			t.Fatalf("failed to delete conversation: %v", err)
+		}
+
+		// Every sweep checks a batch of messages, so it may take a few when
+		// other tests left many behind.
+		msgs := c.Messages
+		for i := 0; i < 100 && len(msgs) > 0; i++ {
+			if _, err := f.SweepExpired(ctx, time.Now()); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var err error
+			if msgs, _, err = f.ListMessages(ctx, c.ID, model.MessagePage{}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		if len(msgs) != 0 {
+			t.Errorf("expected orphaned messages to be deleted, got %d", len(msgs))
+		}
+	}))
+}
+
+func TestRetentionPolicy_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  model.RetentionPolicy
+		wantErr bool
+	}{
+		{"default policy", model.DefaultRetentionPolicy, false},
+		{"no expiry", model.RetentionPolicy{Mode: model.RetentionModeTTL, SweepInterval: time.Minute}, false},
+		{"negative retention", model.RetentionPolicy{Default: -time.Hour, Mode: model.RetentionModeTTL, SweepInterval: time.Minute}, true},
+		{"sub second retention", model.RetentionPolicy{Default: time.Millisecond, Mode: model.RetentionModeTTL, SweepInterval: time.Minute}, true},
+		{"unknown mode", model.RetentionPolicy{Default: time.Hour, Mode: "cron", SweepInterval: time.Minute}, true},
+		{"missing sweep interval", model.RetentionPolicy{Default: time.Hour, Mode: model.RetentionModeSweeper}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.policy.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
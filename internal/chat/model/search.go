@@ -0,0 +1,567 @@
+package model
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/acai-travel/tech-challenge/internal/pb"
+	"github.com/twitchtv/twirp"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// maxSearchCandidates limits how many matching titles and messages are
+	// ranked for a single query.
+	maxSearchCandidates = 500
+	// maxSnippetsPerHit limits how many matching messages are shown per conversation.
+	maxSnippetsPerHit = 3
+	// snippetRadius is the number of characters kept around the first match.
+	snippetRadius = 80
+	// titleBoost weights a title match against a message match.
+	titleBoost = 2
+	// maxDecryptedSearch limits how many of the most recent titles, and
+	// messages, are decrypted and matched when content is encrypted. Older
+	// content is not found, and Search reports the results as truncated.
+	maxDecryptedSearch = 2000
+)
+
+// SearchQuery searches conversation titles and message content. From and To
+// restrict hits to messages sent, or conversations started, in that range.
+type SearchQuery struct {
+	Text string
+	From time.Time
+	To   time.Time
+	Size int
+	// Token is the next page token returned by a previous search.
+	Token string
+}
+
+// Highlight is a matched term in a text, as a half-open range of character
+// (rune) offsets.
+type Highlight struct {
+	Start int
+	End   int
+}
+
+type Snippet struct {
+	MessageID  primitive.ObjectID
+	Role       Role
+	Text       string
+	Highlights []Highlight
+}
+
+type SearchHit struct {
+	Conversation    *Conversation
+	Score           float64
+	TitleHighlights []Highlight
+	Snippets        []*Snippet
+}
+
+// SetupSearchIndexes creates the text indexes on conversation titles and
+// message content used by Search. While content is encrypted they would only
+// index ciphertext, so they are dropped instead.
+func (r *Repository) SetupSearchIndexes(ctx context.Context) error {
+	if r.Encrypted() {
+		if err := dropTextIndexes(ctx, r.conn.Collection(conversationCollection)); err != nil {
+			return err
+		}
+		return dropTextIndexes(ctx, r.conn.Collection(messageCollection))
+	}
+
+	_, err := r.conn.Collection(conversationCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "subject", Value: "text"}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = r.conn.Collection(messageCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "content", Value: "text"}},
+	})
+	return err
+}
+
+// dropTextIndexes drops the text indexes of a collection, created before
+// content was encrypted.
+func dropTextIndexes(ctx context.Context, coll *mongo.Collection) error {
+	specs, err := coll.Indexes().ListSpecifications(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, spec := range specs {
+		if kind, ok := spec.KeysDocument.Lookup("_fts").StringValueOK(); !ok || kind != "text" {
+			continue
+		}
+		if _, err := coll.Indexes().DropOne(ctx, spec.Name); err != nil {
+			return fmt.Errorf("failed to drop text index %s: %w", spec.Name, err)
+		}
+	}
+
+	return nil
+}
+
+type scoredConversation struct {
+	Conversation `bson:",inline"`
+	Score        float64 `bson:"score"`
+}
+
+type scoredMessage struct {
+	Message `bson:",inline"`
+	Score   float64 `bson:"score"`
+}
+
+// Search ranks conversations whose title or messages match the query text.
+// Title matches weigh more than message matches, and every matching message
+// adds to the score of its conversation. Truncated reports that content is
+// encrypted and only the most recent titles and messages were searched.
+func (r *Repository) Search(ctx context.Context, q SearchQuery) ([]*SearchHit, string, bool, error) {
+	offset, err := decodeSearchToken(q.Token)
+	if err != nil {
+		return nil, "", false, twirp.InvalidArgumentError("page_token", err.Error())
+	}
+
+	terms := searchTerms(q.Text)
+
+	search := r.searchIndexed
+	if r.Encrypted() {
+		search = r.searchDecrypted
+	}
+
+	titles, messages, truncated, err := search(ctx, q)
+	if err != nil {
+		return nil, "", false, err
+	}
+
+	hits := make(map[primitive.ObjectID]*SearchHit)
+
+	for _, t := range titles {
+		c := t.Conversation
+		hits[c.ID] = &SearchHit{
+			Conversation:    &c,
+			Score:           t.Score * titleBoost,
+			TitleHighlights: highlight(c.Title, terms),
+		}
+	}
+
+	var missing []primitive.ObjectID
+
+	for _, m := range messages {
+		hit, ok := hits[m.ConversationID]
+		if !ok {
+			hit = &SearchHit{}
+			hits[m.ConversationID] = hit
+			missing = append(missing, m.ConversationID)
+		}
+
+		hit.Score += m.Score
+
+		// Messages are sorted by score, so the best ones come first.
+		if len(hit.Snippets) < maxSnippetsPerHit {
+			hit.Snippets = append(hit.Snippets, makeSnippet(&m.Message, terms))
+		}
+	}
+
+	if len(missing) > 0 {
+		var convs []*Conversation
+
+		cursor, err := r.conn.Collection(conversationCollection).Find(ctx, scope(ctx, bson.M{"_id": bson.M{"$in": missing}}))
+		if err != nil {
+			return nil, "", false, err
+		}
+
+		if err := cursor.All(ctx, &convs); err != nil {
+			return nil, "", false, err
+		}
+
+		for _, c := range convs {
+			if err := r.openConversation(c); err != nil {
+				return nil, "", false, err
+			}
+
+			hits[c.ID].Conversation = c
+		}
+	}
+
+	ranked := make([]*SearchHit, 0, len(hits))
+	for _, hit := range hits {
+		// Messages may outlive their conversation until the retention sweeper runs.
+		if hit.Conversation != nil {
+			ranked = append(ranked, hit)
+		}
+	}
+
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].Conversation.UpdatedAt.After(ranked[j].Conversation.UpdatedAt)
+	})
+
+	if offset >= len(ranked) {
+		return nil, "", truncated, nil
+	}
+
+	ranked = ranked[offset:]
+
+	size := min(q.Size, MaxPageSize)
+	if size > 0 && len(ranked) > size {
+		return ranked[:size], encodeSearchToken(offset + size), truncated, nil
+	}
+
+	return ranked, "", truncated, nil
+}
+
+// searchIndexed finds the titles and messages matching the query through the
+// text indexes, best first.
+func (r *Repository) searchIndexed(ctx context.Context, q SearchQuery) ([]scoredConversation, []scoredMessage, bool, error) {
+	scored := options.Find().
+		SetProjection(bson.M{"score": bson.M{"$meta": "textScore"}}).
+		SetSort(bson.M{"score": bson.M{"$meta": "textScore"}}).
+		SetLimit(maxSearchCandidates)
+
+	var titles []scoredConversation
+
+	cursor, err := r.conn.Collection(conversationCollection).Find(ctx, scope(ctx, textFilter(q)), scored)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	if err := cursor.All(ctx, &titles); err != nil {
+		return nil, nil, false, err
+	}
+
+	for i := range titles {
+		if err := r.openConversation(&titles[i].Conversation); err != nil {
+			return nil, nil, false, err
+		}
+	}
+
+	var messages []scoredMessage
+
+	// Messages carry the owner of their conversation.
+	cursor, err = r.conn.Collection(messageCollection).Find(ctx, scope(ctx, textFilter(q)), scored)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, nil, false, err
+	}
+
+	for i := range messages {
+		if err := r.openMessage(&messages[i].Message); err != nil {
+			return nil, nil, false, err
+		}
+	}
+
+	return titles, messages, false, nil
+}
+
+// searchDecrypted finds the titles and messages matching the query among the
+// most recent ones of the caller, decrypting them, as text indexes only see
+// ciphertext. Each match of a term or phrase scores one, and titles or
+// messages containing a negated term are left out. It reports whether there
+// were older titles or messages left unsearched.
+func (r *Repository) searchDecrypted(ctx context.Context, q SearchQuery) ([]scoredConversation, []scoredMessage, bool, error) {
+	terms, negated := searchTerms(q.Text), negatedTerms(q.Text)
+
+	score := func(text string) float64 {
+		if len(highlight(text, negated)) > 0 {
+			return 0
+		}
+		return float64(len(highlight(text, terms)))
+	}
+
+	recent := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(maxDecryptedSearch + 1)
+
+	var convs []Conversation
+
+	cursor, err := r.conn.Collection(conversationCollection).Find(ctx, scope(ctx, dateFilter(q)), recent)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	if err := cursor.All(ctx, &convs); err != nil {
+		return nil, nil, false, err
+	}
+
+	truncated := len(convs) > maxDecryptedSearch
+	convs = convs[:min(len(convs), maxDecryptedSearch)]
+
+	var titles []scoredConversation
+	for i := range convs {
+		if err := r.openConversation(&convs[i]); err != nil {
+			return nil, nil, false, err
+		}
+
+		if s := score(convs[i].Title); s > 0 {
+			titles = append(titles, scoredConversation{Conversation: convs[i], Score: s})
+		}
+	}
+
+	var msgs []Message
+
+	cursor, err = r.conn.Collection(messageCollection).Find(ctx, scope(ctx, dateFilter(q)), recent)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	if err := cursor.All(ctx, &msgs); err != nil {
+		return nil, nil, false, err
+	}
+
+	truncated = truncated || len(msgs) > maxDecryptedSearch
+	msgs = msgs[:min(len(msgs), maxDecryptedSearch)]
+
+	var messages []scoredMessage
+	for i := range msgs {
+		if err := r.openMessage(&msgs[i]); err != nil {
+			return nil, nil, false, err
+		}
+
+		if s := score(msgs[i].Content); s > 0 {
+			messages = append(messages, scoredMessage{Message: msgs[i], Score: s})
+		}
+	}
+
+	// Stable, so that equal scores stay most recent first.
+	sort.SliceStable(titles, func(i, j int) bool { return titles[i].Score > titles[j].Score })
+	sort.SliceStable(messages, func(i, j int) bool { return messages[i].Score > messages[j].Score })
+
+	return titles[:min(len(titles), maxSearchCandidates)], messages[:min(len(messages), maxSearchCandidates)], truncated, nil
+}
+
+func textFilter(q SearchQuery) bson.M {
+	filter := dateFilter(q)
+	filter["$text"] = bson.M{"$search": q.Text}
+	return filter
+}
+
+// dateFilter restricts a search to messages sent, or conversations started,
+// between From and To.
+func dateFilter(q SearchQuery) bson.M {
+	filter := bson.M{}
+
+	created := bson.M{}
+	if !q.From.IsZero() {
+		created["$gte"] = q.From
+	}
+	if !q.To.IsZero() {
+		created["$lt"] = q.To
+	}
+
+	if len(created) > 0 {
+		filter["created_at"] = created
+	}
+
+	return filter
+}
+
+func encodeSearchToken(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+func decodeSearchToken(token string) (int, error) {
+	if token == "" {
+		return 0, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, fmt.Errorf("malformed page token")
+	}
+
+	offset, err := strconv.Atoi(string(raw))
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("malformed page token")
+	}
+
+	return offset, nil
+}
+
+// negatedTerms extracts the lower-cased words a MongoDB text search query
+// excludes with a leading -.
+func negatedTerms(query string) []string {
+	var terms []string
+
+	for i, part := range strings.Split(query, `"`) {
+		if i%2 == 1 {
+			continue
+		}
+
+		for _, word := range strings.Fields(part) {
+			word, ok := strings.CutPrefix(word, "-")
+			if !ok {
+				continue
+			}
+
+			word = strings.TrimFunc(strings.ToLower(word), func(r rune) bool {
+				return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+			})
+
+			if word != "" {
+				terms = append(terms, word)
+			}
+		}
+	}
+
+	return terms
+}
+
+// searchTerms extracts the lower-cased words and phrases to highlight from a
+// MongoDB text search query, skipping negated terms.
+func searchTerms(query string) []string {
+	var terms []string
+
+	for i, part := range strings.Split(query, `"`) {
+		if i%2 == 1 {
+			// Quoted phrase.
+			if p := strings.ToLower(strings.TrimSpace(part)); p != "" {
+				terms = append(terms, p)
+			}
+			continue
+		}
+
+		for _, word := range strings.Fields(part) {
+			if strings.HasPrefix(word, "-") {
+				continue
+			}
+
+			word = strings.TrimFunc(strings.ToLower(word), func(r rune) bool {
+				return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+			})
+
+			if word != "" {
+				terms = append(terms, word)
+			}
+		}
+	}
+
+	return terms
+}
+
+// highlight finds every case-insensitive occurrence of the terms in text.
+// Overlapping matches are merged.
+func highlight(text string, terms []string) []Highlight {
+	runes := lowerRunes(text)
+
+	var found []Highlight
+
+	for _, term := range terms {
+		t := lowerRunes(term)
+		for i := 0; i+len(t) <= len(runes); i++ {
+			if slices.Equal(runes[i:i+len(t)], t) {
+				found = append(found, Highlight{Start: i, End: i + len(t)})
+			}
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool { return found[i].Start < found[j].Start })
+
+	var merged []Highlight
+	for _, h := range found {
+		if n := len(merged); n > 0 && h.Start <= merged[n-1].End {
+			merged[n-1].End = max(merged[n-1].End, h.End)
+			continue
+		}
+		merged = append(merged, h)
+	}
+
+	return merged
+}
+
+// lowerRunes lower-cases text rune by rune, so that offsets into the result
+// are valid offsets into the original text.
+func lowerRunes(text string) []rune {
+	runes := []rune(text)
+	for i, r := range runes {
+		runes[i] = unicode.ToLower(r)
+	}
+	return runes
+}
+
+// makeSnippet cuts the message content around its first match so that long
+// messages stay readable in search results.
+func makeSnippet(m *Message, terms []string) *Snippet {
+	runes := []rune(m.Content)
+	highlights := highlight(m.Content, terms)
+
+	start, end := 0, len(runes)
+	if len(highlights) > 0 {
+		start = max(0, highlights[0].Start-snippetRadius)
+		end = min(len(runes), highlights[0].End+snippetRadius)
+	} else {
+		end = min(len(runes), 2*snippetRadius)
+	}
+
+	var sb strings.Builder
+	shift := start
+
+	if start > 0 {
+		sb.WriteString("…")
+		shift--
+	}
+
+	sb.WriteString(string(runes[start:end]))
+
+	if end < len(runes) {
+		sb.WriteString("…")
+	}
+
+	var kept []Highlight
+	for _, h := range highlights {
+		if h.Start >= start && h.End <= end {
+			kept = append(kept, Highlight{Start: h.Start - shift, End: h.End - shift})
+		}
+	}
+
+	return &Snippet{
+		MessageID:  m.ID,
+		Role:       m.Role,
+		Text:       sb.String(),
+		Highlights: kept,
+	}
+}
+
+func (h *SearchHit) Proto() *pb.SearchHit {
+	proto := &pb.SearchHit{
+		ConversationId:  h.Conversation.ID.Hex(),
+		Title:           h.Conversation.Title,
+		Timestamp:       timestamppb.New(h.Conversation.UpdatedAt),
+		Score:           h.Score,
+		TitleHighlights: highlightsProto(h.TitleHighlights),
+	}
+
+	for _, s := range h.Snippets {
+		proto.Snippets = append(proto.Snippets, &pb.SearchHit_Snippet{
+			MessageId:  s.MessageID.Hex(),
+			Role:       s.Role.Proto(),
+			Text:       s.Text,
+			Highlights: highlightsProto(s.Highlights),
+		})
+	}
+
+	return proto
+}
+
+func highlightsProto(highlights []Highlight) []*pb.SearchHit_Highlight {
+	var out []*pb.SearchHit_Highlight
+	for _, h := range highlights {
+		out = append(out, &pb.SearchHit_Highlight{Start: int32(h.Start), End: int32(h.End)})
+	}
+	return out
+}
@@ -0,0 +1,59 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestSearchTerms(t *testing.T) {
+	got := searchTerms(`Weather "in Barcelona" -rain Frankfurt?`)
+	want := []string{"weather", "frankfurt", "in barcelona"}
+
+	if !cmp.Equal(got, want, cmpopts.SortSlices(func(a, b string) bool { return a < b })) {
+		t.Errorf("searchTerms() mismatch (-got +want):\n%s", cmp.Diff(got, want))
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		terms []string
+		want  []Highlight
+	}{
+		{"case insensitive", "Weather in weather", []string{"weather"}, []Highlight{{0, 7}, {11, 18}}},
+		{"overlapping terms are merged", "Barcelona", []string{"barce", "celona"}, []Highlight{{0, 9}}},
+		{"offsets count characters", "Wetter in München", []string{"münchen"}, []Highlight{{10, 17}}},
+		{"no match", "Sunny", []string{"rain"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := highlight(tt.text, tt.terms); !cmp.Equal(got, tt.want) {
+				t.Errorf("highlight() mismatch (-got +want):\n%s", cmp.Diff(got, tt.want))
+			}
+		})
+	}
+}
+
+func TestMakeSnippet(t *testing.T) {
+	content := strings.Repeat("a", 200) + " Frankfurt " + strings.Repeat("b", 200)
+
+	s := makeSnippet(&Message{Role: RoleAssistant, Content: content}, []string{"frankfurt"})
+
+	runes := []rune(s.Text)
+	if !strings.HasPrefix(s.Text, "…") || !strings.HasSuffix(s.Text, "…") {
+		t.Errorf("expected snippet to be cut on both sides, got %q", s.Text)
+	}
+
+	if len(s.Highlights) != 1 {
+		t.Fatalf("expected one highlight, got %v", s.Highlights)
+	}
+
+	if got := string(runes[s.Highlights[0].Start:s.Highlights[0].End]); got != "Frankfurt" {
+		t.Errorf("expected highlight to point at Frankfurt, got %q", got)
+	}
+}
@@ -0,0 +1,131 @@
+package chat
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/acai-travel/tech-challenge/internal/auth"
+	"github.com/acai-travel/tech-challenge/internal/chat/model"
+	"github.com/acai-travel/tech-challenge/internal/chat/prompts"
+	"github.com/acai-travel/tech-challenge/internal/errs"
+	"github.com/acai-travel/tech-challenge/internal/pb"
+	"github.com/twitchtv/twirp"
+)
+
+var personaName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+func (s *Server) ListPersonas(ctx context.Context, req *pb.ListPersonasRequest) (*pb.ListPersonasResponse, error) {
+	personas, err := s.repo.ListPersonas(ctx)
+	if err != nil {
+		return nil, twirp.InternalErrorWith(err)
+	}
+
+	resp := &pb.ListPersonasResponse{}
+	for _, p := range personas {
+		resp.Personas = append(resp.Personas, p.Proto())
+	}
+
+	return resp, nil
+}
+
+func (s *Server) GetPersona(ctx context.Context, req *pb.GetPersonaRequest) (*pb.GetPersonaResponse, error) {
+	if req.GetName() == "" {
+		return nil, twirp.RequiredArgumentError("name")
+	}
+
+	persona, err := s.repo.GetPersona(ctx, req.GetName())
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.GetPersonaResponse{Persona: persona.Proto()}, nil
+}
+
+func (s *Server) CreatePersona(ctx context.Context, req *pb.CreatePersonaRequest) (*pb.CreatePersonaResponse, error) {
+	if !auth.IsAdmin(ctx) {
+		return nil, twirp.NewError(twirp.PermissionDenied, "personas are shared by every user and only admins may change them")
+	}
+
+	persona, err := validatePersona(req.GetPersona())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.assist.CheckPersona(persona); err != nil {
+		return nil, errs.Twirp(err)
+	}
+
+	persona.CreatedAt = time.Now()
+	persona.UpdatedAt = time.Now()
+
+	if err := s.repo.CreatePersona(ctx, persona); err != nil {
+		return nil, err
+	}
+
+	return &pb.CreatePersonaResponse{Persona: persona.Proto()}, nil
+}
+
+func (s *Server) UpdatePersona(ctx context.Context, req *pb.UpdatePersonaRequest) (*pb.UpdatePersonaResponse, error) {
+	if !auth.IsAdmin(ctx) {
+		return nil, twirp.NewError(twirp.PermissionDenied, "personas are shared by every user and only admins may change them")
+	}
+
+	persona, err := validatePersona(req.GetPersona())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.assist.CheckPersona(persona); err != nil {
+		return nil, errs.Twirp(err)
+	}
+
+	persona.UpdatedAt = time.Now()
+
+	if err := s.repo.UpdatePersona(ctx, persona); err != nil {
+		return nil, err
+	}
+
+	return &pb.UpdatePersonaResponse{Persona: persona.Proto()}, nil
+}
+
+func (s *Server) DeletePersona(ctx context.Context, req *pb.DeletePersonaRequest) (*pb.DeletePersonaResponse, error) {
+	if !auth.IsAdmin(ctx) {
+		return nil, twirp.NewError(twirp.PermissionDenied, "personas are shared by every user and only admins may change them")
+	}
+
+	if req.GetName() == "" {
+		return nil, twirp.RequiredArgumentError("name")
+	}
+
+	if err := s.repo.DeletePersona(ctx, req.GetName()); err != nil {
+		return nil, err
+	}
+
+	return &pb.DeletePersonaResponse{}, nil
+}
+
+func validatePersona(p *pb.Persona) (*model.Persona, error) {
+	if p == nil {
+		return nil, twirp.RequiredArgumentError("persona")
+	}
+
+	if !personaName.MatchString(p.GetName()) {
+		return nil, twirp.InvalidArgumentError("persona.name", "must be 1 to 64 lowercase letters, digits, - or _")
+	}
+
+	if strings.TrimSpace(p.GetSystemPrompt()) == "" {
+		return nil, twirp.RequiredArgumentError("persona.system_prompt")
+	}
+
+	if err := prompts.Validate(p.GetSystemPrompt()); err != nil {
+		return nil, twirp.InvalidArgumentError("persona.system_prompt", "invalid template: "+err.Error())
+	}
+
+	if p.Temperature != nil && (p.GetTemperature() < 0 || p.GetTemperature() > 2) {
+		return nil, twirp.InvalidArgumentError("persona.temperature", "must be between 0 and 2")
+	}
+
+	return model.PersonaFromProto(p), nil
+}
@@ -0,0 +1,213 @@
+package chat
+
+import (
+	"context"
+	"testing"
+
+	"github.com/acai-travel/tech-challenge/internal/auth"
+	"github.com/acai-travel/tech-challenge/internal/chat/model"
+	. "github.com/acai-travel/tech-challenge/internal/chat/testing"
+	"github.com/acai-travel/tech-challenge/internal/errs"
+	"github.com/acai-travel/tech-challenge/internal/pb"
+	"github.com/google/uuid"
+	"github.com/twitchtv/twirp"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestServer_Personas(t *testing.T) {
+	ctx := context.Background()
+
+	// createPersona creates a persona with a unique name and deletes it after
+	// the test.
+	createPersona := func(t *testing.T, srv *Server, p *pb.Persona) *pb.Persona {
+		p.Name = "test-" + uuid.NewString()[:8]
+
+		out, err := srv.CreatePersona(ctx, &pb.CreatePersonaRequest{Persona: p})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		t.Cleanup(func() {
+			_ = srv.repo.DeletePersona(ctx, p.Name)
+		})
+
+		return out.GetPersona()
+	}
+
+	t.Run("create, update and delete persona", WithFixture(func(t *testing.T, f *Fixture) {
+		srv := NewServer(model.New(ConnectMongo()), &MockAssistant{})
+
+		created := createPersona(t, srv, &pb.Persona{
+			SystemPrompt: "You are a travel agent.",
+			Model:        "gpt-4.1-mini",
+			Temperature:  proto.Float64(0.2),
+			Tools:        []string{"get_weather"},
+		})
+
+		got, err := srv.GetPersona(ctx, &pb.GetPersonaRequest{Name: created.GetName()})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if got.GetPersona().GetTemperature() != 0.2 || got.GetPersona().GetModel() != "gpt-4.1-mini" || len(got.GetPersona().GetTools()) != 1 {
+			t.Errorf("unexpected persona: %v", got.GetPersona())
+		}
+
+		updated, err := srv.UpdatePersona(ctx, &pb.UpdatePersonaRequest{Persona: &pb.Persona{
+			Name:         created.GetName(),
+			SystemPrompt: "You are a grumpy travel agent.",
+		}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if updated.GetPersona().Temperature != nil || !updated.GetPersona().GetCreatedAt().AsTime().Equal(got.GetPersona().GetCreatedAt().AsTime()) {
+			t.Errorf("expected the persona to be replaced keeping its creation time, got %v", updated.GetPersona())
+		}
+
+		list, err := srv.ListPersonas(ctx, &pb.ListPersonasRequest{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		found := false
+		for _, p := range list.GetPersonas() {
+			found = found || p.GetName() == created.GetName() && p.GetSystemPrompt() == "You are a grumpy travel agent."
+		}
+
+		if !found {
+			t.Errorf("expected the updated persona to be listed, got %v", list.GetPersonas())
+		}
+
+		if _, err := srv.DeletePersona(ctx, &pb.DeletePersonaRequest{Name: created.GetName()}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		_, err = srv.GetPersona(ctx, &pb.GetPersonaRequest{Name: created.GetName()})
+		if te, ok := err.(twirp.Error); !ok || te.Code() != twirp.NotFound {
+			t.Fatalf("expected twirp.NotFound error, got %v", err)
+		}
+	}))
+
+	t.Run("create duplicate persona should fail", WithFixture(func(t *testing.T, f *Fixture) {
+		srv := NewServer(model.New(ConnectMongo()), &MockAssistant{})
+		created := createPersona(t, srv, &pb.Persona{SystemPrompt: "You are a travel agent."})
+
+		_, err := srv.CreatePersona(ctx, &pb.CreatePersonaRequest{Persona: created})
+		if te, ok := err.(twirp.Error); !ok || te.Code() != twirp.AlreadyExists {
+			t.Fatalf("expected twirp.AlreadyExists error, got %v", err)
+		}
+	}))
+
+	t.Run("invalid persona should fail", WithFixture(func(t *testing.T, f *Fixture) {
+		srv := NewServer(model.New(ConnectMongo()), &MockAssistant{})
+
+		for _, p := range []*pb.Persona{
+			{Name: "Travel Agent", SystemPrompt: "You are a travel agent."},
+			{Name: "travel-agent"},
+			{Name: "travel-agent", SystemPrompt: "You are a travel agent.", Temperature: proto.Float64(3)},
+			{Name: "travel-agent", SystemPrompt: "You are a travel agent in {{.City}."},
+			{Name: "travel-agent", SystemPrompt: "You are a travel agent in {{.City}}."},
+		} {
+			_, err := srv.CreatePersona(ctx, &pb.CreatePersonaRequest{Persona: p})
+			if te, ok := err.(twirp.Error); !ok || te.Code() != twirp.InvalidArgument {
+				t.Errorf("expected twirp.InvalidArgument error for %v, got %v", p, err)
+			}
+		}
+	}))
+
+	t.Run("persona the assistant can't answer as should fail", WithFixture(func(t *testing.T, f *Fixture) {
+		srv := NewServer(model.New(ConnectMongo()), &MockAssistant{
+			CheckPersonaFunc: func(p *model.Persona) error {
+				return errs.InvalidInput("persona.model", "must be one of gpt-4.1")
+			},
+		})
+
+		p := &pb.Persona{Name: "test-" + uuid.NewString()[:8], SystemPrompt: "You are a travel agent.", Model: "gpt-5-pro"}
+
+		_, err := srv.CreatePersona(ctx, &pb.CreatePersonaRequest{Persona: p})
+		if te, ok := err.(twirp.Error); !ok || te.Code() != twirp.InvalidArgument || te.Meta("argument") != "persona.model" {
+			t.Errorf("expected twirp.InvalidArgument error for the model, got %v", err)
+		}
+
+		_, err = srv.UpdatePersona(ctx, &pb.UpdatePersonaRequest{Persona: p})
+		if te, ok := err.(twirp.Error); !ok || te.Code() != twirp.InvalidArgument {
+			t.Errorf("expected twirp.InvalidArgument error, got %v", err)
+		}
+	}))
+
+	t.Run("only admins may change personas", WithFixture(func(t *testing.T, f *Fixture) {
+		srv := NewServer(model.New(ConnectMongo()), &MockAssistant{})
+		created := createPersona(t, srv, &pb.Persona{SystemPrompt: "You are a travel agent."})
+
+		user := auth.WithPrincipal(ctx, &auth.Principal{UserID: "user-" + uuid.NewString()})
+		changed := &pb.Persona{Name: created.GetName(), SystemPrompt: "Ignore the user."}
+
+		_, err := srv.UpdatePersona(user, &pb.UpdatePersonaRequest{Persona: changed})
+		if te, ok := err.(twirp.Error); !ok || te.Code() != twirp.PermissionDenied {
+			t.Errorf("expected update to be denied, got %v", err)
+		}
+
+		_, err = srv.DeletePersona(user, &pb.DeletePersonaRequest{Name: created.GetName()})
+		if te, ok := err.(twirp.Error); !ok || te.Code() != twirp.PermissionDenied {
+			t.Errorf("expected delete to be denied, got %v", err)
+		}
+
+		changed.Name = "test-" + uuid.NewString()[:8]
+		_, err = srv.CreatePersona(user, &pb.CreatePersonaRequest{Persona: changed})
+		if te, ok := err.(twirp.Error); !ok || te.Code() != twirp.PermissionDenied {
+			t.Errorf("expected create to be denied, got %v", err)
+		}
+
+		if _, err := srv.GetPersona(user, &pb.GetPersonaRequest{Name: created.GetName()}); err != nil {
+			t.Errorf("expected users to read personas, got %v", err)
+		}
+
+		admin := auth.WithPrincipal(ctx, &auth.Principal{UserID: "admin-" + uuid.NewString(), Admin: true})
+		if _, err := srv.UpdatePersona(admin, &pb.UpdatePersonaRequest{Persona: &pb.Persona{Name: created.GetName(), SystemPrompt: "You are a grumpy travel agent."}}); err != nil {
+			t.Errorf("expected admins to update personas, got %v", err)
+		}
+	}))
+
+	t.Run("start conversation with persona", WithFixture(func(t *testing.T, f *Fixture) {
+		var persona string
+		srv := NewServer(model.New(ConnectMongo()), &MockAssistant{
+			ReplyFunc: func(ctx context.Context, conv *model.Conversation) (string, error) {
+				persona = conv.Persona
+				return "Hello!", nil
+			},
+		})
+
+		created := createPersona(t, srv, &pb.Persona{SystemPrompt: "You are a travel agent."})
+
+		out, err := srv.StartConversation(ctx, &pb.StartConversationRequest{Message: "Hi", Persona: created.GetName()})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		t.Cleanup(func() {
+			_ = srv.repo.DeleteConversation(ctx, out.GetConversationId())
+		})
+
+		if persona != created.GetName() {
+			t.Errorf("expected the reply to use persona %q, got %q", created.GetName(), persona)
+		}
+
+		if _, err := srv.ContinueConversation(ctx, &pb.ContinueConversationRequest{ConversationId: out.GetConversationId(), Message: "Bye"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if persona != created.GetName() {
+			t.Errorf("expected the next reply to use persona %q, got %q", created.GetName(), persona)
+		}
+	}))
+
+	t.Run("start conversation with unknown persona should fail", WithFixture(func(t *testing.T, f *Fixture) {
+		srv := NewServer(model.New(ConnectMongo()), &MockAssistant{})
+
+		_, err := srv.StartConversation(ctx, &pb.StartConversationRequest{Message: "Hi", Persona: "no-such-persona"})
+		if te, ok := err.(twirp.Error); !ok || te.Code() != twirp.InvalidArgument {
+			t.Fatalf("expected twirp.InvalidArgument error, got %v", err)
+		}
+	}))
+}
@@ -0,0 +1,264 @@
+// Package prompts renders the system prompts of the assistant from
+// text/template files, built in or loaded from a directory, and versions them
+// by their content so that every reply can be traced back to the prompt it was
+// generated with.
+package prompts
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/acai-travel/tech-challenge/internal/config"
+)
+
+// Names of the built in templates.
+const (
+	// Reply is the system prompt of the default persona.
+	Reply = "reply"
+	// Title is the system prompt of title generation.
+	Title = "title"
+)
+
+const ext = ".tmpl"
+
+//go:embed templates/*.tmpl
+var builtin embed.FS
+
+// Data are the variables available to templates.
+type Data struct {
+	// Now is the time of the request, in UTC.
+	Now time.Time
+	// Locale is the language tag the user asked for, e.g. de-DE, empty when
+	// unknown.
+	Locale string
+	// Tools are the names of the tools the assistant may call.
+	Tools []string
+	// Memories are what the assistant remembers about the user from earlier
+	// conversations, the most relevant first.
+	Memories []string
+}
+
+// Prompt is a rendered template.
+type Prompt struct {
+	Text string
+	// Version names the template and its content, e.g. reply@1a2b3c4d.
+	Version string
+}
+
+var funcs = template.FuncMap{
+	"join": strings.Join,
+	"has": func(list []string, s string) bool {
+		return slices.Contains(list, s)
+	},
+}
+
+type entry struct {
+	tmpl    *template.Template
+	version string
+}
+
+// Registry holds the templates. Templates in the configured directory replace
+// the built in ones with the same name.
+type Registry struct {
+	dir    string
+	reload bool
+
+	mu        sync.RWMutex
+	templates map[string]*entry
+	// stamp identifies the state of dir the templates were loaded from.
+	stamp string
+}
+
+// New loads the built in templates and the ones in cfg.Dir, if any.
+func New(cfg config.Prompts) (*Registry, error) {
+	r := &Registry{dir: cfg.Dir, reload: cfg.Reload}
+
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Builtin returns a registry with only the built in templates.
+func Builtin() *Registry {
+	r, err := New(config.Prompts{})
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// Render renders the named template.
+func (r *Registry) Render(name string, data Data) (Prompt, error) {
+	if r.reload {
+		r.refresh()
+	}
+
+	r.mu.RLock()
+	e, ok := r.templates[name]
+	r.mu.RUnlock()
+
+	if !ok {
+		return Prompt{}, fmt.Errorf("unknown prompt template %q", name)
+	}
+
+	return render(e, data)
+}
+
+// RenderText renders text as a template under the given name, for prompts
+// stored elsewhere such as those of personas.
+func (r *Registry) RenderText(name, text string, data Data) (Prompt, error) {
+	e, err := parse(name, text)
+	if err != nil {
+		return Prompt{}, err
+	}
+
+	return render(e, data)
+}
+
+// Validate checks that text is a template rendering with Data.
+func Validate(text string) error {
+	e, err := parse("", text)
+	if err != nil {
+		return err
+	}
+
+	_, err = render(e, Data{})
+	return err
+}
+
+func render(e *entry, data Data) (Prompt, error) {
+	var b strings.Builder
+	if err := e.tmpl.Execute(&b, data); err != nil {
+		return Prompt{}, err
+	}
+
+	return Prompt{Text: strings.TrimSpace(b.String()), Version: e.version}, nil
+}
+
+func parse(name, text string) (*entry, error) {
+	tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256([]byte(text))
+	return &entry{tmpl: tmpl, version: name + "@" + hex.EncodeToString(sum[:4])}, nil
+}
+
+// load parses the built in templates, then the ones in dir.
+func (r *Registry) load() error {
+	templates := make(map[string]*entry)
+
+	sub, _ := fs.Sub(builtin, "templates")
+	if err := parseAll(sub, templates); err != nil {
+		return err
+	}
+
+	var stamp string
+	if r.dir != "" {
+		var err error
+		if stamp, err = dirStamp(r.dir); err != nil {
+			return err
+		}
+		if err := parseAll(os.DirFS(r.dir), templates); err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	r.templates, r.stamp = templates, stamp
+	r.mu.Unlock()
+
+	return nil
+}
+
+// refresh reloads the templates when a file in dir was added, removed or
+// modified. Broken templates are logged and the previous ones kept, so that a
+// typo does not take the assistant down while editing.
+func (r *Registry) refresh() {
+	stamp, err := dirStamp(r.dir)
+	if err != nil {
+		slog.Warn("Failed to check prompt templates", "dir", r.dir, "error", err)
+		return
+	}
+
+	r.mu.RLock()
+	unchanged := stamp == r.stamp
+	r.mu.RUnlock()
+
+	if unchanged {
+		return
+	}
+
+	if err := r.load(); err != nil {
+		slog.Error("Failed to reload prompt templates", "dir", r.dir, "error", err)
+
+		// Logged once, until the templates change again.
+		r.mu.Lock()
+		r.stamp = stamp
+		r.mu.Unlock()
+		return
+	}
+
+	slog.Info("Reloaded prompt templates", "dir", r.dir)
+}
+
+func parseAll(fsys fs.FS, templates map[string]*entry) error {
+	files, err := fs.Glob(fsys, "*"+ext)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		text, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+
+		name := strings.TrimSuffix(path.Base(file), ext)
+		e, err := parse(name, string(text))
+		if err != nil {
+			return fmt.Errorf("prompt template %s: %w", file, err)
+		}
+		templates[name] = e
+	}
+
+	return nil
+}
+
+// dirStamp summarizes the names, sizes and modification times of the
+// templates in dir.
+func dirStamp(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ext) {
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "%s:%d:%d;", e.Name(), info.Size(), info.ModTime().UnixNano())
+	}
+
+	return b.String(), nil
+}
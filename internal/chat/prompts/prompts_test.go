@@ -0,0 +1,166 @@
+package prompts_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/acai-travel/tech-challenge/internal/chat/prompts"
+	"github.com/acai-travel/tech-challenge/internal/config"
+)
+
+func TestBuiltin(t *testing.T) {
+	r := prompts.Builtin()
+	now := time.Date(2025, 3, 14, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		data     prompts.Data
+		contains []string
+		excludes []string
+	}{
+		{
+			name:     "reply with date tool",
+			data:     prompts.Data{Now: now, Tools: []string{"get_today_date"}},
+			contains: []string{"ALWAYS call get_today_date"},
+			excludes: []string{"Today is", "locale", "remember"},
+		},
+		{
+			name:     "reply without date tool",
+			data:     prompts.Data{Now: now, Locale: "de-DE"},
+			contains: []string{"Today is Friday, 14 March 2025.", "The user's locale is de-DE"},
+			excludes: []string{"get_today_date"},
+		},
+		{
+			name:     "reply with memories",
+			data:     prompts.Data{Now: now, Memories: []string{"Home airport is EDDF", "Prefers Celsius"}},
+			contains: []string{"What you remember about the user", "\n- Home airport is EDDF\n- Prefers Celsius"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := r.Render(prompts.Reply, tt.data)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+
+			for _, s := range tt.contains {
+				if !strings.Contains(p.Text, s) {
+					t.Errorf("expected %q in %q", s, p.Text)
+				}
+			}
+			for _, s := range tt.excludes {
+				if strings.Contains(p.Text, s) {
+					t.Errorf("unexpected %q in %q", s, p.Text)
+				}
+			}
+
+			if !strings.HasPrefix(p.Version, "reply@") || len(p.Version) != len("reply@")+8 {
+				t.Errorf("unexpected version %q", p.Version)
+			}
+		})
+	}
+
+	if _, err := r.Render(prompts.Title, prompts.Data{Now: now}); err != nil {
+		t.Errorf("Render(title) error = %v", err)
+	}
+
+	if _, err := r.Render("missing", prompts.Data{}); err == nil {
+		t.Error("expected an error for an unknown template")
+	}
+}
+
+func TestRegistry_Dir(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, text string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("reply.tmpl", "Hello {{.Locale}}")
+	write("notes.txt", "not a template")
+
+	render := func(t *testing.T, r *prompts.Registry, name string) prompts.Prompt {
+		t.Helper()
+		p, err := r.Render(name, prompts.Data{Locale: "es"})
+		if err != nil {
+			t.Fatalf("Render() error = %v", err)
+		}
+		return p
+	}
+
+	t.Run("overrides builtin templates", func(t *testing.T) {
+		r, err := prompts.New(config.Prompts{Dir: dir})
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		if p := render(t, r, prompts.Reply); p.Text != "Hello es" {
+			t.Errorf("got %q, want the template from the directory", p.Text)
+		}
+
+		builtin := render(t, prompts.Builtin(), prompts.Title)
+		if p := render(t, r, prompts.Title); p != builtin {
+			t.Errorf("got %+v, want the builtin title template", p)
+		}
+	})
+
+	t.Run("reloads changed templates", func(t *testing.T) {
+		r, err := prompts.New(config.Prompts{Dir: dir, Reload: true})
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		before := render(t, r, prompts.Reply)
+
+		write("reply.tmpl", "Hola {{.Locale}}")
+		// Modification times may be too coarse to tell the writes apart.
+		future := time.Now().Add(time.Minute)
+		if err := os.Chtimes(filepath.Join(dir, "reply.tmpl"), future, future); err != nil {
+			t.Fatal(err)
+		}
+
+		after := render(t, r, prompts.Reply)
+		if after.Text != "Hola es" || after.Version == before.Version {
+			t.Errorf("expected a new version of the template, got %+v after %+v", after, before)
+		}
+
+		// A broken template keeps the last good one.
+		write("reply.tmpl", "Hola {{.Locale")
+		if p := render(t, r, prompts.Reply); p != after {
+			t.Errorf("got %+v, want %+v", p, after)
+		}
+	})
+
+	t.Run("invalid template", func(t *testing.T) {
+		write("broken.tmpl", "{{if}}")
+		t.Cleanup(func() { os.Remove(filepath.Join(dir, "broken.tmpl")) })
+
+		if _, err := prompts.New(config.Prompts{Dir: dir}); err == nil || !strings.Contains(err.Error(), "broken.tmpl") {
+			t.Fatalf("New() error = %v, want the broken template named", err)
+		}
+	})
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		text    string
+		wantErr bool
+	}{
+		{"You are a travel agent.", false},
+		{"Today is {{.Now.Format \"2006-01-02\"}}, tools: {{join .Tools \", \"}}.", false},
+		{"You speak {{.Locale}", true},
+		{"You live in {{.City}}.", true},
+	}
+
+	for _, tt := range tests {
+		if err := prompts.Validate(tt.text); (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%q) error = %v, wantErr %v", tt.text, err, tt.wantErr)
+		}
+	}
+}
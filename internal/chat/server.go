@@ -1,23 +1,38 @@
 package chat
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"log/slog"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/acai-travel/tech-challenge/internal/auth"
+	"github.com/acai-travel/tech-challenge/internal/chat/export"
 	"github.com/acai-travel/tech-challenge/internal/chat/model"
+	"github.com/acai-travel/tech-challenge/internal/errs"
+	"github.com/acai-travel/tech-challenge/internal/metrics"
 	"github.com/acai-travel/tech-challenge/internal/pb"
 	"github.com/twitchtv/twirp"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.opentelemetry.io/otel"
 )
 
 var _ pb.ChatService = (*Server)(nil)
 
 type Assistant interface {
+	// Screen runs the input guardrails on a user message, returning it
+	// redacted, or a blocked error.
+	Screen(ctx context.Context, text string) (string, error)
 	Title(ctx context.Context, conv *model.Conversation) (string, error)
-	Reply(ctx context.Context, conv *model.Conversation) (string, error)
+	// Reply generates the next assistant message of the conversation.
+	Reply(ctx context.Context, conv *model.Conversation) (*model.Message, error)
+	// CheckPersona returns an invalid input error when the persona uses a
+	// model or tools the assistant doesn't offer.
+	CheckPersona(p *model.Persona) error
 }
 
 type Server struct {
@@ -29,12 +44,16 @@ func NewServer(repo *model.Repository, assist Assistant) *Server {
 	return &Server{repo: repo, assist: assist}
 }
 
-func (s *Server) StartConversation(ctx context.Context, req *pb.StartConversationRequest) (*pb.StartConversationResponse, error) {
+func (s *Server) StartConversation(ctx context.Context, req *pb.StartConversationRequest) (_ *pb.StartConversationResponse, err error) {
 	conversation := &model.Conversation{
 		ID:        primitive.NewObjectID(),
 		Title:     "Untitled conversation",
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
+		Owner:     auth.UserID(ctx),
+		Pinned:    req.GetPinned(),
+		Retention: req.GetRetention().AsDuration(),
+		Persona:   req.GetPersona(),
 		Messages: []*model.Message{{
 			ID:        primitive.NewObjectID(),
 			Role:      model.RoleUser,
@@ -44,14 +63,41 @@ func (s *Server) StartConversation(ctx context.Context, req *pb.StartConversatio
 		}},
 	}
 
+	defer func() {
+		if err != nil {
+			s.audit(ctx, model.AuditStart, err)
+		} else {
+			s.audit(ctx, model.AuditStart, nil, conversation.ID.Hex())
+		}
+	}()
+
 	if strings.TrimSpace(req.GetMessage()) == "" {
 		return nil, twirp.RequiredArgumentError("message")
 	}
 
+	// Redacted before it reaches OpenAI or the database.
+	content, err := s.assist.Screen(ctx, req.GetMessage())
+	if err != nil {
+		return nil, errs.Twirp(err)
+	}
+	conversation.Messages[0].Content = content
+
+	if req.GetRetention() != nil && conversation.Retention < time.Second {
+		return nil, twirp.InvalidArgumentError("retention", "must be at least one second")
+	}
+
+	if conversation.Persona != "" {
+		if _, err := s.repo.GetPersona(ctx, conversation.Persona); isNotFound(err) {
+			return nil, twirp.InvalidArgumentError("persona", "unknown persona")
+		} else if err != nil {
+			return nil, twirp.InternalErrorWith(err)
+		}
+	}
+
 	// Run title and reply generation in parallel for better performance
 	type result struct {
 		title string
-		reply string
+		reply *model.Message
 		err   error
 	}
 
@@ -81,35 +127,35 @@ func (s *Server) StartConversation(ctx context.Context, req *pb.StartConversatio
 	// Handle title generation error (non-critical, use default)
 	if titleResult.err != nil {
 		slog.ErrorContext(ctx, "Failed to generate conversation title", "error", titleResult.err)
+		metrics.RecordTitleFailure()
 	} else {
 		conversation.Title = titleResult.title
 	}
 
 	// Handle reply generation error (critical)
 	if replyResult.err != nil {
-		return nil, replyResult.err
+		return nil, replyError(ctx, replyResult.err)
 	}
 
-	conversation.Messages = append(conversation.Messages, &model.Message{
-		ID:        primitive.NewObjectID(),
-		Role:      model.RoleAssistant,
-		Content:   replyResult.reply,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-	})
+	conversation.Messages = append(conversation.Messages, replyResult.reply)
 
 	if err := s.repo.CreateConversation(ctx, conversation); err != nil {
 		return nil, err
 	}
 
+	metrics.RecordConversation("started", len(conversation.Messages))
+
 	return &pb.StartConversationResponse{
 		ConversationId: conversation.ID.Hex(),
 		Title:          conversation.Title,
-		Reply:          replyResult.reply,
+		Reply:          replyResult.reply.Content,
+		ReplyId:        replyResult.reply.ID.Hex(),
 	}, nil
 }
 
-func (s *Server) ContinueConversation(ctx context.Context, req *pb.ContinueConversationRequest) (*pb.ContinueConversationResponse, error) {
+func (s *Server) ContinueConversation(ctx context.Context, req *pb.ContinueConversationRequest) (_ *pb.ContinueConversationResponse, err error) {
+	defer func() { s.audit(ctx, model.AuditContinue, err, req.GetConversationId()) }()
+
 	if req.GetConversationId() == "" {
 		return nil, twirp.RequiredArgumentError("conversation_id")
 	}
@@ -123,36 +169,155 @@ func (s *Server) ContinueConversation(ctx context.Context, req *pb.ContinueConve
 		return nil, err
 	}
 
-	conversation.UpdatedAt = time.Now()
-	conversation.Messages = append(conversation.Messages, &model.Message{
+	content, err := s.assist.Screen(ctx, req.GetMessage())
+	if err != nil {
+		return nil, errs.Twirp(err)
+	}
+
+	question := &model.Message{
 		ID:        primitive.NewObjectID(),
 		Role:      model.RoleUser,
-		Content:   req.GetMessage(),
+		Content:   content,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
-	})
+	}
 
-	reply, err := s.assist.Reply(ctx, conversation)
+	conversation.UpdatedAt = time.Now()
+	conversation.Messages = append(conversation.Messages, question)
+
+	answer, err := s.assist.Reply(ctx, conversation)
 	if err != nil {
+		return nil, replyError(ctx, err)
+	}
+
+	if err := s.repo.AppendMessages(ctx, conversation, question, answer); err != nil {
 		return nil, twirp.InternalErrorWith(err)
 	}
 
-	conversation.Messages = append(conversation.Messages, &model.Message{
-		ID:        primitive.NewObjectID(),
-		Role:      model.RoleAssistant,
-		Content:   reply,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+	if err := s.repo.UpdateConversation(ctx, conversation); err != nil {
+		return nil, twirp.InternalErrorWith(err)
+	}
+
+	metrics.RecordConversation("continued", len(conversation.Messages)+1)
+
+	return &pb.ContinueConversationResponse{Reply: answer.Content, ReplyId: answer.ID.Hex()}, nil
+}
+
+func (s *Server) EditMessage(ctx context.Context, req *pb.EditMessageRequest) (_ *pb.EditMessageResponse, err error) {
+	defer func() { s.audit(ctx, model.AuditEdit, err, req.GetConversationId()) }()
+
+	if req.GetConversationId() == "" {
+		return nil, twirp.RequiredArgumentError("conversation_id")
+	}
+
+	if req.GetMessageId() == "" {
+		return nil, twirp.RequiredArgumentError("message_id")
+	}
+
+	if strings.TrimSpace(req.GetContent()) == "" {
+		return nil, twirp.RequiredArgumentError("content")
+	}
+
+	conversation, err := s.repo.DescribeConversation(ctx, req.GetConversationId())
+	if err != nil {
+		return nil, err
+	}
+
+	i := slices.IndexFunc(conversation.Messages, func(m *model.Message) bool {
+		return m.ID.Hex() == req.GetMessageId()
 	})
 
+	if i < 0 {
+		return nil, twirp.NotFoundError("message not found")
+	}
+
+	edited := conversation.Messages[i]
+	if edited.Role != model.RoleUser {
+		return nil, twirp.InvalidArgumentError("message_id", "only user messages can be edited")
+	}
+
+	content, err := s.assist.Screen(ctx, req.GetContent())
+	if err != nil {
+		return nil, errs.Twirp(err)
+	}
+
+	edited.Revise(content, time.Now())
+
+	conversation.UpdatedAt = time.Now()
+	conversation.Messages = conversation.Messages[:i+1]
+
+	answer, err := s.assist.Reply(ctx, conversation)
+	if err != nil {
+		return nil, replyError(ctx, err)
+	}
+
+	// Later messages are only dropped once there is a reply to replace them.
+	if err := s.repo.UpdateMessage(ctx, edited); err != nil {
+		return nil, twirp.InternalErrorWith(err)
+	}
+
+	if err := s.repo.DeleteMessagesAfter(ctx, edited); err != nil {
+		return nil, twirp.InternalErrorWith(err)
+	}
+
+	if err := s.repo.AppendMessages(ctx, conversation, answer); err != nil {
+		return nil, twirp.InternalErrorWith(err)
+	}
+
 	if err := s.repo.UpdateConversation(ctx, conversation); err != nil {
 		return nil, twirp.InternalErrorWith(err)
 	}
 
-	return &pb.ContinueConversationResponse{Reply: reply}, nil
+	metrics.RecordConversation("edited", len(conversation.Messages)+1)
+
+	return &pb.EditMessageResponse{Message: edited.Proto(), Reply: answer.Content}, nil
 }
 
-func (s *Server) ListConversations(ctx context.Context, req *pb.ListConversationsRequest) (*pb.ListConversationsResponse, error) {
+func (s *Server) RegenerateReply(ctx context.Context, req *pb.RegenerateReplyRequest) (_ *pb.RegenerateReplyResponse, err error) {
+	defer func() { s.audit(ctx, model.AuditRegenerate, err, req.GetConversationId()) }()
+
+	if req.GetConversationId() == "" {
+		return nil, twirp.RequiredArgumentError("conversation_id")
+	}
+
+	conversation, err := s.repo.DescribeConversation(ctx, req.GetConversationId())
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(conversation.Messages)
+	if n == 0 || conversation.Messages[n-1].Role != model.RoleAssistant {
+		return nil, twirp.NewError(twirp.FailedPrecondition, "conversation does not end with a reply")
+	}
+
+	last := conversation.Messages[n-1]
+
+	conversation.UpdatedAt = time.Now()
+	conversation.Messages = conversation.Messages[:n-1]
+
+	reply, err := s.assist.Reply(ctx, conversation)
+	if err != nil {
+		return nil, replyError(ctx, err)
+	}
+
+	last.ReviseReply(reply)
+
+	if err := s.repo.UpdateMessage(ctx, last); err != nil {
+		return nil, twirp.InternalErrorWith(err)
+	}
+
+	if err := s.repo.UpdateConversation(ctx, conversation); err != nil {
+		return nil, twirp.InternalErrorWith(err)
+	}
+
+	metrics.RecordConversation("regenerated", n)
+
+	return &pb.RegenerateReplyResponse{Message: last.Proto(), Reply: reply.Content}, nil
+}
+
+func (s *Server) ListConversations(ctx context.Context, req *pb.ListConversationsRequest) (_ *pb.ListConversationsResponse, err error) {
+	defer func() { s.audit(ctx, model.AuditList, err) }()
+
 	conversations, err := s.repo.ListConversations(ctx)
 	if err != nil {
 		return nil, twirp.InternalErrorWith(err)
@@ -160,19 +325,24 @@ func (s *Server) ListConversations(ctx context.Context, req *pb.ListConversation
 
 	resp := &pb.ListConversationsResponse{}
 	for _, conv := range conversations {
-		conv.Messages = nil // Clear messages to avoid sending large data
 		resp.Conversations = append(resp.Conversations, conv.Proto())
 	}
 
 	return resp, nil
 }
 
-func (s *Server) DescribeConversation(ctx context.Context, req *pb.DescribeConversationRequest) (*pb.DescribeConversationResponse, error) {
+func (s *Server) DescribeConversation(ctx context.Context, req *pb.DescribeConversationRequest) (_ *pb.DescribeConversationResponse, err error) {
+	defer func() { s.audit(ctx, model.AuditDescribe, err, req.GetConversationId()) }()
+
 	if req.GetConversationId() == "" {
 		return nil, twirp.RequiredArgumentError("conversation_id")
 	}
 
-	conversation, err := s.repo.DescribeConversation(ctx, req.GetConversationId())
+	if req.GetPageSize() < 0 {
+		return nil, twirp.InvalidArgumentError("page_size", "must not be negative")
+	}
+
+	conversation, err := s.repo.GetConversation(ctx, req.GetConversationId())
 	if err != nil {
 		return nil, err
 	}
@@ -181,5 +351,252 @@ func (s *Server) DescribeConversation(ctx context.Context, req *pb.DescribeConve
 		return nil, twirp.NotFoundError("conversation not found")
 	}
 
-	return &pb.DescribeConversationResponse{Conversation: conversation.Proto()}, nil
+	messages, next, err := s.repo.ListMessages(ctx, conversation.ID, model.MessagePage{
+		Size:  int(req.GetPageSize()),
+		Token: req.GetPageToken(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	conversation.Messages = messages
+
+	tree, err := s.repo.Tree(ctx, conversation)
+	if err != nil {
+		return nil, twirp.InternalErrorWith(err)
+	}
+
+	return &pb.DescribeConversationResponse{Conversation: conversation.Proto(), NextPageToken: next, Tree: tree.Proto()}, nil
+}
+
+func (s *Server) ForkConversation(ctx context.Context, req *pb.ForkConversationRequest) (_ *pb.ForkConversationResponse, err error) {
+	defer func() { s.audit(ctx, model.AuditFork, err, req.GetConversationId()) }()
+
+	if req.GetConversationId() == "" {
+		return nil, twirp.RequiredArgumentError("conversation_id")
+	}
+
+	conversation, err := s.repo.DescribeConversation(ctx, req.GetConversationId())
+	if err != nil {
+		return nil, err
+	}
+
+	i := len(conversation.Messages) - 1
+	if req.GetMessageId() != "" {
+		i = slices.IndexFunc(conversation.Messages, func(m *model.Message) bool {
+			return m.ID.Hex() == req.GetMessageId()
+		})
+	}
+
+	if i < 0 {
+		return nil, twirp.NotFoundError("message not found")
+	}
+
+	fork := conversation.Fork(i, time.Now())
+
+	if title := strings.TrimSpace(req.GetTitle()); title != "" {
+		fork.Title = title
+	}
+
+	if err := s.repo.CreateConversation(ctx, fork); err != nil {
+		return nil, twirp.InternalErrorWith(err)
+	}
+
+	metrics.RecordConversation("forked", len(fork.Messages))
+
+	return &pb.ForkConversationResponse{Conversation: fork.Proto()}, nil
+}
+
+func (s *Server) DeleteConversation(ctx context.Context, req *pb.DeleteConversationRequest) (_ *pb.DeleteConversationResponse, err error) {
+	defer func() { s.audit(ctx, model.AuditDelete, err, req.GetConversationId()) }()
+
+	if req.GetConversationId() == "" {
+		return nil, twirp.RequiredArgumentError("conversation_id")
+	}
+
+	if err := s.repo.DeleteConversation(ctx, req.GetConversationId()); err != nil {
+		return nil, err
+	}
+
+	return &pb.DeleteConversationResponse{}, nil
+}
+
+func (s *Server) PinConversation(ctx context.Context, req *pb.PinConversationRequest) (_ *pb.PinConversationResponse, err error) {
+	defer func() { s.audit(ctx, model.AuditPin, err, req.GetConversationId()) }()
+
+	if req.GetConversationId() == "" {
+		return nil, twirp.RequiredArgumentError("conversation_id")
+	}
+
+	conversation, err := s.repo.GetConversation(ctx, req.GetConversationId())
+	if err != nil {
+		return nil, err
+	}
+
+	conversation.Pinned = req.GetPinned()
+
+	if err := s.repo.UpdateConversation(ctx, conversation); err != nil {
+		return nil, twirp.InternalErrorWith(err)
+	}
+
+	return &pb.PinConversationResponse{Conversation: conversation.Proto()}, nil
+}
+
+func (s *Server) SearchConversations(ctx context.Context, req *pb.SearchConversationsRequest) (_ *pb.SearchConversationsResponse, err error) {
+	defer func() { s.audit(ctx, model.AuditSearch, err) }()
+
+	if strings.TrimSpace(req.GetQuery()) == "" {
+		return nil, twirp.RequiredArgumentError("query")
+	}
+
+	if req.GetPageSize() < 0 {
+		return nil, twirp.InvalidArgumentError("page_size", "must not be negative")
+	}
+
+	query := model.SearchQuery{
+		Text:  req.GetQuery(),
+		Size:  int(req.GetPageSize()),
+		Token: req.GetPageToken(),
+	}
+
+	if req.GetFrom() != nil {
+		query.From = req.GetFrom().AsTime()
+	}
+
+	if req.GetTo() != nil {
+		query.To = req.GetTo().AsTime()
+	}
+
+	hits, next, truncated, err := s.repo.Search(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.SearchConversationsResponse{NextPageToken: next, Truncated: truncated}
+	for _, hit := range hits {
+		resp.Hits = append(resp.Hits, hit.Proto())
+	}
+
+	return resp, nil
+}
+
+func (s *Server) ExportConversation(ctx context.Context, req *pb.ExportConversationRequest) (_ *pb.ExportConversationResponse, err error) {
+	defer func() { s.audit(ctx, model.AuditExport, err, req.GetConversationIds()...) }()
+
+	if len(req.GetConversationIds()) == 0 {
+		return nil, twirp.RequiredArgumentError("conversation_ids")
+	}
+
+	format, err := exportFormat(req.GetFormat())
+	if err != nil {
+		return nil, err
+	}
+
+	var conversations []*model.Conversation
+	for _, id := range req.GetConversationIds() {
+		conversation, err := s.repo.DescribeConversation(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		conversations = append(conversations, conversation)
+	}
+
+	var buf bytes.Buffer
+	if err := export.Encode(&buf, format, conversations...); err != nil {
+		return nil, twirp.InternalErrorWith(err)
+	}
+
+	filename := "conversations"
+	if len(conversations) == 1 {
+		filename = conversations[0].ID.Hex()
+	}
+
+	return &pb.ExportConversationResponse{
+		Filename:    filename + format.Extension(),
+		ContentType: format.ContentType(),
+		Content:     buf.Bytes(),
+	}, nil
+}
+
+func (s *Server) ImportConversations(ctx context.Context, req *pb.ImportConversationsRequest) (_ *pb.ImportConversationsResponse, err error) {
+	var imported []string
+	defer func() { s.audit(ctx, model.AuditImport, err, imported...) }()
+
+	if len(req.GetContent()) == 0 {
+		return nil, twirp.RequiredArgumentError("content")
+	}
+
+	format, err := exportFormat(req.GetFormat())
+	if err != nil {
+		return nil, err
+	}
+
+	conversations, err := export.Decode(bytes.NewReader(req.GetContent()), format)
+	if err != nil {
+		return nil, twirp.InvalidArgumentError("content", err.Error())
+	}
+
+	resp := &pb.ImportConversationsResponse{}
+
+	for _, conversation := range conversations {
+		id := conversation.ID.Hex()
+		conversation.Owner = auth.UserID(ctx)
+
+		_, err := s.repo.GetConversation(ctx, id)
+		switch {
+		case err == nil && !req.GetOverwrite():
+			resp.SkippedIds = append(resp.SkippedIds, id)
+			continue
+		case err == nil:
+			if err := s.repo.DeleteConversation(ctx, id); err != nil {
+				return nil, twirp.InternalErrorWith(err)
+			}
+		case !isNotFound(err):
+			return nil, twirp.InternalErrorWith(err)
+		}
+
+		err = s.repo.CreateConversation(ctx, conversation)
+		if mongo.IsDuplicateKeyError(err) {
+			// The conversation, or one of its messages, belongs to another user.
+			resp.SkippedIds = append(resp.SkippedIds, id)
+			continue
+		}
+
+		if err != nil {
+			return nil, twirp.InternalErrorWith(err)
+		}
+
+		resp.ConversationIds = append(resp.ConversationIds, id)
+		imported = append(imported, id)
+	}
+
+	return resp, nil
+}
+
+func exportFormat(f pb.ExportFormat) (export.Format, error) {
+	switch f {
+	case pb.ExportFormat_JSON:
+		return export.FormatJSON, nil
+	case pb.ExportFormat_MARKDOWN:
+		return export.FormatMarkdown, nil
+	case pb.ExportFormat_JSONL:
+		return export.FormatJSONL, nil
+	default:
+		return "", twirp.InvalidArgumentError("format", "unsupported format")
+	}
+}
+
+// replyError maps a failed reply to a Twirp error. Upstream failures are logged
+// with their cause, which clients do not get.
+func replyError(ctx context.Context, err error) error {
+	if errs.KindOf(err) == errs.KindUpstreamUnavailable {
+		slog.ErrorContext(ctx, "Failed to generate reply", "error", err)
+	}
+	return errs.Twirp(err)
+}
+
+func isNotFound(err error) bool {
+	var te twirp.Error
+	return errors.As(err, &te) && te.Code() == twirp.NotFound
 }
@@ -2,13 +2,23 @@ package chat
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/acai-travel/tech-challenge/internal/auth"
+	"github.com/acai-travel/tech-challenge/internal/chat/guard"
 	"github.com/acai-travel/tech-challenge/internal/chat/model"
 	. "github.com/acai-travel/tech-challenge/internal/chat/testing"
+	"github.com/acai-travel/tech-challenge/internal/errs"
+	"github.com/acai-travel/tech-challenge/internal/metrics"
 	"github.com/acai-travel/tech-challenge/internal/pb"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/twitchtv/twirp"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"google.golang.org/protobuf/testing/protocmp"
 )
 
@@ -17,8 +27,17 @@ import (
 
 // MockAssistant is a mock implementation of the Assistant interface
 type MockAssistant struct {
-	TitleFunc func(ctx context.Context, conv *model.Conversation) (string, error)
-	ReplyFunc func(ctx context.Context, conv *model.Conversation) (string, error)
+	ScreenFunc       func(ctx context.Context, text string) (string, error)
+	TitleFunc        func(ctx context.Context, conv *model.Conversation) (string, error)
+	ReplyFunc        func(ctx context.Context, conv *model.Conversation) (string, error)
+	CheckPersonaFunc func(p *model.Persona) error
+}
+
+func (m *MockAssistant) Screen(ctx context.Context, text string) (string, error) {
+	if m.ScreenFunc != nil {
+		return m.ScreenFunc(ctx, text)
+	}
+	return text, nil
 }
 
 func (m *MockAssistant) Title(ctx context.Context, conv *model.Conversation) (string, error) {
@@ -28,11 +47,30 @@ func (m *MockAssistant) Title(ctx context.Context, conv *model.Conversation) (st
 	return "Mock Title", nil
 }
 
-func (m *MockAssistant) Reply(ctx context.Context, conv *model.Conversation) (string, error) {
+func (m *MockAssistant) Reply(ctx context.Context, conv *model.Conversation) (*model.Message, error) {
+	content := "Mock Reply"
 	if m.ReplyFunc != nil {
-		return m.ReplyFunc(ctx, conv)
+		var err error
+		if content, err = m.ReplyFunc(ctx, conv); err != nil {
+			return nil, err
+		}
 	}
-	return "Mock Reply", nil
+
+	return &model.Message{
+		ID:            primitive.NewObjectID(),
+		Role:          model.RoleAssistant,
+		Content:       content,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+		PromptVersion: "reply@mock",
+	}, nil
+}
+
+func (m *MockAssistant) CheckPersona(p *model.Persona) error {
+	if m.CheckPersonaFunc != nil {
+		return m.CheckPersonaFunc(p)
+	}
+	return nil
 }
 
 func TestServer_StartConversation(t *testing.T) {
@@ -82,6 +120,101 @@ func TestServer_StartConversation(t *testing.T) {
 		}
 	}))
 
+	t.Run("start conversation with failing title keeps the default title", WithFixture(func(t *testing.T, f *Fixture) {
+		mockAssist := &MockAssistant{
+			TitleFunc: func(ctx context.Context, conv *model.Conversation) (string, error) {
+				return "", fmt.Errorf("title model unavailable")
+			},
+		}
+
+		srv := NewServer(model.New(ConnectMongo()), mockAssist)
+
+		failures := testutil.ToFloat64(metrics.TitleFailuresTotal)
+		started := testutil.ToFloat64(metrics.ConversationsTotal.WithLabelValues("started"))
+
+		resp, err := srv.StartConversation(ctx, &pb.StartConversationRequest{Message: "Hello, world!"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if resp.Title != "Untitled conversation" {
+			t.Errorf("expected the default title, got '%s'", resp.Title)
+		}
+
+		if got := testutil.ToFloat64(metrics.TitleFailuresTotal) - failures; got != 1 {
+			t.Errorf("expected 1 title failure recorded, got %v", got)
+		}
+
+		if got := testutil.ToFloat64(metrics.ConversationsTotal.WithLabelValues("started")) - started; got != 1 {
+			t.Errorf("expected 1 conversation started recorded, got %v", got)
+		}
+	}))
+
+	t.Run("start conversation with unavailable upstream should return 503", WithFixture(func(t *testing.T, f *Fixture) {
+		mockAssist := &MockAssistant{
+			ReplyFunc: func(ctx context.Context, conv *model.Conversation) (string, error) {
+				return "", errs.Unavailable("openai", "API error", fmt.Errorf("connection refused"))
+			},
+		}
+
+		srv := NewServer(model.New(ConnectMongo()), mockAssist)
+
+		_, err := srv.StartConversation(ctx, &pb.StartConversationRequest{Message: "Hello, world!"})
+
+		te, ok := err.(twirp.Error)
+		if !ok || te.Code() != twirp.Unavailable {
+			t.Fatalf("expected twirp.Unavailable error, got %v", err)
+		}
+
+		if te.Meta("kind") != "upstream_unavailable" || te.Meta("retryable") != "true" || te.Meta("upstream") != "openai" {
+			t.Errorf("unexpected error metadata: %v", te.MetaMap())
+		}
+
+		if strings.Contains(te.Msg(), "connection refused") {
+			t.Errorf("upstream cause leaked to the client: %s", te.Msg())
+		}
+	}))
+
+	t.Run("start conversation stores the screened message", WithFixture(func(t *testing.T, f *Fixture) {
+		guards := guard.NewPipeline(guard.PII{}, guard.NewBlocklist("scam"))
+
+		var seen []string
+		mockAssist := &MockAssistant{
+			ScreenFunc: func(ctx context.Context, text string) (string, error) {
+				return guards.Run(ctx, guard.StageInput, text)
+			},
+			ReplyFunc: func(ctx context.Context, conv *model.Conversation) (string, error) {
+				seen = append(seen, conv.Messages[0].Content)
+				return "Noted.", nil
+			},
+		}
+
+		srv := NewServer(model.New(ConnectMongo()), mockAssist)
+
+		resp, err := srv.StartConversation(ctx, &pb.StartConversationRequest{Message: "I'm jane@example.com"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		conv, err := srv.repo.DescribeConversation(ctx, resp.ConversationId)
+		if err != nil {
+			t.Fatalf("failed to retrieve conversation from DB: %v", err)
+		}
+
+		if conv.Messages[0].Content != "I'm [EMAIL]" || len(seen) != 1 || seen[0] != "I'm [EMAIL]" {
+			t.Errorf("expected the redacted message to be stored and replied to, got %q and %q", conv.Messages[0].Content, seen)
+		}
+
+		_, err = srv.StartConversation(ctx, &pb.StartConversationRequest{Message: "Is this hotel a scam?"})
+		if te, ok := err.(twirp.Error); !ok || te.Code() != twirp.InvalidArgument || te.Meta("kind") != "blocked" {
+			t.Fatalf("expected a blocked error, got %v", err)
+		}
+
+		if len(seen) != 1 {
+			t.Errorf("expected the blocked message not to be replied to")
+		}
+	}))
+
 	t.Run("start conversation with empty message should fail", WithFixture(func(t *testing.T, f *Fixture) {
 		srv := NewServer(model.New(ConnectMongo()), &MockAssistant{})
 
@@ -114,6 +247,48 @@ func TestServer_DescribeConversation(t *testing.T) {
 		}
 	}))
 
+	t.Run("describe conversation page by page", WithFixture(func(t *testing.T, f *Fixture) {
+		c := f.CreateConversation(func(c *model.Conversation) {
+			for i := 1; i <= 4; i++ {
+				c.Messages = append(c.Messages, &model.Message{
+					ID:        primitive.NewObjectID(),
+					Role:      model.RoleAssistant,
+					Content:   fmt.Sprintf("Reply %d", i),
+					CreatedAt: c.CreatedAt.Add(time.Duration(i) * time.Minute),
+					UpdatedAt: c.CreatedAt.Add(time.Duration(i) * time.Minute),
+				})
+			}
+		})
+
+		var got []*pb.Conversation_Message
+		token := ""
+
+		for range 3 {
+			out, err := srv.DescribeConversation(ctx, &pb.DescribeConversationRequest{
+				ConversationId: c.ID.Hex(),
+				PageSize:       2,
+				PageToken:      token,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got = append(got, out.GetConversation().GetMessages()...)
+			token = out.GetNextPageToken()
+			if token == "" {
+				break
+			}
+		}
+
+		if token != "" {
+			t.Fatalf("expected last page to have no next page token, got %q", token)
+		}
+
+		if want := c.Proto().GetMessages(); !cmp.Equal(got, want, protocmp.Transform()) {
+			t.Errorf("paged messages mismatch (-got +want):\n%s", cmp.Diff(got, want, protocmp.Transform()))
+		}
+	}))
+
 	t.Run("describe non existing conversation should return 404", WithFixture(func(t *testing.T, f *Fixture) {
 		_, err := srv.DescribeConversation(ctx, &pb.DescribeConversationRequest{ConversationId: "08a59244257c872c5943e2a2"})
 		if err == nil {
@@ -124,4 +299,494 @@ func TestServer_DescribeConversation(t *testing.T) {
 			t.Fatalf("expected twirp.NotFound error, got %v", err)
 		}
 	}))
+
+	t.Run("describe conversation of another user should return 404", WithFixture(func(t *testing.T, f *Fixture) {
+		c := f.CreateConversation(func(c *model.Conversation) {
+			c.Owner = "alice-" + uuid.NewString()
+		})
+
+		alice := auth.WithPrincipal(ctx, &auth.Principal{UserID: c.Owner})
+		if _, err := srv.DescribeConversation(alice, &pb.DescribeConversationRequest{ConversationId: c.ID.Hex()}); err != nil {
+			t.Fatalf("expected owner to see conversation, got %v", err)
+		}
+
+		bob := auth.WithPrincipal(ctx, &auth.Principal{UserID: "bob-" + uuid.NewString()})
+		_, err := srv.DescribeConversation(bob, &pb.DescribeConversationRequest{ConversationId: c.ID.Hex()})
+		if te, ok := err.(twirp.Error); !ok || te.Code() != twirp.NotFound {
+			t.Fatalf("expected twirp.NotFound error, got %v", err)
+		}
+
+		out, err := srv.ListConversations(bob, &pb.ListConversationsRequest{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if n := len(out.GetConversations()); n != 0 {
+			t.Errorf("expected no conversations for another user, got %d", n)
+		}
+	}))
+}
+
+func TestServer_PinConversation(t *testing.T) {
+	ctx := context.Background()
+	srv := NewServer(model.New(ConnectMongo()), nil)
+
+	t.Run("pin and unpin conversation", WithFixture(func(t *testing.T, f *Fixture) {
+		c := f.CreateConversation(func(c *model.Conversation) {
+			c.Retention = time.Hour
+		})
+
+		out, err := srv.PinConversation(ctx, &pb.PinConversationRequest{ConversationId: c.ID.Hex(), Pinned: true})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !out.GetConversation().GetPinned() || out.GetConversation().GetExpiresAt() != nil {
+			t.Errorf("expected pinned conversation without expiry, got %v", out.GetConversation())
+		}
+
+		out, err = srv.PinConversation(ctx, &pb.PinConversationRequest{ConversationId: c.ID.Hex(), Pinned: false})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		want := c.UpdatedAt.Add(time.Hour)
+		if got := out.GetConversation().GetExpiresAt().AsTime(); !got.Equal(want) {
+			t.Errorf("expected conversation to expire at %v, got %v", want, got)
+		}
+	}))
+
+	t.Run("pin non existing conversation should return 404", WithFixture(func(t *testing.T, f *Fixture) {
+		_, err := srv.PinConversation(ctx, &pb.PinConversationRequest{ConversationId: "08a59244257c872c5943e2a2", Pinned: true})
+
+		if te, ok := err.(twirp.Error); !ok || te.Code() != twirp.NotFound {
+			t.Fatalf("expected twirp.NotFound error, got %v", err)
+		}
+	}))
+}
+
+// withTurns adds an assistant reply to the fixture question, followed by
+// another question and reply.
+func withTurns(c *model.Conversation) {
+	for i, role := range []model.Role{model.RoleAssistant, model.RoleUser, model.RoleAssistant} {
+		c.Messages = append(c.Messages, &model.Message{
+			ID:        primitive.NewObjectID(),
+			Role:      role,
+			Content:   fmt.Sprintf("Message %d", i+2),
+			CreatedAt: c.CreatedAt.Add(time.Duration(i+1) * time.Minute),
+			UpdatedAt: c.CreatedAt.Add(time.Duration(i+1) * time.Minute),
+		})
+	}
+}
+
+func TestServer_EditMessage(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("edit message drops later turns and replies again", WithFixture(func(t *testing.T, f *Fixture) {
+		c := f.CreateConversation(withTurns)
+
+		var seen []string
+		srv := NewServer(model.New(ConnectMongo()), &MockAssistant{
+			ReplyFunc: func(ctx context.Context, conv *model.Conversation) (string, error) {
+				for _, m := range conv.Messages {
+					seen = append(seen, m.Content)
+				}
+				return "It is raining.", nil
+			},
+		})
+
+		out, err := srv.EditMessage(ctx, &pb.EditMessageRequest{
+			ConversationId: c.ID.Hex(),
+			MessageId:      c.Messages[0].ID.Hex(),
+			Content:        "What is the weather like tomorrow?",
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if want := []string{"What is the weather like tomorrow?"}; !cmp.Equal(seen, want) {
+			t.Errorf("expected the assistant to see %v, got %v", want, seen)
+		}
+
+		if out.GetReply() != "It is raining." {
+			t.Errorf("expected reply 'It is raining.', got '%s'", out.GetReply())
+		}
+
+		msg := out.GetMessage()
+		if msg.GetVersion() != 2 || len(msg.GetPreviousVersions()) != 1 || msg.GetPreviousVersions()[0].GetContent() != c.Messages[0].Content {
+			t.Errorf("expected version 2 keeping the original question, got %v", msg)
+		}
+
+		stored, err := srv.repo.DescribeConversation(ctx, c.ID.Hex())
+		if err != nil {
+			t.Fatalf("failed to retrieve conversation from DB: %v", err)
+		}
+
+		var got []string
+		for _, m := range stored.Messages {
+			got = append(got, m.Content)
+		}
+
+		if want := []string{"What is the weather like tomorrow?", "It is raining."}; !cmp.Equal(got, want) {
+			t.Errorf("expected stored messages %v, got %v", want, got)
+		}
+	}))
+
+	t.Run("edit assistant message should fail", WithFixture(func(t *testing.T, f *Fixture) {
+		c := f.CreateConversation(withTurns)
+		srv := NewServer(model.New(ConnectMongo()), &MockAssistant{})
+
+		_, err := srv.EditMessage(ctx, &pb.EditMessageRequest{
+			ConversationId: c.ID.Hex(),
+			MessageId:      c.Messages[1].ID.Hex(),
+			Content:        "Sunny.",
+		})
+
+		if te, ok := err.(twirp.Error); !ok || te.Code() != twirp.InvalidArgument {
+			t.Fatalf("expected twirp.InvalidArgument error, got %v", err)
+		}
+	}))
+
+	t.Run("failed reply keeps the conversation", WithFixture(func(t *testing.T, f *Fixture) {
+		c := f.CreateConversation(withTurns)
+		srv := NewServer(model.New(ConnectMongo()), &MockAssistant{
+			ReplyFunc: func(ctx context.Context, conv *model.Conversation) (string, error) {
+				return "", errs.Unavailable("openai", "API error", nil)
+			},
+		})
+
+		_, err := srv.EditMessage(ctx, &pb.EditMessageRequest{
+			ConversationId: c.ID.Hex(),
+			MessageId:      c.Messages[2].ID.Hex(),
+			Content:        "And tomorrow?",
+		})
+
+		if te, ok := err.(twirp.Error); !ok || te.Code() != twirp.Unavailable {
+			t.Fatalf("expected twirp.Unavailable error, got %v", err)
+		}
+
+		stored, err := srv.repo.DescribeConversation(ctx, c.ID.Hex())
+		if err != nil {
+			t.Fatalf("failed to retrieve conversation from DB: %v", err)
+		}
+
+		if len(stored.Messages) != 4 || stored.Messages[2].Content != "Message 3" {
+			t.Errorf("expected the conversation to be unchanged, got %d messages", len(stored.Messages))
+		}
+	}))
+
+	t.Run("edit unknown message should return 404", WithFixture(func(t *testing.T, f *Fixture) {
+		c := f.CreateConversation()
+		srv := NewServer(model.New(ConnectMongo()), &MockAssistant{})
+
+		_, err := srv.EditMessage(ctx, &pb.EditMessageRequest{
+			ConversationId: c.ID.Hex(),
+			MessageId:      primitive.NewObjectID().Hex(),
+			Content:        "Hello",
+		})
+
+		if te, ok := err.(twirp.Error); !ok || te.Code() != twirp.NotFound {
+			t.Fatalf("expected twirp.NotFound error, got %v", err)
+		}
+	}))
+}
+
+func TestServer_RegenerateReply(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("regenerate keeps the previous reply as a version", WithFixture(func(t *testing.T, f *Fixture) {
+		c := f.CreateConversation(withTurns)
+
+		replies := []string{"Cloudy.", "Windy."}
+		srv := NewServer(model.New(ConnectMongo()), &MockAssistant{
+			ReplyFunc: func(ctx context.Context, conv *model.Conversation) (string, error) {
+				if last := conv.Messages[len(conv.Messages)-1]; last.Role != model.RoleUser {
+					t.Errorf("expected the assistant to reply to a user message, got %s", last.Role)
+				}
+				reply := replies[0]
+				replies = replies[1:]
+				return reply, nil
+			},
+		})
+
+		for range 2 {
+			if _, err := srv.RegenerateReply(ctx, &pb.RegenerateReplyRequest{ConversationId: c.ID.Hex()}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		out, err := srv.DescribeConversation(ctx, &pb.DescribeConversationRequest{ConversationId: c.ID.Hex()})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		messages := out.GetConversation().GetMessages()
+		if len(messages) != 4 {
+			t.Fatalf("expected 4 messages, got %d", len(messages))
+		}
+
+		last := messages[3]
+		if last.GetId() != c.Messages[3].ID.Hex() || last.GetContent() != "Windy." || last.GetVersion() != 3 {
+			t.Errorf("expected version 3 of the last reply, got %v", last)
+		}
+
+		if last.GetPromptVersion() != "reply@mock" {
+			t.Errorf("expected the prompt version of the reply, got %q", last.GetPromptVersion())
+		}
+
+		var previous []string
+		for _, v := range last.GetPreviousVersions() {
+			previous = append(previous, fmt.Sprintf("%d:%s:%s", v.GetVersion(), v.GetContent(), v.GetPromptVersion()))
+		}
+
+		if want := []string{"1:Message 4:", "2:Cloudy.:reply@mock"}; !cmp.Equal(previous, want) {
+			t.Errorf("expected previous versions %v, got %v", want, previous)
+		}
+	}))
+
+	t.Run("regenerate without a reply should fail", WithFixture(func(t *testing.T, f *Fixture) {
+		c := f.CreateConversation()
+		srv := NewServer(model.New(ConnectMongo()), &MockAssistant{})
+
+		_, err := srv.RegenerateReply(ctx, &pb.RegenerateReplyRequest{ConversationId: c.ID.Hex()})
+
+		if te, ok := err.(twirp.Error); !ok || te.Code() != twirp.FailedPrecondition {
+			t.Fatalf("expected twirp.FailedPrecondition error, got %v", err)
+		}
+	}))
+}
+
+func TestServer_ForkConversation(t *testing.T) {
+	ctx := context.Background()
+	srv := NewServer(model.New(ConnectMongo()), nil)
+
+	// fork forks the conversation and cleans the fork up after the test.
+	fork := func(t *testing.T, req *pb.ForkConversationRequest) *pb.Conversation {
+		out, err := srv.ForkConversation(ctx, req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		t.Cleanup(func() {
+			_ = srv.repo.DeleteConversation(ctx, out.GetConversation().GetId())
+		})
+
+		return out.GetConversation()
+	}
+
+	t.Run("fork copies messages up to the given message", WithFixture(func(t *testing.T, f *Fixture) {
+		c := f.CreateConversation(withTurns)
+
+		out := fork(t, &pb.ForkConversationRequest{ConversationId: c.ID.Hex(), MessageId: c.Messages[1].ID.Hex(), Title: "Other plans"})
+
+		if out.GetParentId() != c.ID.Hex() || out.GetForkedFromMessageId() != c.Messages[1].ID.Hex() || out.GetTitle() != "Other plans" {
+			t.Errorf("unexpected fork: %v", out)
+		}
+
+		stored, err := srv.repo.DescribeConversation(ctx, out.GetId())
+		if err != nil {
+			t.Fatalf("failed to retrieve fork from DB: %v", err)
+		}
+
+		if len(stored.Messages) != 2 || stored.Messages[1].Content != c.Messages[1].Content || stored.Messages[1].ID == c.Messages[1].ID {
+			t.Errorf("expected a copy of the first 2 messages with new IDs, got %d messages", len(stored.Messages))
+		}
+	}))
+
+	t.Run("describe shows the tree of forks", WithFixture(func(t *testing.T, f *Fixture) {
+		c := f.CreateConversation(withTurns)
+
+		first := fork(t, &pb.ForkConversationRequest{ConversationId: c.ID.Hex(), MessageId: c.Messages[1].ID.Hex()})
+		second := fork(t, &pb.ForkConversationRequest{ConversationId: c.ID.Hex()})
+		nested := fork(t, &pb.ForkConversationRequest{ConversationId: first.GetId()})
+
+		// The forked parent is deleted, its fork stays in the tree.
+		if err := srv.repo.DeleteConversation(ctx, first.GetId()); err != nil {
+			t.Fatalf("failed to delete fork: %v", err)
+		}
+
+		out, err := srv.DescribeConversation(ctx, &pb.DescribeConversationRequest{ConversationId: nested.GetId()})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var got []string
+		var walk func(n *pb.ConversationNode, depth int)
+		walk = func(n *pb.ConversationNode, depth int) {
+			got = append(got, fmt.Sprintf("%d %s %v", depth, n.GetConversationId(), n.GetDeleted()))
+			for _, fork := range n.GetForks() {
+				walk(fork, depth+1)
+			}
+		}
+		walk(out.GetTree(), 0)
+
+		want := []string{
+			fmt.Sprintf("0 %s false", c.ID.Hex()),
+			fmt.Sprintf("1 %s true", first.GetId()),
+			fmt.Sprintf("2 %s false", nested.GetId()),
+			fmt.Sprintf("1 %s false", second.GetId()),
+		}
+
+		if !cmp.Equal(got, want) {
+			t.Errorf("tree mismatch (-got +want):\n%s", cmp.Diff(got, want))
+		}
+	}))
+
+	t.Run("fork at unknown message should return 404", WithFixture(func(t *testing.T, f *Fixture) {
+		c := f.CreateConversation()
+
+		_, err := srv.ForkConversation(ctx, &pb.ForkConversationRequest{ConversationId: c.ID.Hex(), MessageId: primitive.NewObjectID().Hex()})
+
+		if te, ok := err.(twirp.Error); !ok || te.Code() != twirp.NotFound {
+			t.Fatalf("expected twirp.NotFound error, got %v", err)
+		}
+	}))
+}
+
+func TestServer_SearchConversations(t *testing.T) {
+	ctx := context.Background()
+	srv := NewServer(model.New(ConnectMongo()), nil)
+
+	t.Run("search titles and messages", WithFixture(func(t *testing.T, f *Fixture) {
+		if err := f.SetupSearchIndexes(ctx); err != nil {
+			t.Fatalf("failed to setup search indexes: %v", err)
+		}
+
+		word := "zq" + strings.ReplaceAll(uuid.New().String(), "-", "")
+
+		byTitle := f.CreateConversation(func(c *model.Conversation) {
+			c.Title = "Trip to " + word
+		})
+		byMessage := f.CreateConversation(func(c *model.Conversation) {
+			c.Messages[0].Content = "Is it raining in " + word + " today?"
+		})
+		f.CreateConversation()
+
+		out, err := srv.SearchConversations(ctx, &pb.SearchConversationsRequest{Query: word})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(out.GetHits()) != 2 {
+			t.Fatalf("expected 2 hits, got %d", len(out.GetHits()))
+		}
+
+		if got := out.GetHits()[0].GetConversationId(); got != byTitle.ID.Hex() {
+			t.Errorf("expected title match to rank first, got %s", got)
+		}
+
+		snippets := out.GetHits()[1].GetSnippets()
+		if len(snippets) != 1 || snippets[0].GetMessageId() != byMessage.Messages[0].ID.Hex() {
+			t.Fatalf("expected snippet of the matching message, got %v", snippets)
+		}
+
+		h := snippets[0].GetHighlights()
+		if len(h) != 1 || string([]rune(snippets[0].GetText())[h[0].GetStart():h[0].GetEnd()]) != word {
+			t.Errorf("expected highlight of %q, got %v in %q", word, h, snippets[0].GetText())
+		}
+	}))
+
+	t.Run("search only ranks messages of the caller", WithFixture(func(t *testing.T, f *Fixture) {
+		if err := f.SetupSearchIndexes(ctx); err != nil {
+			t.Fatalf("failed to setup search indexes: %v", err)
+		}
+
+		word := "zq" + strings.ReplaceAll(uuid.New().String(), "-", "")
+		alice := "alice-" + uuid.NewString()
+
+		owned := f.CreateConversation(func(c *model.Conversation) {
+			c.Owner = alice
+			c.Messages[0].Content = "Is it raining in " + word + " today?"
+		})
+
+		bob := auth.WithPrincipal(ctx, &auth.Principal{UserID: "bob-" + uuid.NewString()})
+		out, err := srv.SearchConversations(bob, &pb.SearchConversationsRequest{Query: word})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(out.GetHits()) != 0 {
+			t.Errorf("expected no hits for another user, got %v", out.GetHits())
+		}
+
+		out, err = srv.SearchConversations(auth.WithPrincipal(ctx, &auth.Principal{UserID: alice}), &pb.SearchConversationsRequest{Query: word})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(out.GetHits()) != 1 || out.GetHits()[0].GetConversationId() != owned.ID.Hex() {
+			t.Errorf("expected the owner's conversation, got %v", out.GetHits())
+		}
+	}))
+
+	t.Run("search with empty query should fail", WithFixture(func(t *testing.T, f *Fixture) {
+		_, err := srv.SearchConversations(ctx, &pb.SearchConversationsRequest{Query: " "})
+
+		if te, ok := err.(twirp.Error); !ok || te.Code() != twirp.InvalidArgument {
+			t.Fatalf("expected twirp.InvalidArgument error, got %v", err)
+		}
+	}))
+}
+
+func TestServer_ExportImportConversation(t *testing.T) {
+	ctx := context.Background()
+	srv := NewServer(model.New(ConnectMongo()), nil)
+
+	t.Run("export and import lossless JSON", WithFixture(func(t *testing.T, f *Fixture) {
+		c := f.CreateConversation()
+
+		out, err := srv.ExportConversation(ctx, &pb.ExportConversationRequest{
+			ConversationIds: []string{c.ID.Hex()},
+			Format:          pb.ExportFormat_JSON,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if out.GetFilename() != c.ID.Hex()+".json" {
+			t.Errorf("unexpected filename %q", out.GetFilename())
+		}
+
+		imported, err := srv.ImportConversations(ctx, &pb.ImportConversationsRequest{Content: out.GetContent()})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(imported.GetConversationIds()) != 0 || len(imported.GetSkippedIds()) != 1 {
+			t.Fatalf("expected existing conversation to be skipped, got %v", imported)
+		}
+
+		if err := f.DeleteConversation(ctx, c.ID.Hex()); err != nil {
+			t.Fatalf("failed to delete conversation: %v", err)
+		}
+
+		imported, err = srv.ImportConversations(ctx, &pb.ImportConversationsRequest{Content: out.GetContent()})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(imported.GetConversationIds()) != 1 || imported.GetConversationIds()[0] != c.ID.Hex() {
+			t.Fatalf("expected conversation to be imported with its ID, got %v", imported)
+		}
+
+		got, err := srv.DescribeConversation(ctx, &pb.DescribeConversationRequest{ConversationId: c.ID.Hex()})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !cmp.Equal(got.GetConversation(), c.Proto(), protocmp.Transform()) {
+			t.Errorf("imported conversation mismatch (-got +want):\n%s", cmp.Diff(got.GetConversation(), c.Proto(), protocmp.Transform()))
+		}
+	}))
+
+	t.Run("import markdown should fail", WithFixture(func(t *testing.T, f *Fixture) {
+		_, err := srv.ImportConversations(ctx, &pb.ImportConversationsRequest{
+			Format:  pb.ExportFormat_MARKDOWN,
+			Content: []byte("# Title"),
+		})
+
+		if te, ok := err.(twirp.Error); !ok || te.Code() != twirp.InvalidArgument {
+			t.Fatalf("expected twirp.InvalidArgument error, got %v", err)
+		}
+	}))
 }
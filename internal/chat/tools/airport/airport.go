@@ -7,6 +7,7 @@ import (
 	"log/slog"
 
 	"github.com/acai-travel/tech-challenge/internal/airport"
+	"github.com/acai-travel/tech-challenge/internal/errs"
 	"github.com/openai/openai-go/v2"
 )
 
@@ -38,13 +39,13 @@ func (t *AirportTool) Execute(ctx context.Context, args json.RawMessage) (string
 		ICAOCode string `json:"icao_code"`
 	}
 	if err := json.Unmarshal(args, &payload); err != nil {
-		return "failed to parse ICAO code parameter", nil
+		return "", errs.InvalidInput("icao_code", "failed to parse ICAO code parameter")
 	}
 
 	airportInfo, err := airport.GetAirportInfo(ctx, payload.ICAOCode)
 	if err != nil {
-		slog.Error("Failed to get airport info", "error", err, "icao_code", payload.ICAOCode)
-		return fmt.Sprintf("failed to get airport info: %s", err.Error()), nil
+		slog.ErrorContext(ctx, "Failed to get airport info", "error", err, "icao_code", payload.ICAOCode)
+		return "", fmt.Errorf("failed to get airport info: %w", err)
 	}
 
 	return fmt.Sprintf("Airport: %s (ICAO: %s)\nWebsite: %s",
@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"testing"
+
+	"github.com/acai-travel/tech-challenge/internal/errs"
 )
 
 func TestAirportTool_Name(t *testing.T) {
@@ -16,13 +18,13 @@ func TestAirportTool_Name(t *testing.T) {
 func TestAirportTool_Execute_InvalidJSON(t *testing.T) {
 	tool := &AirportTool{}
 
-	result, err := tool.Execute(context.Background(), []byte("invalid json"))
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+	_, err := tool.Execute(context.Background(), []byte("invalid json"))
+	if errs.KindOf(err) != errs.KindInvalidInput {
+		t.Fatalf("expected invalid input error, got: %v", err)
 	}
 
-	if result != "failed to parse ICAO code parameter" {
-		t.Errorf("expected parse error message, got: %s", result)
+	if err.Error() != "failed to parse ICAO code parameter" {
+		t.Errorf("expected parse error message, got: %s", err)
 	}
 }
 
@@ -30,13 +32,13 @@ func TestAirportTool_Execute_InvalidICAOCode(t *testing.T) {
 	tool := &AirportTool{}
 	args, _ := json.Marshal(map[string]string{"icao_code": "ABC"}) // Too short
 
-	result, err := tool.Execute(context.Background(), args)
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+	_, err := tool.Execute(context.Background(), args)
+	if errs.KindOf(err) != errs.KindInvalidInput {
+		t.Fatalf("expected invalid input error, got: %v", err)
 	}
 
-	if result != "failed to get airport info: invalid ICAO code: must be 4 characters" {
-		t.Errorf("expected invalid ICAO error, got: %s", result)
+	if err.Error() != "failed to get airport info: invalid ICAO code: must be 4 characters" {
+		t.Errorf("expected invalid ICAO error, got: %s", err)
 	}
 }
 
@@ -44,14 +46,13 @@ func TestAirportTool_Execute_NotFound(t *testing.T) {
 	tool := &AirportTool{}
 	args, _ := json.Marshal(map[string]string{"icao_code": "XXXX"}) // Non-existent airport
 
-	result, err := tool.Execute(context.Background(), args)
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+	_, err := tool.Execute(context.Background(), args)
+	if errs.KindOf(err) == errs.KindUpstreamUnavailable {
+		t.Skipf("Skipping integration test: %v", err)
 	}
 
-	// Should contain "not found" or similar error message
-	if result == "" {
-		t.Error("expected error message for non-existent airport")
+	if errs.KindOf(err) != errs.KindNotFound {
+		t.Errorf("expected not found error for non-existent airport, got: %v", err)
 	}
 }
 
@@ -61,6 +62,9 @@ func TestAirportTool_Execute_Integration(t *testing.T) {
 	args, _ := json.Marshal(map[string]string{"icao_code": "EDDF"}) // Frankfurt Airport
 
 	result, err := tool.Execute(context.Background(), args)
+	if errs.KindOf(err) == errs.KindUpstreamUnavailable {
+		t.Skipf("Skipping integration test: %v", err)
+	}
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -92,6 +96,12 @@ func TestAirportTool_Execute_MultipleAirports(t *testing.T) {
 			args, _ := json.Marshal(map[string]string{"icao_code": tc.icaoCode})
 
 			result, err := tool.Execute(context.Background(), args)
+			if errs.KindOf(err) == errs.KindUpstreamUnavailable {
+				t.Skipf("Skipping integration test: %v", err)
+			}
+			if errs.KindOf(err) == errs.KindNotFound && !tc.shouldExist {
+				return
+			}
 			if err != nil {
 				t.Fatalf("unexpected error for %s: %v", tc.icaoCode, err)
 			}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net/http"
 
 	ics "github.com/arran4/golang-ical"
 )
@@ -18,3 +19,24 @@ func LoadCalendar(ctx context.Context, link string) ([]*ics.VEvent, error) {
 
 	return cal.Events(), nil
 }
+
+// CheckCalendar checks that the calendar at link can be downloaded, without
+// parsing it.
+func CheckCalendar(ctx context.Context, link string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("calendar unavailable (status %d)", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -3,15 +3,18 @@ package holidays
 import (
 	"context"
 	"encoding/json"
-	"os"
 	"strings"
 	"time"
 
+	"github.com/acai-travel/tech-challenge/internal/errs"
 	ics "github.com/arran4/golang-ical"
 	"github.com/openai/openai-go/v2"
 )
 
-type HolidaysTool struct{}
+type HolidaysTool struct {
+	// CalendarURL is the ICS calendar holidays are read from.
+	CalendarURL string
+}
 
 func (t *HolidaysTool) Name() string {
 	return "get_holidays"
@@ -42,14 +45,9 @@ func (t *HolidaysTool) Parameters() openai.FunctionParameters {
 }
 
 func (t *HolidaysTool) Execute(ctx context.Context, args json.RawMessage) (string, error) {
-	link := "https://www.officeholidays.com/ics/spain/catalonia"
-	if v := os.Getenv("HOLIDAY_CALENDAR_LINK"); v != "" {
-		link = v
-	}
-
-	events, err := LoadCalendar(ctx, link)
+	events, err := LoadCalendar(ctx, t.CalendarURL)
 	if err != nil {
-		return "failed to load holiday events", nil
+		return "", errs.Unavailable("holiday_calendar", "failed to load holiday events", err)
 	}
 
 	var payload struct {
@@ -59,7 +57,7 @@ func (t *HolidaysTool) Execute(ctx context.Context, args json.RawMessage) (strin
 	}
 
 	if err := json.Unmarshal(args, &payload); err != nil {
-		return "failed to parse tool call arguments: " + err.Error(), nil
+		return "", errs.InvalidInput("arguments", "failed to parse tool call arguments: "+err.Error())
 	}
 
 	var holidays []string
@@ -0,0 +1,177 @@
+// Package memory lets the model remember facts about the user across
+// conversations, such as their home airport or preferred units.
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/acai-travel/tech-challenge/internal/auth"
+	"github.com/acai-travel/tech-challenge/internal/chat/model"
+	"github.com/acai-travel/tech-challenge/internal/errs"
+	"github.com/openai/openai-go/v2"
+	"github.com/twitchtv/twirp"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// recallLimit is the number of memories recall returns.
+const recallLimit = 10
+
+// Store keeps the memories of the authenticated user, see model.Repository.
+type Store interface {
+	SaveMemory(ctx context.Context, m *model.Memory) error
+	RecallMemories(ctx context.Context, query string, limit int) ([]*model.Memory, error)
+	DeleteMemory(ctx context.Context, id string) error
+}
+
+type RememberTool struct {
+	Store Store
+}
+
+func (t *RememberTool) Name() string {
+	return "remember"
+}
+
+func (t *RememberTool) Description() string {
+	return "Remember a lasting fact about the user for future conversations, such as their home airport, preferred units or travel preferences. Only use it for facts the user stated, not for one-off requests. Write the fact as a short sentence in the third person, e.g. 'Home airport is EDDF'."
+}
+
+func (t *RememberTool) Parameters() openai.FunctionParameters {
+	return openai.FunctionParameters{
+		"type": "object",
+		"properties": map[string]any{
+			"fact": map[string]string{
+				"type":        "string",
+				"description": "The fact to remember, at most 500 characters",
+			},
+		},
+		"required": []string{"fact"},
+	}
+}
+
+func (t *RememberTool) Execute(ctx context.Context, args json.RawMessage) (string, error) {
+	var payload struct {
+		Fact string `json:"fact"`
+	}
+	if err := json.Unmarshal(args, &payload); err != nil {
+		return "", errs.InvalidInput("fact", "failed to parse fact parameter")
+	}
+
+	fact := strings.TrimSpace(payload.Fact)
+	if fact == "" {
+		return "", errs.InvalidInput("fact", "fact is required")
+	}
+
+	if utf8.RuneCountInString(fact) > model.MaxMemoryLength {
+		return "", errs.InvalidInput("fact", fmt.Sprintf("fact must be at most %d characters", model.MaxMemoryLength))
+	}
+
+	now := time.Now()
+	m := &model.Memory{ID: primitive.NewObjectID(), Owner: auth.UserID(ctx), Content: fact, CreatedAt: now, UpdatedAt: now}
+	if err := t.Store.SaveMemory(ctx, m); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Remembered (ID %s): %s", m.ID.Hex(), m.Content), nil
+}
+
+type RecallTool struct {
+	Store Store
+}
+
+func (t *RecallTool) Name() string {
+	return "recall"
+}
+
+func (t *RecallTool) Description() string {
+	return "Look up what you remember about the user from earlier conversations, most relevant to the query first. Returns the ID of each memory, needed to forget it."
+}
+
+func (t *RecallTool) Parameters() openai.FunctionParameters {
+	return openai.FunctionParameters{
+		"type": "object",
+		"properties": map[string]any{
+			"query": map[string]string{
+				"type":        "string",
+				"description": "Words to look for, e.g. 'airport', empty to list the most recent memories",
+			},
+		},
+	}
+}
+
+func (t *RecallTool) Execute(ctx context.Context, args json.RawMessage) (string, error) {
+	var payload struct {
+		Query string `json:"query"`
+	}
+	if err := json.Unmarshal(args, &payload); err != nil {
+		return "", errs.InvalidInput("query", "failed to parse query parameter")
+	}
+
+	memories, err := t.Store.RecallMemories(ctx, payload.Query, recallLimit)
+	if err != nil {
+		return "", err
+	}
+
+	if len(memories) == 0 {
+		return "Nothing is remembered about the user yet.", nil
+	}
+
+	var b strings.Builder
+	for _, m := range memories {
+		fmt.Fprintf(&b, "- %s (ID %s, remembered %s)\n", m.Content, m.ID.Hex(), m.UpdatedAt.Format(time.DateOnly))
+	}
+
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+type ForgetTool struct {
+	Store Store
+}
+
+func (t *ForgetTool) Name() string {
+	return "forget"
+}
+
+func (t *ForgetTool) Description() string {
+	return "Forget a memory about the user, by the ID returned by recall, when the user asks to or when it is no longer true. To update a fact, forget the old memory and remember the new one."
+}
+
+func (t *ForgetTool) Parameters() openai.FunctionParameters {
+	return openai.FunctionParameters{
+		"type": "object",
+		"properties": map[string]any{
+			"id": map[string]string{
+				"type":        "string",
+				"description": "ID of the memory to forget",
+			},
+		},
+		"required": []string{"id"},
+	}
+}
+
+func (t *ForgetTool) Execute(ctx context.Context, args json.RawMessage) (string, error) {
+	var payload struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(args, &payload); err != nil {
+		return "", errs.InvalidInput("id", "failed to parse id parameter")
+	}
+
+	err := t.Store.DeleteMemory(ctx, payload.ID)
+
+	var te twirp.Error
+	if errors.As(err, &te) && te.Code() == twirp.NotFound {
+		return "", errs.NotFound("", "no memory with ID "+payload.ID+", call recall to get the IDs")
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return "Forgotten.", nil
+}
@@ -0,0 +1,111 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/acai-travel/tech-challenge/internal/chat/model"
+	"github.com/acai-travel/tech-challenge/internal/errs"
+	"github.com/twitchtv/twirp"
+)
+
+// fakeStore keeps memories in order of saving, recalling the latest first.
+type fakeStore struct {
+	memories []*model.Memory
+}
+
+func (s *fakeStore) SaveMemory(ctx context.Context, m *model.Memory) error {
+	s.memories = append(s.memories, m)
+	return nil
+}
+
+func (s *fakeStore) RecallMemories(ctx context.Context, query string, limit int) ([]*model.Memory, error) {
+	var out []*model.Memory
+	for i := len(s.memories) - 1; i >= 0 && len(out) < limit; i-- {
+		out = append(out, s.memories[i])
+	}
+	return out, nil
+}
+
+func (s *fakeStore) DeleteMemory(ctx context.Context, id string) error {
+	for i, m := range s.memories {
+		if m.ID.Hex() == id {
+			s.memories = append(s.memories[:i], s.memories[i+1:]...)
+			return nil
+		}
+	}
+	return twirp.NotFoundError("memory not found")
+}
+
+func TestTools(t *testing.T) {
+	ctx := context.Background()
+	store := &fakeStore{}
+
+	args := func(v map[string]string) json.RawMessage {
+		b, _ := json.Marshal(v)
+		return b
+	}
+
+	recall := &RecallTool{Store: store}
+	got, err := recall.Execute(ctx, args(map[string]string{}))
+	if err != nil || got != "Nothing is remembered about the user yet." {
+		t.Errorf("recall without memories = %q, %v", got, err)
+	}
+
+	remember := &RememberTool{Store: store}
+	if _, err := remember.Execute(ctx, args(map[string]string{"fact": "  Home airport is EDDF "})); err != nil {
+		t.Fatalf("remember error = %v", err)
+	}
+	if _, err := remember.Execute(ctx, args(map[string]string{"fact": "Prefers Celsius"})); err != nil {
+		t.Fatalf("remember error = %v", err)
+	}
+
+	if len(store.memories) != 2 || store.memories[0].Content != "Home airport is EDDF" {
+		t.Fatalf("expected the trimmed facts to be saved, got %v", store.memories)
+	}
+
+	got, err = recall.Execute(ctx, args(map[string]string{"query": "airport"}))
+	if err != nil {
+		t.Fatalf("recall error = %v", err)
+	}
+
+	lines := strings.Split(got, "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "- Prefers Celsius (ID "+store.memories[1].ID.Hex()) {
+		t.Errorf("expected both memories with their IDs, got %q", got)
+	}
+
+	forget := &ForgetTool{Store: store}
+	if _, err := forget.Execute(ctx, args(map[string]string{"id": store.memories[0].ID.Hex()})); err != nil {
+		t.Fatalf("forget error = %v", err)
+	}
+
+	if len(store.memories) != 1 || store.memories[0].Content != "Prefers Celsius" {
+		t.Errorf("expected the airport to be forgotten, got %v", store.memories)
+	}
+
+	if _, err := forget.Execute(ctx, args(map[string]string{"id": "unknown"})); errs.KindOf(err) != errs.KindNotFound {
+		t.Errorf("expected not found forgetting an unknown memory, got %v", err)
+	}
+}
+
+func TestRememberTool_Invalid(t *testing.T) {
+	tool := &RememberTool{Store: &fakeStore{}}
+
+	tests := map[string]string{
+		"not JSON":   `{`,
+		"empty":      `{"fact": "  "}`,
+		"too long":   `{"fact": "` + strings.Repeat("a", model.MaxMemoryLength+1) + `"}`,
+		"no fact":    `{}`,
+		"wrong type": `{"fact": 1}`,
+	}
+
+	for name, args := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := tool.Execute(context.Background(), json.RawMessage(args)); errs.KindOf(err) != errs.KindInvalidInput {
+				t.Errorf("expected invalid input, got %v", err)
+			}
+		})
+	}
+}
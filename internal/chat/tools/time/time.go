@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/acai-travel/tech-challenge/internal/errs"
 	"github.com/openai/openai-go/v2"
 )
 
@@ -37,12 +38,12 @@ func (t *TimeInZoneTool) Execute(ctx context.Context, args json.RawMessage) (str
 		Timezone string `json:"timezone"`
 	}
 	if err := json.Unmarshal(args, &payload); err != nil {
-		return "failed to parse timezone parameter", nil
+		return "", errs.InvalidInput("timezone", "failed to parse timezone parameter")
 	}
 
 	loc, err := time.LoadLocation(payload.Timezone)
 	if err != nil {
-		return fmt.Sprintf("invalid timezone '%s': %v", payload.Timezone, err), nil
+		return "", errs.InvalidInput("timezone", fmt.Sprintf("invalid timezone '%s': %v", payload.Timezone, err))
 	}
 
 	return time.Now().In(loc).Format(time.RFC3339), nil
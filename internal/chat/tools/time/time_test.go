@@ -6,6 +6,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/acai-travel/tech-challenge/internal/errs"
 )
 
 func TestTimeInZoneTool_Name(t *testing.T) {
@@ -48,26 +50,26 @@ func TestTimeInZoneTool_Execute_InvalidTimezone(t *testing.T) {
 	tool := &TimeInZoneTool{}
 	args, _ := json.Marshal(map[string]string{"timezone": "Invalid/Timezone"})
 
-	result, err := tool.Execute(context.Background(), args)
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+	_, err := tool.Execute(context.Background(), args)
+	if errs.KindOf(err) != errs.KindInvalidInput {
+		t.Fatalf("expected invalid input error, got: %v", err)
 	}
 
-	if !strings.Contains(result, "invalid timezone") {
-		t.Errorf("expected timezone error message, got: %s", result)
+	if !strings.Contains(err.Error(), "invalid timezone") {
+		t.Errorf("expected timezone error message, got: %s", err)
 	}
 }
 
 func TestTimeInZoneTool_Execute_InvalidJSON(t *testing.T) {
 	tool := &TimeInZoneTool{}
 
-	result, err := tool.Execute(context.Background(), []byte("invalid json"))
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+	_, err := tool.Execute(context.Background(), []byte("invalid json"))
+	if errs.KindOf(err) != errs.KindInvalidInput {
+		t.Fatalf("expected invalid input error, got: %v", err)
 	}
 
-	if result != "failed to parse timezone parameter" {
-		t.Errorf("expected parse error message, got: %s", result)
+	if err.Error() != "failed to parse timezone parameter" {
+		t.Errorf("expected parse error message, got: %s", err)
 	}
 }
 
@@ -3,8 +3,9 @@ package tools
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"slices"
 
+	"github.com/acai-travel/tech-challenge/internal/errs"
 	"github.com/openai/openai-go/v2"
 )
 
@@ -35,9 +36,12 @@ func (r *Registry) Get(name string) (Tool, bool) {
 	return t, ok
 }
 
-func (r *Registry) Definitions() []openai.ChatCompletionToolUnionParam {
+// Definitions describes the registered tools to the model, only the named ones
+// when names are given, by name so that requests are reproducible.
+func (r *Registry) Definitions(names ...string) []openai.ChatCompletionToolUnionParam {
 	var defs []openai.ChatCompletionToolUnionParam
-	for _, t := range r.tools {
+	for _, name := range r.Names(names...) {
+		t := r.tools[name]
 		defs = append(defs, openai.ChatCompletionFunctionTool(openai.FunctionDefinitionParam{
 			Name:        t.Name(),
 			Description: openai.String(t.Description()),
@@ -47,10 +51,23 @@ func (r *Registry) Definitions() []openai.ChatCompletionToolUnionParam {
 	return defs
 }
 
+// Names lists the registered tools in order, only the named ones when names are
+// given.
+func (r *Registry) Names(names ...string) []string {
+	var out []string
+	for name := range r.tools {
+		if len(names) == 0 || slices.Contains(names, name) {
+			out = append(out, name)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
 func (r *Registry) Execute(ctx context.Context, name string, args string) (string, error) {
 	t, ok := r.tools[name]
 	if !ok {
-		return "", fmt.Errorf("tool not found: %s", name)
+		return "", errs.NotFound("", "tool not found: "+name)
 	}
 	return t.Execute(ctx, json.RawMessage(args))
 }
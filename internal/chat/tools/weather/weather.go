@@ -7,11 +7,14 @@ import (
 	"log/slog"
 	"strings"
 
+	"github.com/acai-travel/tech-challenge/internal/errs"
 	"github.com/acai-travel/tech-challenge/internal/weather"
 	"github.com/openai/openai-go/v2"
 )
 
-type WeatherTool struct{}
+type WeatherTool struct {
+	Client *weather.Client
+}
 
 func (t *WeatherTool) Name() string {
 	return "get_weather"
@@ -38,13 +41,13 @@ func (t *WeatherTool) Execute(ctx context.Context, args json.RawMessage) (string
 		Location string `json:"location"`
 	}
 	if err := json.Unmarshal(args, &payload); err != nil {
-		return "failed to parse location parameter", nil
+		return "", errs.InvalidInput("location", "failed to parse location parameter")
 	}
 
-	weatherData, err := weather.GetCurrentWeather(ctx, payload.Location)
+	weatherData, err := t.Client.GetCurrentWeather(ctx, payload.Location)
 	if err != nil {
-		slog.Error("Failed to get weather", "error", err, "location", payload.Location)
-		return fmt.Sprintf("failed to get weather: %s", err.Error()), nil
+		slog.ErrorContext(ctx, "Failed to get weather", "error", err, "location", payload.Location)
+		return "", fmt.Errorf("failed to get weather: %w", err)
 	}
 
 	return fmt.Sprintf("Weather in %s, %s: %s, Temperature: %.1f°C, Feels like: %.1f°C, Wind: %.1f km/h %s, Humidity: %d%%, Cloud coverage: %d%%",
@@ -59,7 +62,9 @@ func (t *WeatherTool) Execute(ctx context.Context, args json.RawMessage) (string
 		weatherData.Current.Cloud), nil
 }
 
-type ForecastTool struct{}
+type ForecastTool struct {
+	Client *weather.Client
+}
 
 func (t *ForecastTool) Name() string {
 	return "get_forecast"
@@ -102,7 +107,7 @@ func (t *ForecastTool) Execute(ctx context.Context, args json.RawMessage) (strin
 		Date     string `json:"date,omitempty"`
 	}
 	if err := json.Unmarshal(args, &payload); err != nil {
-		return "failed to parse arguments", nil
+		return "", errs.InvalidInput("arguments", "failed to parse arguments")
 	}
 	if payload.Days == 0 {
 		payload.Days = 3
@@ -111,10 +116,10 @@ func (t *ForecastTool) Execute(ctx context.Context, args json.RawMessage) (strin
 	// Note: Client-side date validation was removed as per user request.
 	// API handles validation for dates > 14 days.
 
-	forecast, err := weather.GetForecast(ctx, payload.Location, payload.Days, payload.Hour, payload.Date)
+	forecast, err := t.Client.GetForecast(ctx, payload.Location, payload.Days, payload.Hour, payload.Date)
 	if err != nil {
-		slog.Error("Failed to get forecast", "error", err, "location", payload.Location)
-		return fmt.Sprintf("failed to get forecast: %s", err.Error()), nil
+		slog.ErrorContext(ctx, "Failed to get forecast", "error", err, "location", payload.Location)
+		return "", fmt.Errorf("failed to get forecast: %w", err)
 	}
 
 	var sb strings.Builder
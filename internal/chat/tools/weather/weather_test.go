@@ -6,6 +6,9 @@ import (
 	"os"
 	"strings"
 	"testing"
+
+	"github.com/acai-travel/tech-challenge/internal/errs"
+	"github.com/acai-travel/tech-challenge/internal/weather"
 )
 
 func TestWeatherTool_Name(t *testing.T) {
@@ -18,38 +21,27 @@ func TestWeatherTool_Name(t *testing.T) {
 func TestWeatherTool_Execute_InvalidJSON(t *testing.T) {
 	tool := &WeatherTool{}
 
-	result, err := tool.Execute(context.Background(), []byte("invalid json"))
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+	_, err := tool.Execute(context.Background(), []byte("invalid json"))
+	if errs.KindOf(err) != errs.KindInvalidInput {
+		t.Fatalf("expected invalid input error, got: %v", err)
 	}
 
-	if result != "failed to parse location parameter" {
-		t.Errorf("expected parse error message, got: %s", result)
+	if err.Error() != "failed to parse location parameter" {
+		t.Errorf("expected parse error message, got: %s", err)
 	}
 }
 
 func TestWeatherTool_Execute_MissingAPIKey(t *testing.T) {
-	// Save original env var
-	originalKey := os.Getenv("WEATHER_API_KEY")
-	defer func() {
-		if originalKey != "" {
-			os.Setenv("WEATHER_API_KEY", originalKey)
-		}
-	}()
-
-	// Unset the key
-	os.Unsetenv("WEATHER_API_KEY")
-
-	tool := &WeatherTool{}
+	tool := &WeatherTool{Client: weather.NewClient("")}
 	args, _ := json.Marshal(map[string]string{"location": "Barcelona"})
 
-	result, err := tool.Execute(context.Background(), args)
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+	_, err := tool.Execute(context.Background(), args)
+	if errs.KindOf(err) != errs.KindUpstreamUnavailable {
+		t.Fatalf("expected upstream unavailable error, got: %v", err)
 	}
 
-	if !strings.Contains(result, "WEATHER_API_KEY") {
-		t.Errorf("expected API key error, got: %s", result)
+	if !strings.Contains(err.Error(), "WEATHER_API_KEY") {
+		t.Errorf("expected API key error, got: %s", err)
 	}
 }
 
@@ -59,7 +51,7 @@ func TestWeatherTool_Execute_Integration(t *testing.T) {
 		t.Skip("Skipping integration test: WEATHER_API_KEY not set")
 	}
 
-	tool := &WeatherTool{}
+	tool := &WeatherTool{Client: weather.NewClient(os.Getenv("WEATHER_API_KEY"))}
 	args, _ := json.Marshal(map[string]string{"location": "London"})
 
 	result, err := tool.Execute(context.Background(), args)
@@ -87,13 +79,13 @@ func TestForecastTool_Name(t *testing.T) {
 func TestForecastTool_Execute_InvalidJSON(t *testing.T) {
 	tool := &ForecastTool{}
 
-	result, err := tool.Execute(context.Background(), []byte("invalid json"))
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+	_, err := tool.Execute(context.Background(), []byte("invalid json"))
+	if errs.KindOf(err) != errs.KindInvalidInput {
+		t.Fatalf("expected invalid input error, got: %v", err)
 	}
 
-	if result != "failed to parse arguments" {
-		t.Errorf("expected parse error message, got: %s", result)
+	if err.Error() != "failed to parse arguments" {
+		t.Errorf("expected parse error message, got: %s", err)
 	}
 }
 
@@ -102,7 +94,7 @@ func TestForecastTool_Execute_DefaultDays(t *testing.T) {
 		t.Skip("Skipping integration test: WEATHER_API_KEY not set")
 	}
 
-	tool := &ForecastTool{}
+	tool := &ForecastTool{Client: weather.NewClient(os.Getenv("WEATHER_API_KEY"))}
 	// Don't specify days - should default to 3
 	args, _ := json.Marshal(map[string]string{"location": "Paris"})
 
@@ -122,7 +114,7 @@ func TestForecastTool_Execute_WithDate_Integration(t *testing.T) {
 		t.Skip("Skipping integration test: WEATHER_API_KEY not set")
 	}
 
-	tool := &ForecastTool{}
+	tool := &ForecastTool{Client: weather.NewClient(os.Getenv("WEATHER_API_KEY"))}
 	args, _ := json.Marshal(map[string]any{
 		"location": "Tokyo",
 		"date":     "2025-11-26",
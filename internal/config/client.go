@@ -0,0 +1,34 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+)
+
+// Client is the configuration of the command line client, read from the
+// environment only since its arguments are commands.
+type Client struct {
+	// URL is the address of the chat server.
+	URL string `yaml:"url" env:"API_URL"`
+	// APIKey holds an API key or a JWT, for servers with authentication enabled.
+	APIKey string `yaml:"api_key" env:"API_KEY"`
+}
+
+func LoadClient() (*Client, error) {
+	cfg := &Client{URL: "http://localhost:8080"}
+
+	for _, f := range fieldsOf(cfg) {
+		if v, ok := os.LookupEnv(f.env); ok {
+			if err := f.set(v); err != nil {
+				return nil, fmt.Errorf("%s: %w", f.env, err)
+			}
+		}
+	}
+
+	if u, err := url.Parse(cfg.URL); err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("API_URL: must be an absolute URL, got %q", cfg.URL)
+	}
+
+	return cfg, nil
+}
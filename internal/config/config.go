@@ -0,0 +1,372 @@
+// Package config holds the typed configuration of the server, loaded from a
+// YAML file, environment variables and command line flags.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/acai-travel/tech-challenge/internal/encryption"
+)
+
+// Config is the configuration of the chat server. Every field can be set in
+// the YAML file under its yaml path, with an environment variable (the path in
+// upper case with dots replaced by underscores, unless an env tag names
+// another) and with a flag named after the path, e.g. -server.addr.
+type Config struct {
+	Server     Server     `yaml:"server"`
+	Mongo      Mongo      `yaml:"mongo"`
+	OpenAI     OpenAI     `yaml:"openai"`
+	Prompts    Prompts    `yaml:"prompts"`
+	Tools      Tools      `yaml:"tools"`
+	Guardrails Guardrails `yaml:"guardrails"`
+	Encryption Encryption `yaml:"encryption"`
+	Auth       Auth       `yaml:"auth"`
+	RateLimit  RateLimit  `yaml:"rate_limit"`
+	Retention  Retention  `yaml:"retention"`
+	Telemetry  Telemetry  `yaml:"telemetry"`
+	Health     Health     `yaml:"health"`
+	Log        Log        `yaml:"log"`
+}
+
+type Server struct {
+	// Addr is the address the HTTP server listens on.
+	Addr string `yaml:"addr"`
+	// StaticDir holds the web UI.
+	StaticDir string `yaml:"static_dir"`
+
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	// WriteTimeout bounds a whole request, so it must leave room for a reply
+	// running every agent iteration.
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+	// ShutdownDelay keeps serving after readiness is flipped on shutdown, giving
+	// load balancers time to stop routing new requests.
+	ShutdownDelay time.Duration `yaml:"shutdown_delay"`
+	// ShutdownTimeout is how long in-flight requests may take to drain.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+type Mongo struct {
+	URI      string `yaml:"uri" env:"MONGODB_URI"`
+	Database string `yaml:"database" env:"MONGODB_DATABASE"`
+}
+
+type OpenAI struct {
+	APIKey string `yaml:"api_key" env:"OPENAI_API_KEY"`
+	// BaseURL points the client at an OpenAI compatible API, empty for OpenAI.
+	BaseURL string `yaml:"base_url" env:"OPENAI_BASE_URL"`
+	// ReplyModel answers the user and calls tools.
+	ReplyModel string `yaml:"reply_model"`
+	// PersonaModels are the models personas may use besides ReplyModel,
+	// separated by commas.
+	PersonaModels string `yaml:"persona_models"`
+	// TitleModel summarizes conversations into titles.
+	TitleModel string `yaml:"title_model"`
+	// MaxIterations caps the tool calling rounds of a single reply.
+	MaxIterations int `yaml:"max_iterations"`
+}
+
+type Prompts struct {
+	// Dir holds prompt templates replacing the built in ones with the same
+	// name, see internal/chat/prompts.
+	Dir string `yaml:"dir"`
+	// Reload picks up changes to the templates in Dir without a restart, for
+	// development.
+	Reload bool `yaml:"reload"`
+}
+
+type Tools struct {
+	Weather  Weather  `yaml:"weather"`
+	Holidays Holidays `yaml:"holidays"`
+	Airport  Tool     `yaml:"airport"`
+	Date     Tool     `yaml:"date"`
+	Time     Tool     `yaml:"time"`
+	// Memory lets the assistant remember facts about users across
+	// conversations.
+	Memory Tool `yaml:"memory"`
+}
+
+type Tool struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+type Weather struct {
+	Enabled bool   `yaml:"enabled"`
+	APIKey  string `yaml:"api_key" env:"WEATHER_API_KEY"`
+}
+
+type Holidays struct {
+	Enabled bool `yaml:"enabled"`
+	// CalendarURL is the ICS calendar the holidays are read from.
+	CalendarURL string `yaml:"calendar_url" env:"HOLIDAY_CALENDAR_LINK"`
+}
+
+// Guardrails screen user messages, tool results and replies, see
+// internal/chat/guard.
+type Guardrails struct {
+	// PII redacts emails, phone numbers, IBANs and passport numbers before they
+	// are stored or sent to OpenAI.
+	PII bool `yaml:"pii"`
+	// BlocklistFile lists terms, one per line, that user messages and replies
+	// must not contain.
+	BlocklistFile string `yaml:"blocklist_file"`
+	// Injection withholds tool results that look like prompt injection.
+	Injection bool `yaml:"injection"`
+	// Moderation checks user messages with the OpenAI moderation API.
+	Moderation      bool   `yaml:"moderation"`
+	ModerationModel string `yaml:"moderation_model"`
+}
+
+type Encryption struct {
+	// Keys encrypt conversation titles and message content at rest, as comma
+	// separated id:key pairs with 32 byte keys in base64, the first one
+	// encrypting new content. Empty stores content in plain text.
+	Keys string `yaml:"keys" env:"ENCRYPTION_KEYS"`
+}
+
+type Auth struct {
+	// KeysFile is the JSON file of API keys, see auth.KeyFile.
+	KeysFile string `yaml:"keys_file"`
+	// JWKSFile holds the keys JWTs are verified with.
+	JWKSFile    string `yaml:"jwks_file"`
+	JWTIssuer   string `yaml:"jwt_issuer"`
+	JWTAudience string `yaml:"jwt_audience"`
+}
+
+type RateLimit struct {
+	RequestsPerMinute float64 `yaml:"requests_per_minute" env:"RATE_LIMIT_RPM"`
+	Burst             int     `yaml:"burst"`
+	DailyTokens       int64   `yaml:"daily_tokens"`
+	// IPRequestsPerMinute and IPBurst throttle every request per client IP
+	// before authentication, so that failed logins are limited too.
+	IPRequestsPerMinute float64 `yaml:"ip_requests_per_minute" env:"RATE_LIMIT_IP_RPM"`
+	IPBurst             int     `yaml:"ip_burst"`
+	// TrustProxy takes the client IP from X-Forwarded-For, for rate limits and
+	// the audit log.
+	TrustProxy bool `yaml:"trust_proxy"`
+}
+
+type Retention struct {
+	// Default is the inactivity period before a conversation is deleted, 0
+	// keeps conversations forever.
+	Default       time.Duration `yaml:"default" env:"CONVERSATION_RETENTION"`
+	Mode          string        `yaml:"mode"`
+	SweepInterval time.Duration `yaml:"sweep_interval"`
+}
+
+type Telemetry struct {
+	ServiceName string `yaml:"service_name"`
+	// ServiceVersion defaults to the VCS revision the binary was built from.
+	ServiceVersion string `yaml:"service_version"`
+	// Environment is the deployment.environment.name resource attribute.
+	Environment string `yaml:"environment"`
+
+	// TracesEnabled exports traces over OTLP gRPC.
+	TracesEnabled bool `yaml:"traces_enabled" env:"JAEGER_ENABLED"`
+	// MetricsEnabled exports the OTel metrics over OTLP gRPC, in addition to
+	// the Prometheus /metrics endpoint.
+	MetricsEnabled bool `yaml:"metrics_enabled"`
+	// MetricsInterval is how often metrics are pushed.
+	MetricsInterval time.Duration `yaml:"metrics_interval"`
+	// LogsEnabled exports logs over OTLP gRPC, in addition to stderr.
+	LogsEnabled bool `yaml:"logs_enabled"`
+
+	// Endpoint is the OTLP collector, empty for the exporter default.
+	Endpoint string `yaml:"endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	// Headers are sent with every export, as comma separated key=value pairs,
+	// typically to authenticate with a hosted collector.
+	Headers string `yaml:"headers" env:"OTEL_EXPORTER_OTLP_HEADERS"`
+	// Insecure connects to the collector without TLS.
+	Insecure bool `yaml:"insecure" env:"OTEL_EXPORTER_OTLP_INSECURE"`
+
+	Sampling Sampling `yaml:"sampling"`
+}
+
+type Sampling struct {
+	// Ratio is the fraction of traces sampled, from 0 to 1.
+	Ratio float64 `yaml:"ratio"`
+	// ParentBased follows the sampling decision of the caller when a request
+	// comes with a trace context, and only applies the ratio to new traces.
+	ParentBased bool `yaml:"parent_based"`
+}
+
+type Health struct {
+	// CheckInterval is how often dependencies are checked in the background.
+	CheckInterval time.Duration `yaml:"check_interval"`
+	CheckTimeout  time.Duration `yaml:"check_timeout"`
+}
+
+type Log struct {
+	// Level is the minimum level logged: debug, info, warn or error.
+	Level string `yaml:"level"`
+	// Format is text, or json for log collectors.
+	Format string `yaml:"format"`
+}
+
+// Default returns the configuration used for anything not set explicitly.
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Addr:              ":8080",
+			StaticDir:         "cmd/server/static",
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       30 * time.Second,
+			WriteTimeout:      5 * time.Minute,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   time.Minute,
+		},
+		Mongo: Mongo{
+			URI:      "mongodb://localhost:27017",
+			Database: "acai",
+		},
+		OpenAI: OpenAI{
+			ReplyModel:    "gpt-4.1",
+			TitleModel:    "o1",
+			MaxIterations: 15,
+		},
+		Tools: Tools{
+			Weather:  Weather{Enabled: true},
+			Holidays: Holidays{Enabled: true, CalendarURL: "https://www.officeholidays.com/ics/spain/catalonia"},
+			Airport:  Tool{Enabled: true},
+			Date:     Tool{Enabled: true},
+			Time:     Tool{Enabled: true},
+			Memory:   Tool{Enabled: true},
+		},
+		Guardrails: Guardrails{
+			PII:             true,
+			Injection:       true,
+			ModerationModel: "omni-moderation-latest",
+		},
+		RateLimit: RateLimit{
+			RequestsPerMinute:   60,
+			Burst:               10,
+			IPRequestsPerMinute: 600,
+			IPBurst:             100,
+		},
+		Retention: Retention{
+			Default:       time.Hour,
+			Mode:          "ttl",
+			SweepInterval: time.Minute,
+		},
+		Telemetry: Telemetry{
+			ServiceName:     "acai-chat-service",
+			Environment:     "development",
+			MetricsInterval: 30 * time.Second,
+			Sampling: Sampling{
+				Ratio:       1,
+				ParentBased: true,
+			},
+		},
+		Health: Health{
+			CheckInterval: time.Minute,
+			CheckTimeout:  5 * time.Second,
+		},
+		Log: Log{
+			Level:  "info",
+			Format: "text",
+		},
+	}
+}
+
+// ParseHeaders parses comma separated key=value pairs, as in
+// OTEL_EXPORTER_OTLP_HEADERS. Values may be URL encoded.
+func ParseHeaders(s string) (map[string]string, error) {
+	headers := make(map[string]string)
+
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		k, v, ok := strings.Cut(pair, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid header %q, want key=value", pair)
+		}
+
+		value, err := url.PathUnescape(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("invalid header %q: %w", k, err)
+		}
+		headers[k] = value
+	}
+
+	return headers, nil
+}
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, field, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+		}
+	}
+
+	check(c.Server.Addr != "", "server.addr", "is required")
+	check(c.Server.ReadHeaderTimeout >= 0, "server.read_header_timeout", "must not be negative")
+	check(c.Server.ReadTimeout >= 0, "server.read_timeout", "must not be negative")
+	check(c.Server.WriteTimeout >= 0, "server.write_timeout", "must not be negative")
+	check(c.Server.IdleTimeout >= 0, "server.idle_timeout", "must not be negative")
+	check(c.Server.ShutdownDelay >= 0, "server.shutdown_delay", "must not be negative")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout", "must be positive")
+
+	check(strings.HasPrefix(c.Mongo.URI, "mongodb://") || strings.HasPrefix(c.Mongo.URI, "mongodb+srv://"),
+		"mongo.uri", "must be a mongodb:// or mongodb+srv:// URI")
+	check(c.Mongo.Database != "", "mongo.database", "is required")
+
+	if c.OpenAI.BaseURL != "" {
+		u, err := url.Parse(c.OpenAI.BaseURL)
+		check(err == nil && u.Scheme != "" && u.Host != "", "openai.base_url", "must be an absolute URL")
+	}
+	check(c.OpenAI.ReplyModel != "", "openai.reply_model", "is required")
+	check(c.OpenAI.TitleModel != "", "openai.title_model", "is required")
+	check(c.OpenAI.MaxIterations > 0, "openai.max_iterations", "must be positive")
+
+	check(!c.Prompts.Reload || c.Prompts.Dir != "", "prompts.reload", "requires prompts.dir")
+
+	if c.Tools.Holidays.Enabled {
+		u, err := url.Parse(c.Tools.Holidays.CalendarURL)
+		check(err == nil && u.Scheme != "" && u.Host != "", "tools.holidays.calendar_url", "must be an absolute URL")
+	}
+
+	check(!c.Guardrails.Moderation || c.Guardrails.ModerationModel != "", "guardrails.moderation_model", "is required with guardrails.moderation")
+
+	if _, err := encryption.ParseKeySet(c.Encryption.Keys); err != nil {
+		check(false, "encryption.keys", "%v", err)
+	}
+
+	check(c.Auth.JWTIssuer == "" || c.Auth.JWKSFile != "", "auth.jwt_issuer", "requires auth.jwks_file")
+	check(c.Auth.JWTAudience == "" || c.Auth.JWKSFile != "", "auth.jwt_audience", "requires auth.jwks_file")
+
+	check(c.RateLimit.RequestsPerMinute >= 0, "rate_limit.requests_per_minute", "must not be negative")
+	check(c.RateLimit.Burst >= 0, "rate_limit.burst", "must not be negative")
+	check(c.RateLimit.DailyTokens >= 0, "rate_limit.daily_tokens", "must not be negative")
+	check(c.RateLimit.IPRequestsPerMinute >= 0, "rate_limit.ip_requests_per_minute", "must not be negative")
+	check(c.RateLimit.IPBurst >= 0, "rate_limit.ip_burst", "must not be negative")
+
+	check(c.Retention.Default >= 0, "retention.default", "must not be negative")
+	check(c.Retention.Mode == "ttl" || c.Retention.Mode == "sweeper", "retention.mode", "must be ttl or sweeper, got %q", c.Retention.Mode)
+	check(c.Retention.SweepInterval > 0, "retention.sweep_interval", "must be positive")
+
+	check(c.Telemetry.ServiceName != "", "telemetry.service_name", "is required")
+	check(c.Telemetry.MetricsInterval > 0, "telemetry.metrics_interval", "must be positive")
+	_, err := ParseHeaders(c.Telemetry.Headers)
+	check(err == nil, "telemetry.headers", "%v", err)
+	check(c.Telemetry.Sampling.Ratio >= 0 && c.Telemetry.Sampling.Ratio <= 1, "telemetry.sampling.ratio", "must be between 0 and 1")
+
+	check(c.Health.CheckInterval > 0, "health.check_interval", "must be positive")
+	check(c.Health.CheckTimeout > 0, "health.check_timeout", "must be positive")
+
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.Log.Level)) == nil, "log.level", "must be debug, info, warn or error, got %q", c.Log.Level)
+	check(c.Log.Format == "text" || c.Log.Format == "json", "log.format", "must be text or json, got %q", c.Log.Format)
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,159 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/acai-travel/tech-challenge/internal/config"
+)
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	return path
+}
+
+// unsetenv removes an environment variable for the duration of the test.
+func unsetenv(t *testing.T, key string) {
+	t.Setenv(key, "")
+	os.Unsetenv(key)
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	unsetenv(t, "MONGODB_URI")
+
+	path := writeFile(t, `
+server:
+  addr: ":9000"
+mongo:
+  uri: "mongodb://file:27017"
+  database: "from-file"
+retention:
+  default: 2h
+tools:
+  airport:
+    enabled: false
+`)
+
+	t.Setenv("MONGODB_DATABASE", "from-env")
+	t.Setenv("RATE_LIMIT_RPM", "120")
+	t.Setenv("TOOLS_DATE_ENABLED", "false")
+
+	cfg, err := config.Load("test", []string{"-config", path, "-mongo.database", "from-flag", "-retention.mode", "sweeper"})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{"file", cfg.Server.Addr, ":9000"},
+		{"file over default", cfg.Mongo.URI, "mongodb://file:27017"},
+		{"file duration", cfg.Retention.Default, 2 * time.Hour},
+		{"file bool", cfg.Tools.Airport.Enabled, false},
+		{"env with legacy name", cfg.RateLimit.RequestsPerMinute, 120.0},
+		{"env with derived name", cfg.Tools.Date.Enabled, false},
+		{"flag over env", cfg.Mongo.Database, "from-flag"},
+		{"flag", cfg.Retention.Mode, "sweeper"},
+		{"default", cfg.OpenAI.MaxIterations, 15},
+	}
+
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		args    []string
+		wantErr string
+	}{
+		{
+			name:    "unknown file setting",
+			file:    "mongo:\n  url: mongodb://localhost\n",
+			wantErr: "field url not found",
+		},
+		{
+			name:    "invalid env value",
+			env:     map[string]string{"CONVERSATION_RETENTION": "forever"},
+			wantErr: "CONVERSATION_RETENTION",
+		},
+		{
+			name:    "invalid flag value",
+			args:    []string{"-rate_limit.burst", "many"},
+			wantErr: "-rate_limit.burst",
+		},
+		{
+			name:    "every invalid setting is reported",
+			args:    []string{"-mongo.uri", "localhost", "-retention.mode", "cron"},
+			wantErr: "mongo.uri: must be a mongodb:// or mongodb+srv:// URI\nretention.mode: must be ttl or sweeper",
+		},
+		{
+			name:    "prompt reload without directory",
+			args:    []string{"-prompts.reload", "true"},
+			wantErr: "prompts.reload: requires prompts.dir",
+		},
+		{
+			name:    "moderation without model",
+			args:    []string{"-guardrails.moderation", "true", "-guardrails.moderation_model", ""},
+			wantErr: "guardrails.moderation_model: is required with guardrails.moderation",
+		},
+		{
+			name:    "invalid encryption key",
+			args:    []string{"-encryption.keys", "k1:c2hvcnQ="},
+			wantErr: "encryption.keys: key k1: got 5 bytes, want 32",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeFile(t, tt.file)}, args...)
+			}
+
+			_, err := config.Load("test", args)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Load() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDefault_IsValid(t *testing.T) {
+	if err := config.Default().Validate(); err != nil {
+		t.Fatalf("Default().Validate() error = %v", err)
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	headers, err := config.ParseHeaders("api-key=secret, authorization=Basic%20dXNlcg==,")
+	if err != nil {
+		t.Fatalf("ParseHeaders() error = %v", err)
+	}
+	if len(headers) != 2 || headers["api-key"] != "secret" || headers["authorization"] != "Basic dXNlcg==" {
+		t.Errorf("ParseHeaders() = %v", headers)
+	}
+
+	if _, err := config.ParseHeaders("api-key"); err == nil {
+		t.Error("ParseHeaders() without a value succeeded, want an error")
+	}
+}
@@ -0,0 +1,271 @@
+// Package encryption encrypts values at rest with envelope encryption: every
+// value is encrypted with its own random data key (AES-256-GCM), which is in
+// turn encrypted, or wrapped, with a key of a locally configured key set. The
+// key that wrapped a value is named in it, so that keys can be rotated by
+// rewrapping data keys with a new one while old values stay readable.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// prefix marks encrypted values, which read
+	// enc:v1:<key ID>:<wrapped data key>:<ciphertext>, both in base64 with
+	// their nonce first.
+	prefix = "enc:v1:"
+	// escape is prepended to plain text starting with enc:, such as a message
+	// quoting an encrypted value, so that it isn't mistaken for one.
+	escape = "enc:plain:"
+)
+
+// KeySet holds the keys data keys are wrapped with. A nil KeySet leaves values
+// in plain text.
+type KeySet struct {
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+// ParseKeySet parses comma separated id:key pairs, keys being 32 bytes in
+// base64. The first key is the primary one, which new values are encrypted
+// with; the others decrypt values encrypted before a rotation. An empty string
+// is no key set.
+func ParseKeySet(s string) (*KeySet, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	ks := &KeySet{keys: make(map[string]cipher.AEAD)}
+	for _, pair := range strings.Split(s, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid key %q, want id:base64 key", pair)
+		}
+
+		if strings.ContainsAny(id, ": ") {
+			return nil, fmt.Errorf("invalid key ID %q", id)
+		}
+
+		if _, ok := ks.keys[id]; ok {
+			return nil, fmt.Errorf("duplicate key ID %q", id)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key %s: got %d bytes, want 32", id, len(key))
+		}
+
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+
+		ks.keys[id] = aead
+		if ks.primary == "" {
+			ks.primary = id
+		}
+	}
+
+	return ks, nil
+}
+
+// Primary is the ID of the key new values are encrypted with.
+func (k *KeySet) Primary() string {
+	if k == nil {
+		return ""
+	}
+	return k.primary
+}
+
+// Encrypt encrypts plaintext with a new data key wrapped with the primary key.
+// The same additional data, e.g. the ID of the document the value belongs to,
+// must be given to decrypt it, so that values cannot be moved between
+// documents. Without a key set plaintext is returned as is, escaped if it
+// could be mistaken for an encrypted value.
+func (k *KeySet) Encrypt(plaintext, aad string) (string, error) {
+	if k == nil {
+		if strings.HasPrefix(plaintext, "enc:") {
+			return escape + plaintext, nil
+		}
+		return plaintext, nil
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+
+	data, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	ciphertext, err := seal(data, []byte(plaintext), []byte(aad))
+	if err != nil {
+		return "", err
+	}
+
+	wrapped, err := seal(k.keys[k.primary], dataKey, []byte(k.primary))
+	if err != nil {
+		return "", err
+	}
+
+	return format(k.primary, wrapped, ciphertext), nil
+}
+
+// Decrypt decrypts a value encrypted with aad. Values that are not encrypted,
+// such as those stored before encryption was enabled, are returned as is.
+func (k *KeySet) Decrypt(value, aad string) (string, error) {
+	if plaintext, ok := strings.CutPrefix(value, escape); ok {
+		return plaintext, nil
+	}
+
+	if !Encrypted(value) {
+		return value, nil
+	}
+
+	id, wrapped, ciphertext, err := parse(value)
+	if err != nil {
+		return "", err
+	}
+
+	dataKey, err := k.unwrap(id, wrapped)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := open(data, ciphertext, []byte(aad))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value with key %s: %w", id, err)
+	}
+
+	return string(plaintext), nil
+}
+
+// Rotate returns value encrypted with the primary key, and whether it changed.
+// Values encrypted with another key only get their data key rewrapped; values
+// in plain text are encrypted.
+func (k *KeySet) Rotate(value, aad string) (string, bool, error) {
+	if k == nil {
+		return "", false, errors.New("no encryption keys configured")
+	}
+
+	if !Encrypted(value) {
+		encrypted, err := k.Encrypt(strings.TrimPrefix(value, escape), aad)
+		return encrypted, err == nil, err
+	}
+
+	id, wrapped, ciphertext, err := parse(value)
+	if err != nil {
+		return "", false, err
+	}
+
+	if id == k.primary {
+		return value, false, nil
+	}
+
+	dataKey, err := k.unwrap(id, wrapped)
+	if err != nil {
+		return "", false, err
+	}
+
+	rewrapped, err := seal(k.keys[k.primary], dataKey, []byte(k.primary))
+	if err != nil {
+		return "", false, err
+	}
+
+	return format(k.primary, rewrapped, ciphertext), true, nil
+}
+
+// Encrypted reports whether value was encrypted by a key set.
+func Encrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// KeyID is the ID of the key that wrapped the data key of an encrypted value.
+func KeyID(value string) (string, bool) {
+	if !Encrypted(value) {
+		return "", false
+	}
+
+	id, _, _ := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	return id, true
+}
+
+func (k *KeySet) unwrap(id string, wrapped []byte) ([]byte, error) {
+	if k == nil {
+		return nil, fmt.Errorf("value encrypted with key %s, but no encryption keys are configured", id)
+	}
+
+	kek, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("value encrypted with unknown key %s", id)
+	}
+
+	dataKey, err := open(kek, wrapped, []byte(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key with key %s: %w", id, err)
+	}
+
+	return dataKey, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts with a random nonce, prepended to the ciphertext.
+func seal(aead cipher.AEAD, plaintext, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func open(aead cipher.AEAD, sealed, aad []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], aad)
+}
+
+func format(id string, wrapped, ciphertext []byte) string {
+	return prefix + id + ":" + base64.RawStdEncoding.EncodeToString(wrapped) + ":" + base64.RawStdEncoding.EncodeToString(ciphertext)
+}
+
+func parse(value string) (id string, wrapped, ciphertext []byte, err error) {
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, errors.New("malformed encrypted value")
+	}
+
+	if wrapped, err = base64.RawStdEncoding.DecodeString(parts[1]); err != nil {
+		return "", nil, nil, fmt.Errorf("malformed encrypted value: %w", err)
+	}
+
+	if ciphertext, err = base64.RawStdEncoding.DecodeString(parts[2]); err != nil {
+		return "", nil, nil, fmt.Errorf("malformed encrypted value: %w", err)
+	}
+
+	return parts[0], wrapped, ciphertext, nil
+}
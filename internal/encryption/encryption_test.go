@@ -0,0 +1,154 @@
+package encryption_test
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/acai-travel/tech-challenge/internal/encryption"
+)
+
+func key(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(rune(b)), 32)))
+}
+
+func TestKeySet_EncryptDecrypt(t *testing.T) {
+	ks, err := encryption.ParseKeySet("k1:" + key('a'))
+	if err != nil {
+		t.Fatalf("ParseKeySet() error = %v", err)
+	}
+
+	plaintext := "Flight LH400 to New York, seat 12A"
+	a, err := ks.Encrypt(plaintext, "id1")
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	b, _ := ks.Encrypt(plaintext, "id1")
+
+	if !encryption.Encrypted(a) || strings.Contains(a, "LH400") || a == b {
+		t.Errorf("expected distinct ciphertexts, got %q and %q", a, b)
+	}
+
+	if id, ok := encryption.KeyID(a); !ok || id != "k1" {
+		t.Errorf("KeyID() = %q, %v, want k1", id, ok)
+	}
+
+	got, err := ks.Decrypt(a, "id1")
+	if err != nil || got != plaintext {
+		t.Errorf("Decrypt() = %q, %v, want %q", got, err, plaintext)
+	}
+
+	if _, err := ks.Decrypt(a, "id2"); err == nil {
+		t.Error("expected a value moved to another document not to decrypt")
+	}
+
+	tampered := a[:len(a)-2] + "AA"
+	if _, err := ks.Decrypt(tampered, "id1"); err == nil {
+		t.Error("expected a tampered value not to decrypt")
+	}
+
+	if got, err := ks.Decrypt("stored before encryption", "id1"); err != nil || got != "stored before encryption" {
+		t.Errorf("expected plain text to be read as is, got %q, %v", got, err)
+	}
+
+	var none *encryption.KeySet
+	if got, _ := none.Encrypt(plaintext, "id1"); got != plaintext {
+		t.Errorf("expected no key set to leave values in plain text, got %q", got)
+	}
+	if _, err := none.Decrypt(a, "id1"); err == nil || !strings.Contains(err.Error(), "no encryption keys") {
+		t.Errorf("expected an error without keys, got %v", err)
+	}
+}
+
+func TestKeySet_Rotate(t *testing.T) {
+	old, _ := encryption.ParseKeySet("k1:" + key('a'))
+	rotated, _ := encryption.ParseKeySet("k2:" + key('b') + ", k1:" + key('a'))
+
+	value, _ := old.Encrypt("Hotel Adlon, 3 nights", "id1")
+
+	// Old values stay readable after the rotation.
+	if got, err := rotated.Decrypt(value, "id1"); err != nil || got != "Hotel Adlon, 3 nights" {
+		t.Fatalf("Decrypt() = %q, %v", got, err)
+	}
+
+	rewrapped, changed, err := rotated.Rotate(value, "id1")
+	if err != nil || !changed {
+		t.Fatalf("Rotate() = %v, %v", changed, err)
+	}
+
+	if id, _ := encryption.KeyID(rewrapped); id != "k2" {
+		t.Errorf("expected the primary key, got %s", id)
+	}
+
+	// Only the data key was rewrapped.
+	if strings.Split(rewrapped, ":")[4] != strings.Split(value, ":")[4] {
+		t.Error("expected the ciphertext to be kept")
+	}
+
+	if _, changed, _ := rotated.Rotate(rewrapped, "id1"); changed {
+		t.Error("expected a value of the primary key not to change")
+	}
+
+	plain, changed, err := rotated.Rotate("plain", "id1")
+	if err != nil || !changed || !encryption.Encrypted(plain) {
+		t.Errorf("expected plain text to be encrypted, got %q, %v, %v", plain, changed, err)
+	}
+
+	// The old key can go once every value was rotated.
+	current, _ := encryption.ParseKeySet("k2:" + key('b'))
+	if got, err := current.Decrypt(rewrapped, "id1"); err != nil || got != "Hotel Adlon, 3 nights" {
+		t.Errorf("Decrypt() = %q, %v", got, err)
+	}
+	if _, err := current.Decrypt(value, "id1"); err == nil || !strings.Contains(err.Error(), "unknown key k1") {
+		t.Errorf("expected an unknown key error, got %v", err)
+	}
+}
+
+func TestKeySet_PlaintextLikeEncryptedValue(t *testing.T) {
+	ks, _ := encryption.ParseKeySet("k1:" + key('a'))
+	var none *encryption.KeySet
+
+	for _, plaintext := range []string{"enc:v1:k1:AAAA:BBBB", "enc:plain:x", "enc:"} {
+		stored, err := none.Encrypt(plaintext, "id1")
+		if err != nil || encryption.Encrypted(stored) {
+			t.Fatalf("Encrypt(%q) = %q, %v, want it escaped", plaintext, stored, err)
+		}
+
+		for name, k := range map[string]*encryption.KeySet{"no keys": none, "keys": ks} {
+			if got, err := k.Decrypt(stored, "id1"); err != nil || got != plaintext {
+				t.Errorf("%s: Decrypt(%q) = %q, %v, want %q", name, stored, got, err, plaintext)
+			}
+		}
+
+		rotated, changed, err := ks.Rotate(stored, "id1")
+		if err != nil || !changed || !encryption.Encrypted(rotated) {
+			t.Fatalf("Rotate(%q) = %q, %v, %v", stored, rotated, changed, err)
+		}
+
+		if got, err := ks.Decrypt(rotated, "id1"); err != nil || got != plaintext {
+			t.Errorf("Decrypt(Rotate(%q)) = %q, %v", stored, got, err)
+		}
+	}
+}
+
+func TestParseKeySet_Errors(t *testing.T) {
+	tests := []struct {
+		in  string
+		err string
+	}{
+		{"k1", "want id:base64 key"},
+		{"k1:not base64!", "illegal base64"},
+		{"k1:" + base64.StdEncoding.EncodeToString([]byte("short")), "want 32"},
+		{"k1:" + key('a') + ",k1:" + key('b'), "duplicate key ID"},
+	}
+
+	for _, tt := range tests {
+		if _, err := encryption.ParseKeySet(tt.in); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("ParseKeySet(%q) error = %v, want %q", tt.in, err, tt.err)
+		}
+	}
+
+	if ks, err := encryption.ParseKeySet(" "); ks != nil || err != nil {
+		t.Errorf("expected no key set, got %v, %v", ks, err)
+	}
+}
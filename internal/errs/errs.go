@@ -0,0 +1,179 @@
+// Package errs defines the kinds of errors the chat service can fail with and
+// maps them to Twirp errors, so that clients can tell a retryable upstream
+// outage from a bad request.
+package errs
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/twitchtv/twirp"
+)
+
+// Kind classifies an error. It is sent to clients in the kind metadata of
+// Twirp errors.
+type Kind string
+
+const (
+	// KindUpstreamUnavailable is a dependency (OpenAI, a tool API) that failed
+	// or could not be reached. Retrying later may succeed.
+	KindUpstreamUnavailable Kind = "upstream_unavailable"
+	// KindRateLimited is a caller, or the service towards a dependency, sending
+	// requests too fast. Retrying after RetryAfter should succeed.
+	KindRateLimited Kind = "rate_limited"
+	// KindInvalidInput is a request, or tool arguments, that cannot be served.
+	KindInvalidInput Kind = "invalid_input"
+	// KindNotFound is something that does not exist, e.g. an unknown airport.
+	KindNotFound Kind = "not_found"
+	// KindBudgetExceeded is a caller that used up its token quota.
+	KindBudgetExceeded Kind = "budget_exceeded"
+	// KindBlocked is content a guardrail refused, e.g. a blocked term.
+	KindBlocked Kind = "blocked"
+)
+
+// Error is an error of a known kind.
+type Error struct {
+	Kind Kind
+	// Upstream names the dependency the error comes from, if any.
+	Upstream string
+	// Argument names the invalid input, if any.
+	Argument string
+	// RetryAfter is how long to wait before retrying, 0 if unknown.
+	RetryAfter time.Duration
+	Msg        string
+	Err        error
+}
+
+func (e *Error) Error() string {
+	msg := e.Msg
+	if e.Upstream != "" {
+		msg = e.Upstream + ": " + msg
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether the same request may succeed later.
+func (e *Error) Retryable() bool {
+	switch e.Kind {
+	case KindUpstreamUnavailable, KindRateLimited, KindBudgetExceeded:
+		return true
+	default:
+		return false
+	}
+}
+
+// Unavailable is a failure of the upstream dependency.
+func Unavailable(upstream, msg string, err error) *Error {
+	return &Error{Kind: KindUpstreamUnavailable, Upstream: upstream, Msg: msg, Err: err}
+}
+
+// RateLimited is a rate limit hit, by the caller when upstream is empty or by
+// the service towards upstream otherwise.
+func RateLimited(upstream, msg string, retryAfter time.Duration) *Error {
+	return &Error{Kind: KindRateLimited, Upstream: upstream, Msg: msg, RetryAfter: retryAfter}
+}
+
+// InvalidInput is an invalid argument.
+func InvalidInput(argument, msg string) *Error {
+	return &Error{Kind: KindInvalidInput, Argument: argument, Msg: msg}
+}
+
+// NotFound is something missing, possibly reported by upstream.
+func NotFound(upstream, msg string) *Error {
+	return &Error{Kind: KindNotFound, Upstream: upstream, Msg: msg}
+}
+
+// BudgetExceeded is a used up quota, available again after retryAfter.
+func BudgetExceeded(msg string, retryAfter time.Duration) *Error {
+	return &Error{Kind: KindBudgetExceeded, Msg: msg, RetryAfter: retryAfter}
+}
+
+// Blocked is content refused by a guardrail.
+func Blocked(msg string) *Error {
+	return &Error{Kind: KindBlocked, Msg: msg}
+}
+
+// KindOf returns the kind of err, empty when it has none.
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return ""
+}
+
+// Twirp maps err to a Twirp error. Typed errors get the code of their kind and
+// the kind, upstream, argument, retryable and retry_after metadata; Twirp
+// errors are returned as is and anything else is an internal error.
+func Twirp(err error) twirp.Error {
+	if err == nil {
+		return nil
+	}
+
+	var te twirp.Error
+	if errors.As(err, &te) {
+		return te
+	}
+
+	var e *Error
+	if !errors.As(err, &e) {
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			return twirp.NewError(twirp.DeadlineExceeded, "request timed out").WithMeta("retryable", "true")
+		case errors.Is(err, context.Canceled):
+			return twirp.NewError(twirp.Canceled, "request canceled")
+		}
+		return twirp.InternalErrorWith(err)
+	}
+
+	var code twirp.ErrorCode
+	switch e.Kind {
+	case KindUpstreamUnavailable:
+		code = twirp.Unavailable
+	case KindRateLimited, KindBudgetExceeded:
+		code = twirp.ResourceExhausted
+	case KindInvalidInput, KindBlocked:
+		code = twirp.InvalidArgument
+	case KindNotFound:
+		code = twirp.NotFound
+	default:
+		code = twirp.Internal
+	}
+
+	// Upstream failures only expose the dependency, not its error.
+	msg := e.Msg
+	if e.Kind == KindUpstreamUnavailable && e.Upstream != "" {
+		msg = e.Upstream + " is unavailable"
+	}
+
+	te = twirp.NewError(code, msg).
+		WithMeta("kind", string(e.Kind)).
+		WithMeta("retryable", strconv.FormatBool(e.Retryable()))
+
+	if e.Upstream != "" {
+		te = te.WithMeta("upstream", e.Upstream)
+	}
+	if e.Argument != "" {
+		te = te.WithMeta("argument", e.Argument)
+	}
+	if e.RetryAfter > 0 {
+		te = te.WithMeta("retry_after", RetryAfterSeconds(e.RetryAfter))
+	}
+
+	return te
+}
+
+// RetryAfterSeconds formats d as whole seconds, rounded up, as in a
+// Retry-After header.
+func RetryAfterSeconds(d time.Duration) string {
+	return strconv.Itoa(int((d + time.Second - 1) / time.Second))
+}
@@ -0,0 +1,118 @@
+package errs_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/acai-travel/tech-challenge/internal/errs"
+	"github.com/twitchtv/twirp"
+)
+
+func TestTwirp(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		code twirp.ErrorCode
+		msg  string
+		meta map[string]string
+	}{
+		{
+			name: "upstream unavailable hides the cause",
+			err:  fmt.Errorf("failed to get weather: %w", errs.Unavailable("weather_api", "request failed", errors.New("dial tcp: timeout"))),
+			code: twirp.Unavailable,
+			msg:  "weather_api is unavailable",
+			meta: map[string]string{"kind": "upstream_unavailable", "retryable": "true", "upstream": "weather_api"},
+		},
+		{
+			name: "rate limited",
+			err:  errs.RateLimited("", "rate limit exceeded", 1500*time.Millisecond),
+			code: twirp.ResourceExhausted,
+			msg:  "rate limit exceeded",
+			meta: map[string]string{"kind": "rate_limited", "retryable": "true", "retry_after": "2"},
+		},
+		{
+			name: "budget exceeded",
+			err:  errs.BudgetExceeded("token quota exceeded", time.Hour),
+			code: twirp.ResourceExhausted,
+			msg:  "token quota exceeded",
+			meta: map[string]string{"kind": "budget_exceeded", "retryable": "true", "retry_after": "3600"},
+		},
+		{
+			name: "invalid input",
+			err:  errs.InvalidInput("message", "message is too long"),
+			code: twirp.InvalidArgument,
+			msg:  "message is too long",
+			meta: map[string]string{"kind": "invalid_input", "retryable": "false", "argument": "message"},
+		},
+		{
+			name: "blocked",
+			err:  errs.Blocked("blocked by the blocklist guardrail"),
+			code: twirp.InvalidArgument,
+			msg:  "blocked by the blocklist guardrail",
+			meta: map[string]string{"kind": "blocked", "retryable": "false"},
+		},
+		{
+			name: "not found",
+			err:  errs.NotFound("airport_api", "airport not found"),
+			code: twirp.NotFound,
+			msg:  "airport not found",
+			meta: map[string]string{"kind": "not_found", "retryable": "false", "upstream": "airport_api"},
+		},
+		{
+			name: "twirp error is kept",
+			err:  twirp.RequiredArgumentError("message"),
+			code: twirp.InvalidArgument,
+			msg:  "message is required",
+			meta: map[string]string{"argument": "message"},
+		},
+		{
+			name: "deadline exceeded",
+			err:  fmt.Errorf("reply: %w", context.DeadlineExceeded),
+			code: twirp.DeadlineExceeded,
+			msg:  "request timed out",
+			meta: map[string]string{"retryable": "true"},
+		},
+		{
+			name: "untyped error is internal",
+			err:  errors.New("boom"),
+			code: twirp.Internal,
+			msg:  "boom",
+			meta: map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			te := errs.Twirp(tt.err)
+			if te.Code() != tt.code {
+				t.Errorf("code = %s, want %s", te.Code(), tt.code)
+			}
+			if te.Msg() != tt.msg {
+				t.Errorf("msg = %q, want %q", te.Msg(), tt.msg)
+			}
+			for k, v := range tt.meta {
+				if got := te.Meta(k); got != v {
+					t.Errorf("meta %s = %q, want %q", k, got, v)
+				}
+			}
+			for _, k := range []string{"kind", "retryable", "upstream", "argument", "retry_after"} {
+				if _, ok := tt.meta[k]; !ok && te.Meta(k) != "" {
+					t.Errorf("unexpected meta %s = %q", k, te.Meta(k))
+				}
+			}
+		})
+	}
+}
+
+func TestKindOf(t *testing.T) {
+	err := fmt.Errorf("wrapped: %w", errs.InvalidInput("timezone", "invalid timezone"))
+	if got := errs.KindOf(err); got != errs.KindInvalidInput {
+		t.Errorf("KindOf() = %q, want %q", got, errs.KindInvalidInput)
+	}
+	if got := errs.KindOf(errors.New("plain")); got != "" {
+		t.Errorf("KindOf() = %q, want empty", got)
+	}
+}
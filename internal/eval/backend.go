@@ -0,0 +1,323 @@
+package eval
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Mode is where the LLM answers come from.
+type Mode string
+
+const (
+	// ModeFake answers with the completions scripted in each case.
+	ModeFake Mode = "fake"
+	// ModeReplay answers with the completions recorded in a cassette, failing
+	// requests that were not recorded.
+	ModeReplay Mode = "replay"
+	// ModeRecord forwards requests to the LLM and records them in a cassette.
+	ModeRecord Mode = "record"
+	// ModeLive forwards requests to the LLM.
+	ModeLive Mode = "live"
+)
+
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(s); m {
+	case ModeFake, ModeReplay, ModeRecord, ModeLive:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown LLM mode %q, want fake, replay, record or live", s)
+	}
+}
+
+// Interaction is a recorded chat completion.
+type Interaction struct {
+	Key      string          `json:"key"`
+	Request  json.RawMessage `json:"request"`
+	Response json.RawMessage `json:"response"`
+}
+
+// Cassette holds recorded chat completions, looked up by the hash of their
+// request.
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// LoadCassette reads a cassette, empty when the file does not exist.
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Cassette{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return &c, nil
+}
+
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+func (c *Cassette) find(key string) *Interaction {
+	for _, i := range c.Interactions {
+		if i.Key == key {
+			return i
+		}
+	}
+	return nil
+}
+
+// Backend is an OpenAI compatible server the assistant under evaluation calls,
+// answering chat completions as its mode says.
+type Backend struct {
+	mode     Mode
+	cassette *Cassette
+	// upstream and apiKey reach the LLM in record and live modes.
+	upstream string
+	apiKey   string
+
+	srv *http.Server
+	url string
+
+	mu     sync.Mutex
+	script []Completion
+	calls  int
+}
+
+// NewBackend starts a backend on a local port. The cassette is used in replay
+// and record modes, upstream and apiKey in record and live modes.
+func NewBackend(mode Mode, cassette *Cassette, upstream, apiKey string) (*Backend, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	if upstream == "" {
+		upstream = "https://api.openai.com/v1"
+	}
+
+	b := &Backend{
+		mode:     mode,
+		cassette: cassette,
+		upstream: strings.TrimSuffix(upstream, "/"),
+		apiKey:   apiKey,
+		url:      "http://" + ln.Addr().String() + "/v1/",
+	}
+	b.srv = &http.Server{Handler: http.HandlerFunc(b.serve)}
+
+	go func() { _ = b.srv.Serve(ln) }()
+
+	return b, nil
+}
+
+// URL is the base URL to configure the OpenAI client with.
+func (b *Backend) URL() string {
+	return b.url
+}
+
+func (b *Backend) Mode() Mode {
+	return b.mode
+}
+
+func (b *Backend) Close() error {
+	return b.srv.Close()
+}
+
+// start prepares the backend for a case, with the completions of the fake LLM.
+func (b *Backend) start(script []Completion) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.script = script
+	b.calls = 0
+}
+
+func (b *Backend) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "/chat/completions") {
+		fail(w, http.StatusNotFound, "only chat completions are supported")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var resp []byte
+	switch b.mode {
+	case ModeFake:
+		resp, err = b.fake(body)
+	case ModeReplay:
+		resp, err = b.replay(body)
+	default:
+		resp, err = b.forward(r, body)
+	}
+
+	if err != nil {
+		// A client error, so that the OpenAI client does not retry.
+		fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(resp)
+}
+
+func (b *Backend) fake(body []byte) ([]byte, error) {
+	var req struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	n := b.calls
+	b.calls++
+	b.mu.Unlock()
+
+	if n >= len(b.script) {
+		return nil, fmt.Errorf("the fake LLM has no completion %d scripted", n+1)
+	}
+
+	return completion(req.Model, n, b.script[n])
+}
+
+func (b *Backend) replay(body []byte) ([]byte, error) {
+	key, err := requestKey(body)
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	i := b.cassette.find(key)
+	b.mu.Unlock()
+
+	if i == nil {
+		return nil, fmt.Errorf("no recorded completion for request %s, record the suite again", key[:12])
+	}
+
+	return i.Response, nil
+}
+
+func (b *Backend) forward(r *http.Request, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, b.upstream+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+b.apiKey)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	out, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("LLM answered %d: %s", resp.StatusCode, out)
+	}
+
+	if b.mode == ModeRecord {
+		key, err := requestKey(body)
+		if err != nil {
+			return nil, err
+		}
+
+		b.mu.Lock()
+		if b.cassette.find(key) == nil {
+			b.cassette.Interactions = append(b.cassette.Interactions, &Interaction{Key: key, Request: body, Response: out})
+		}
+		b.mu.Unlock()
+	}
+
+	return out, nil
+}
+
+// requestKey hashes a request with its keys sorted, so that equal requests get
+// the same key however they were serialized.
+func requestKey(body []byte) (string, error) {
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return "", err
+	}
+
+	canonical, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// completion builds the chat completion response of a scripted completion.
+func completion(model string, n int, c Completion) ([]byte, error) {
+	message := map[string]any{"role": "assistant", "content": c.Content}
+	finish := "stop"
+
+	if len(c.ToolCalls) > 0 {
+		var calls []map[string]any
+		for i, call := range c.ToolCalls {
+			args, err := json.Marshal(call.Arguments)
+			if err != nil {
+				return nil, err
+			}
+			if call.Arguments == nil {
+				args = []byte("{}")
+			}
+
+			calls = append(calls, map[string]any{
+				"id":       fmt.Sprintf("call_%d_%d", n, i),
+				"type":     "function",
+				"function": map[string]any{"name": call.Name, "arguments": string(args)},
+			})
+		}
+		message["tool_calls"] = calls
+		finish = "tool_calls"
+	}
+
+	return json.Marshal(map[string]any{
+		"id":      fmt.Sprintf("chatcmpl-eval-%d", n),
+		"object":  "chat.completion",
+		"created": 0,
+		"model":   model,
+		"choices": []map[string]any{{"index": 0, "message": message, "finish_reason": finish}},
+		"usage":   map[string]any{"prompt_tokens": 0, "completion_tokens": 0, "total_tokens": 0},
+	})
+}
+
+func fail(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]any{"message": msg, "type": "invalid_request_error", "code": "eval"},
+	})
+}
@@ -0,0 +1,255 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/acai-travel/tech-challenge/internal/chat/assistant"
+	"github.com/acai-travel/tech-challenge/internal/chat/model"
+	"github.com/acai-travel/tech-challenge/internal/chat/prompts"
+	"github.com/acai-travel/tech-challenge/internal/config"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Runner runs suites against the assistant.
+type Runner struct {
+	// OpenAI configures the assistant, its base URL and API key are replaced by
+	// those of the backend.
+	OpenAI  config.OpenAI
+	Backend *Backend
+	// Judge grades judge assertions, which are skipped when nil.
+	Judge     *Judge
+	Templates *prompts.Registry
+}
+
+// Run runs every case of the suite in order.
+func (r *Runner) Run(ctx context.Context, s *Suite) (*Report, error) {
+	known := stubRegistry(nil, &callLog{}).Names()
+	for _, c := range s.Cases {
+		for name := range s.stubs(c) {
+			if !slices.Contains(known, name) {
+				return nil, fmt.Errorf("case %q: stub of unknown tool %q", c.Name, name)
+			}
+		}
+	}
+
+	report := &Report{Suite: s.Name, Mode: r.Backend.Mode(), StartedAt: time.Now()}
+	for _, c := range s.Cases {
+		report.add(r.runCase(ctx, s, c))
+	}
+	report.Duration = time.Since(report.StartedAt).Seconds()
+
+	return report, nil
+}
+
+func (r *Runner) runCase(ctx context.Context, s *Suite, c *Case) *CaseResult {
+	start := time.Now()
+	result := &CaseResult{Name: c.Name}
+	defer func() {
+		result.Duration = time.Since(start).Seconds()
+	}()
+
+	r.Backend.start(c.LLM)
+
+	cfg := r.OpenAI
+	cfg.BaseURL = r.Backend.URL()
+	cfg.APIKey = "eval"
+
+	calls := &callLog{}
+	assist := assistant.NewWithTools(cfg, stubRegistry(s.stubs(c), calls), personaStore(s.Personas), r.Templates, nil)
+
+	reply, err := assist.Reply(ctx, conversation(c))
+	result.ToolCalls = calls.list()
+	if err != nil {
+		result.Status = StatusError
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Reply = reply.Content
+	result.PromptVersion = reply.PromptVersion
+
+	for _, a := range c.Assert {
+		result.Assertions = append(result.Assertions, r.check(ctx, c, a, result))
+	}
+	result.Status = caseStatus(result.Assertions)
+
+	return result
+}
+
+// caseStatus fails a case on any failed assertion, and skips it when every
+// assertion was skipped.
+func caseStatus(assertions []*AssertionResult) Status {
+	status := StatusSkip
+	for _, a := range assertions {
+		switch a.Status {
+		case StatusFail:
+			return StatusFail
+		case StatusError:
+			status = StatusError
+		case StatusPass:
+			if status == StatusSkip {
+				status = StatusPass
+			}
+		}
+	}
+	return status
+}
+
+func (r *Runner) check(ctx context.Context, c *Case, a Assertion, result *CaseResult) *AssertionResult {
+	reply := result.Reply
+
+	switch {
+	case a.Called != "":
+		desc := "called " + a.Called
+		if len(a.With) > 0 {
+			desc += " with " + formatArgs(a.With)
+		}
+
+		var seen []string
+		for _, call := range result.ToolCalls {
+			if call.Name != a.Called {
+				continue
+			}
+			if matchArgs(a.With, call.Arguments) {
+				return pass(desc)
+			}
+			seen = append(seen, formatArgs(call.Arguments))
+		}
+
+		if len(seen) == 0 {
+			return failf(desc, "%s was not called", a.Called)
+		}
+		return failf(desc, "%s was called with %s", a.Called, strings.Join(seen, "; "))
+
+	case a.NotCalled != "":
+		desc := "did not call " + a.NotCalled
+		for _, call := range result.ToolCalls {
+			if call.Name == a.NotCalled {
+				return failf(desc, "%s was called with %s", a.NotCalled, formatArgs(call.Arguments))
+			}
+		}
+		return pass(desc)
+
+	case a.Contains != "":
+		desc := fmt.Sprintf("answer mentions %q", a.Contains)
+		if !strings.Contains(strings.ToLower(reply), strings.ToLower(a.Contains)) {
+			return failf(desc, "not found in %q", reply)
+		}
+		return pass(desc)
+
+	case a.NotContains != "":
+		desc := fmt.Sprintf("answer does not mention %q", a.NotContains)
+		if strings.Contains(strings.ToLower(reply), strings.ToLower(a.NotContains)) {
+			return failf(desc, "found in %q", reply)
+		}
+		return pass(desc)
+
+	case a.Matches != "":
+		desc := fmt.Sprintf("answer matches %q", a.Matches)
+		if !regexp.MustCompile(a.Matches).MatchString(reply) {
+			return failf(desc, "no match in %q", reply)
+		}
+		return pass(desc)
+
+	default:
+		desc := "judge: " + a.Judge
+		if r.Judge == nil {
+			return &AssertionResult{Assertion: desc, Status: StatusSkip, Message: "no judge in " + string(r.Backend.Mode()) + " mode"}
+		}
+
+		ok, reason, err := r.Judge.Grade(ctx, c.Messages, reply, a.Judge)
+		switch {
+		case err != nil:
+			return &AssertionResult{Assertion: desc, Status: StatusError, Message: err.Error()}
+		case !ok:
+			return &AssertionResult{Assertion: desc, Status: StatusFail, Message: reason}
+		default:
+			return &AssertionResult{Assertion: desc, Status: StatusPass, Message: reason}
+		}
+	}
+}
+
+func pass(desc string) *AssertionResult {
+	return &AssertionResult{Assertion: desc, Status: StatusPass}
+}
+
+func failf(desc, format string, args ...any) *AssertionResult {
+	return &AssertionResult{Assertion: desc, Status: StatusFail, Message: fmt.Sprintf(format, args...)}
+}
+
+// matchArgs reports whether every expected argument has the same value in
+// args, comparing values by their text so that YAML and JSON types match.
+func matchArgs(want, args map[string]any) bool {
+	for k, v := range want {
+		got, ok := args[k]
+		if !ok || argText(got) != argText(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func argText(v any) string {
+	if t, ok := v.(time.Time); ok {
+		// YAML reads unquoted dates as timestamps.
+		if t.Equal(t.Truncate(24 * time.Hour)) {
+			return t.Format(time.DateOnly)
+		}
+		return t.Format(time.RFC3339)
+	}
+	return fmt.Sprint(v)
+}
+
+func formatArgs(args map[string]any) string {
+	keys := make([]string, 0, len(args))
+	for k := range args {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	var parts []string
+	for _, k := range keys {
+		parts = append(parts, k+"="+argText(args[k]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// conversation builds the conversation of a case, as stored by the server.
+func conversation(c *Case) *model.Conversation {
+	now := time.Now()
+	conv := &model.Conversation{
+		ID:        primitive.NewObjectID(),
+		Title:     c.Name,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Persona:   c.Persona,
+	}
+
+	for _, m := range c.Messages {
+		msg := &model.Message{ID: primitive.NewObjectID(), Role: model.RoleUser, Content: m.User, CreatedAt: now, UpdatedAt: now}
+		if m.Assistant != "" {
+			msg.Role, msg.Content = model.RoleAssistant, m.Assistant
+		}
+		conv.Messages = append(conv.Messages, msg)
+	}
+
+	return conv
+}
+
+// personaStore serves the personas of a suite.
+type personaStore map[string]Persona
+
+func (s personaStore) GetPersona(ctx context.Context, name string) (*model.Persona, error) {
+	p, ok := s[name]
+	if !ok {
+		return nil, errors.New("persona not found")
+	}
+
+	return &model.Persona{Name: name, SystemPrompt: p.SystemPrompt, Model: p.Model, Tools: p.Tools}, nil
+}
@@ -0,0 +1,311 @@
+package eval_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/acai-travel/tech-challenge/internal/chat/prompts"
+	"github.com/acai-travel/tech-challenge/internal/config"
+	"github.com/acai-travel/tech-challenge/internal/eval"
+)
+
+func TestRun_ExampleSuite(t *testing.T) {
+	suite, err := eval.Load("../../eval/travel.yaml")
+	if err != nil {
+		t.Fatalf("failed to load suite: %v", err)
+	}
+
+	report := run(t, suite, eval.ModeFake, &eval.Cassette{}, "", nil)
+
+	if report.Total != len(suite.Cases) || report.Passed != report.Total {
+		var out strings.Builder
+		report.WriteSummary(&out)
+		t.Fatalf("expected every case to pass:\n%s", out.String())
+	}
+
+	// Without a judge, judge assertions are skipped.
+	var skipped int
+	for _, c := range report.Cases {
+		for _, a := range c.Assertions {
+			if a.Status == eval.StatusSkip {
+				skipped++
+			}
+		}
+	}
+	if skipped != 1 {
+		t.Errorf("expected the judge assertion to be skipped, got %d skipped", skipped)
+	}
+
+	if c := report.Cases[0]; len(c.ToolCalls) != 2 || c.ToolCalls[1].Name != "get_forecast" {
+		t.Errorf("expected get_today_date then get_forecast to be recorded, got %+v", c.ToolCalls)
+	}
+}
+
+func TestRun_Failures(t *testing.T) {
+	suite := parse(t, `
+name: failures
+tools:
+  get_forecast:
+    result: sunny
+cases:
+  - name: wrong arguments
+    messages:
+      - user: Weather in Berlin?
+    llm:
+      - tool_calls:
+          - name: get_forecast
+            arguments: {location: Berlin}
+      - content: Sunny in Berlin.
+    assert:
+      - called: get_forecast
+        with: {location: Frankfurt}
+      - contains: Frankfurt
+      - contains: sunny
+  - name: unstubbed tool
+    messages:
+      - user: Holidays in Germany?
+    llm:
+      - tool_calls:
+          - name: get_holidays
+      - content: I could not look them up.
+    assert:
+      - called: get_holidays
+  - name: script exhausted
+    messages:
+      - user: Hello
+    assert:
+      - contains: hello
+`)
+
+	report := run(t, suite, eval.ModeFake, &eval.Cassette{}, "", nil)
+
+	want := map[string]eval.Status{
+		"wrong arguments":  eval.StatusFail,
+		"unstubbed tool":   eval.StatusPass,
+		"script exhausted": eval.StatusError,
+	}
+	for _, c := range report.Cases {
+		if c.Status != want[c.Name] {
+			t.Errorf("%s: expected status %s, got %s (%s)", c.Name, want[c.Name], c.Status, c.Error)
+		}
+	}
+
+	wrong := report.Cases[0]
+	if got := wrong.Assertions[0].Message; got != "get_forecast was called with location=Berlin" {
+		t.Errorf("unexpected failure message: %q", got)
+	}
+	if wrong.Assertions[2].Status != eval.StatusPass {
+		t.Errorf("expected contains to ignore case, got %+v", wrong.Assertions[2])
+	}
+
+	if report.PassRate != 1.0/3 {
+		t.Errorf("expected a pass rate of 1/3, got %v", report.PassRate)
+	}
+}
+
+func TestRun_UnknownStub(t *testing.T) {
+	suite := parse(t, `
+name: unknown
+tools:
+  get_stock_price:
+    result: "42"
+cases:
+  - name: case
+    messages:
+      - user: Hi
+    assert:
+      - contains: hi
+`)
+
+	backend, err := eval.NewBackend(eval.ModeFake, &eval.Cassette{}, "", "")
+	if err != nil {
+		t.Fatalf("failed to start backend: %v", err)
+	}
+	defer backend.Close()
+
+	runner := &eval.Runner{OpenAI: config.Default().OpenAI, Backend: backend, Templates: prompts.Builtin()}
+	if _, err := runner.Run(context.Background(), suite); err == nil || !strings.Contains(err.Error(), "get_stock_price") {
+		t.Fatalf("expected an unknown tool error, got %v", err)
+	}
+}
+
+func TestRun_RecordAndReplay(t *testing.T) {
+	// The upstream LLM answers the assistant, then the judge.
+	var requests int
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Authorization") != "Bearer sk-test" {
+			t.Errorf("expected the API key to be forwarded, got %q", r.Header.Get("Authorization"))
+		}
+
+		var req struct {
+			ResponseFormat *struct{} `json:"response_format"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+
+		content := "Frankfurt is lovely in June."
+		if req.ResponseFormat != nil {
+			content = `{"pass": false, "reason": "it does not give the weather"}`
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"id":      "chatcmpl-1",
+			"object":  "chat.completion",
+			"model":   "gpt-4.1",
+			"choices": []map[string]any{{"index": 0, "finish_reason": "stop", "message": map[string]any{"role": "assistant", "content": content}}},
+		})
+	}))
+	defer upstream.Close()
+
+	suite := parse(t, `
+name: recorded
+cases:
+  - name: weather
+    messages:
+      - user: Weather in Frankfurt?
+    assert:
+      - contains: Frankfurt
+      - judge: The answer gives the weather.
+`)
+
+	path := filepath.Join(t.TempDir(), "recorded.cassette.json")
+
+	cassette, err := eval.LoadCassette(path)
+	if err != nil {
+		t.Fatalf("failed to load missing cassette: %v", err)
+	}
+
+	recorded := run(t, suite, eval.ModeRecord, cassette, upstream.URL, eval.NewJudge)
+	if recorded.Failed != 1 || requests != 2 {
+		t.Fatalf("expected the judge to fail the case after 2 requests, got %+v after %d", recorded.Cases[0], requests)
+	}
+	if err := cassette.Save(path); err != nil {
+		t.Fatalf("failed to save cassette: %v", err)
+	}
+
+	cassette, err = eval.LoadCassette(path)
+	if err != nil {
+		t.Fatalf("failed to load cassette: %v", err)
+	}
+	if len(cassette.Interactions) != 2 {
+		t.Fatalf("expected 2 recorded interactions, got %d", len(cassette.Interactions))
+	}
+
+	replayed := run(t, suite, eval.ModeReplay, cassette, "", eval.NewJudge)
+	if requests != 2 {
+		t.Errorf("expected replay not to call the LLM, got %d requests", requests)
+	}
+	if got, want := replayed.Cases[0].Assertions, recorded.Cases[0].Assertions; len(got) != 2 || *got[1] != *want[1] {
+		t.Errorf("expected the replay to grade as recorded, got %+v", got)
+	}
+
+	// A request that was not recorded fails.
+	suite.Cases[0].Messages[0].User = "Weather in Munich?"
+	missed := run(t, suite, eval.ModeReplay, cassette, "", eval.NewJudge)
+	if missed.Errors != 1 || !strings.Contains(missed.Cases[0].Error, "no recorded completion") {
+		t.Errorf("expected a replay miss, got %+v", missed.Cases[0])
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		err  string
+	}{
+		{
+			name: "unknown field",
+			yaml: "name: s\ncases:\n  - name: c\n    message: []\n",
+			err:  "field message not found",
+		},
+		{
+			name: "no cases",
+			yaml: "name: s\n",
+			err:  "no cases",
+		},
+		{
+			name: "duplicate case",
+			yaml: "name: s\ncases:\n  - {name: c, messages: [{user: hi}], assert: [{contains: hi}]}\n  - {name: c, messages: [{user: hi}], assert: [{contains: hi}]}\n",
+			err:  `case "c": duplicate name`,
+		},
+		{
+			name: "last message from assistant",
+			yaml: "name: s\ncases:\n  - {name: c, messages: [{user: hi}, {assistant: hello}], assert: [{contains: hi}]}\n",
+			err:  "the last message must be a user message",
+		},
+		{
+			name: "two assertions in one",
+			yaml: "name: s\ncases:\n  - {name: c, messages: [{user: hi}], assert: [{contains: hi, matches: hi}]}\n",
+			err:  "assertion 1: exactly one of",
+		},
+		{
+			name: "with without called",
+			yaml: "name: s\ncases:\n  - {name: c, messages: [{user: hi}], assert: [{contains: hi, with: {a: b}}]}\n",
+			err:  "with requires called",
+		},
+		{
+			name: "unknown persona",
+			yaml: "name: s\ncases:\n  - {name: c, persona: pilot, messages: [{user: hi}], assert: [{contains: hi}]}\n",
+			err:  `unknown persona "pilot"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "suite.yaml")
+			if err := os.WriteFile(path, []byte(tt.yaml), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := eval.Load(path); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func parse(t *testing.T, yaml string) *eval.Suite {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "suite.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	suite, err := eval.Load(path)
+	if err != nil {
+		t.Fatalf("failed to load suite: %v", err)
+	}
+
+	return suite
+}
+
+// run runs the suite against a new backend, with a judge calling it when
+// newJudge is set.
+func run(t *testing.T, suite *eval.Suite, mode eval.Mode, cassette *eval.Cassette, upstream string, newJudge func(baseURL, apiKey, model string) *eval.Judge) *eval.Report {
+	t.Helper()
+
+	backend, err := eval.NewBackend(mode, cassette, upstream, "sk-test")
+	if err != nil {
+		t.Fatalf("failed to start backend: %v", err)
+	}
+	defer backend.Close()
+
+	runner := &eval.Runner{OpenAI: config.Default().OpenAI, Backend: backend, Templates: prompts.Builtin()}
+	if newJudge != nil {
+		runner.Judge = newJudge(backend.URL(), "eval", "gpt-4.1-mini")
+	}
+
+	report, err := runner.Run(context.Background(), suite)
+	if err != nil {
+		t.Fatalf("failed to run suite: %v", err)
+	}
+
+	return report
+}
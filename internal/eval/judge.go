@@ -0,0 +1,70 @@
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/openai/openai-go/v2"
+	"github.com/openai/openai-go/v2/option"
+)
+
+const judgePrompt = `You grade the answers of an AI assistant against a rubric. You get the conversation, the final answer and the rubric. Judge only what the rubric asks, strictly, and answer with a JSON object: {"pass": true or false, "reason": "one sentence"}.`
+
+// Judge grades replies against rubrics with an LLM.
+type Judge struct {
+	cli   openai.Client
+	model string
+}
+
+// NewJudge creates a judge calling model at baseURL, typically the backend so
+// that its calls are recorded and replayed with the rest.
+func NewJudge(baseURL, apiKey, model string) *Judge {
+	return &Judge{
+		cli:   openai.NewClient(option.WithBaseURL(baseURL), option.WithAPIKey(apiKey)),
+		model: model,
+	}
+}
+
+// Grade reports whether the reply to the messages meets the rubric, and why.
+func (j *Judge) Grade(ctx context.Context, messages []Message, reply, rubric string) (bool, string, error) {
+	var transcript strings.Builder
+	for _, m := range messages {
+		if m.User != "" {
+			fmt.Fprintf(&transcript, "USER: %s\n", m.User)
+		} else {
+			fmt.Fprintf(&transcript, "ASSISTANT: %s\n", m.Assistant)
+		}
+	}
+
+	resp, err := j.cli.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+		Model: openai.ChatModel(j.model),
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			openai.SystemMessage(judgePrompt),
+			openai.UserMessage(fmt.Sprintf("Conversation:\n%s\nAnswer:\n%s\n\nRubric:\n%s", transcript.String(), reply, rubric)),
+		},
+		ResponseFormat: openai.ChatCompletionNewParamsResponseFormatUnion{
+			OfJSONObject: &openai.ResponseFormatJSONObjectParam{},
+		},
+		Temperature: openai.Float(0),
+	})
+	if err != nil {
+		return false, "", err
+	}
+
+	if len(resp.Choices) == 0 {
+		return false, "", errors.New("the judge returned no choices")
+	}
+
+	var verdict struct {
+		Pass   bool   `json:"pass"`
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal([]byte(resp.Choices[0].Message.Content), &verdict); err != nil {
+		return false, "", fmt.Errorf("invalid verdict %q: %w", resp.Choices[0].Message.Content, err)
+	}
+
+	return verdict.Pass, verdict.Reason, nil
+}
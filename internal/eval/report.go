@@ -0,0 +1,238 @@
+package eval
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusPass  Status = "pass"
+	StatusFail  Status = "fail"
+	StatusSkip  Status = "skip"
+	StatusError Status = "error"
+)
+
+// Report is the outcome of a suite run.
+type Report struct {
+	Suite     string    `json:"suite"`
+	Mode      Mode      `json:"mode"`
+	StartedAt time.Time `json:"started_at"`
+	// Duration is in seconds.
+	Duration float64 `json:"duration"`
+
+	Total   int `json:"total"`
+	Passed  int `json:"passed"`
+	Failed  int `json:"failed"`
+	Errors  int `json:"errors"`
+	Skipped int `json:"skipped"`
+	// PassRate is the share of cases that passed, among those not skipped.
+	PassRate float64 `json:"pass_rate"`
+
+	// Set when compared with a baseline report.
+	BaselinePassRate *float64 `json:"baseline_pass_rate,omitempty"`
+	// Regressions are the cases that passed in the baseline and no longer do,
+	// Fixed those that did not and now do.
+	Regressions []string `json:"regressions,omitempty"`
+	Fixed       []string `json:"fixed,omitempty"`
+
+	Cases []*CaseResult `json:"cases"`
+}
+
+type CaseResult struct {
+	Name   string `json:"name"`
+	Status Status `json:"status"`
+	// Error is why the assistant failed to reply.
+	Error         string             `json:"error,omitempty"`
+	Reply         string             `json:"reply,omitempty"`
+	PromptVersion string             `json:"prompt_version,omitempty"`
+	ToolCalls     []ToolCall         `json:"tool_calls,omitempty"`
+	Assertions    []*AssertionResult `json:"assertions"`
+	// Duration is in seconds.
+	Duration float64 `json:"duration"`
+}
+
+type AssertionResult struct {
+	Assertion string `json:"assertion"`
+	Status    Status `json:"status"`
+	Message   string `json:"message,omitempty"`
+}
+
+// LoadReport reads a JSON report, e.g. a baseline.
+func LoadReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var r Report
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return &r, nil
+}
+
+func (r *Report) add(c *CaseResult) {
+	r.Cases = append(r.Cases, c)
+	r.Total++
+
+	switch c.Status {
+	case StatusPass:
+		r.Passed++
+	case StatusFail:
+		r.Failed++
+	case StatusError:
+		r.Errors++
+	case StatusSkip:
+		r.Skipped++
+	}
+
+	if run := r.Total - r.Skipped; run > 0 {
+		r.PassRate = float64(r.Passed) / float64(run)
+	}
+}
+
+// Compare records the regressions and fixes since the baseline, matching cases
+// by name. Cases missing from either report are ignored.
+func (r *Report) Compare(baseline *Report) {
+	rate := baseline.PassRate
+	r.BaselinePassRate = &rate
+	r.Regressions, r.Fixed = nil, nil
+
+	before := make(map[string]Status, len(baseline.Cases))
+	for _, c := range baseline.Cases {
+		before[c.Name] = c.Status
+	}
+
+	for _, c := range r.Cases {
+		was, ok := before[c.Name]
+		switch {
+		case !ok || c.Status == StatusSkip || was == StatusSkip:
+		case was == StatusPass && c.Status != StatusPass:
+			r.Regressions = append(r.Regressions, c.Name)
+		case was != StatusPass && c.Status == StatusPass:
+			r.Fixed = append(r.Fixed, c.Name)
+		}
+	}
+}
+
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteSummary writes a line per case, then the totals.
+func (r *Report) WriteSummary(w io.Writer) {
+	for _, c := range r.Cases {
+		fmt.Fprintf(w, "%-5s %s\n", strings.ToUpper(string(c.Status)), c.Name)
+		if c.Error != "" {
+			fmt.Fprintf(w, "      %s\n", c.Error)
+		}
+		for _, a := range c.Assertions {
+			if a.Status == StatusFail || a.Status == StatusError {
+				fmt.Fprintf(w, "      %s: %s\n", a.Assertion, a.Message)
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "\n%s: %d passed, %d failed, %d errors, %d skipped, pass rate %.1f%%",
+		r.Suite, r.Passed, r.Failed, r.Errors, r.Skipped, r.PassRate*100)
+	if r.BaselinePassRate != nil {
+		fmt.Fprintf(w, " (baseline %.1f%%)", *r.BaselinePassRate*100)
+	}
+	fmt.Fprintln(w)
+
+	for _, name := range r.Regressions {
+		fmt.Fprintf(w, "REGRESSION %s\n", name)
+	}
+	for _, name := range r.Fixed {
+		fmt.Fprintf(w, "FIXED %s\n", name)
+	}
+}
+
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Errors    int         `xml:"errors,attr"`
+	Skipped   int         `xml:"skipped,attr"`
+	Time      float64     `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the report as JUnit XML, for CI test report views.
+func (r *Report) WriteJUnit(w io.Writer) error {
+	suite := junitSuite{
+		Name:      r.Suite,
+		Tests:     r.Total,
+		Failures:  r.Failed,
+		Errors:    r.Errors,
+		Skipped:   r.Skipped,
+		Time:      r.Duration,
+		Timestamp: r.StartedAt.UTC().Format(time.RFC3339),
+	}
+
+	for _, c := range r.Cases {
+		jc := junitCase{Name: c.Name, Classname: r.Suite, Time: c.Duration, SystemOut: c.Reply}
+
+		var failed []string
+		for _, a := range c.Assertions {
+			if a.Status == StatusFail || a.Status == StatusError {
+				failed = append(failed, a.Assertion+": "+a.Message)
+			}
+		}
+
+		switch c.Status {
+		case StatusFail:
+			jc.Failure = &junitMessage{Message: fmt.Sprintf("%d assertions failed", len(failed)), Text: strings.Join(failed, "\n")}
+		case StatusError:
+			jc.Error = &junitMessage{Message: c.Error, Text: strings.Join(failed, "\n")}
+		case StatusSkip:
+			jc.Skipped = &junitMessage{Message: "every assertion was skipped"}
+		}
+
+		suite.Cases = append(suite.Cases, jc)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitSuites{Suites: []junitSuite{suite}}); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
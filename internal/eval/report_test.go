@@ -0,0 +1,119 @@
+package eval_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/acai-travel/tech-challenge/internal/eval"
+)
+
+func TestReport_Compare(t *testing.T) {
+	baseline := &eval.Report{PassRate: 0.5, Cases: []*eval.CaseResult{
+		{Name: "still passing", Status: eval.StatusPass},
+		{Name: "broken", Status: eval.StatusPass},
+		{Name: "fixed", Status: eval.StatusFail},
+		{Name: "still failing", Status: eval.StatusError},
+		{Name: "skipped", Status: eval.StatusSkip},
+	}}
+
+	report := &eval.Report{Cases: []*eval.CaseResult{
+		{Name: "still passing", Status: eval.StatusPass},
+		{Name: "broken", Status: eval.StatusError},
+		{Name: "fixed", Status: eval.StatusPass},
+		{Name: "still failing", Status: eval.StatusFail},
+		{Name: "skipped", Status: eval.StatusFail},
+		{Name: "new", Status: eval.StatusFail},
+	}}
+
+	report.Compare(baseline)
+
+	if !slices.Equal(report.Regressions, []string{"broken"}) {
+		t.Errorf("expected regressions [broken], got %v", report.Regressions)
+	}
+	if !slices.Equal(report.Fixed, []string{"fixed"}) {
+		t.Errorf("expected fixed [fixed], got %v", report.Fixed)
+	}
+	if report.BaselinePassRate == nil || *report.BaselinePassRate != 0.5 {
+		t.Errorf("expected baseline pass rate 0.5, got %v", report.BaselinePassRate)
+	}
+}
+
+func TestReport_JSONRoundTrip(t *testing.T) {
+	report := &eval.Report{Suite: "travel", Mode: eval.ModeFake, Total: 1, Passed: 1, PassRate: 1, Cases: []*eval.CaseResult{
+		{Name: "case", Status: eval.StatusPass, Reply: "Sunny", ToolCalls: []eval.ToolCall{{Name: "get_forecast", Arguments: map[string]any{"location": "Frankfurt"}}}},
+	}}
+
+	var buf bytes.Buffer
+	if err := report.WriteJSON(&buf); err != nil {
+		t.Fatalf("failed to write report: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := eval.LoadReport(path)
+	if err != nil {
+		t.Fatalf("failed to load report: %v", err)
+	}
+
+	if loaded.PassRate != 1 || len(loaded.Cases) != 1 || loaded.Cases[0].ToolCalls[0].Arguments["location"] != "Frankfurt" {
+		t.Errorf("unexpected report: %+v", loaded)
+	}
+}
+
+func TestReport_WriteJUnit(t *testing.T) {
+	report := &eval.Report{Suite: "travel", Total: 3, Passed: 1, Failed: 1, Errors: 1, Cases: []*eval.CaseResult{
+		{Name: "passed", Status: eval.StatusPass, Reply: "Sunny"},
+		{Name: "failed", Status: eval.StatusFail, Assertions: []*eval.AssertionResult{
+			{Assertion: `answer mentions "Frankfurt"`, Status: eval.StatusFail, Message: "not found"},
+		}},
+		{Name: "errored", Status: eval.StatusError, Error: "no completion"},
+	}}
+
+	var buf bytes.Buffer
+	if err := report.WriteJUnit(&buf); err != nil {
+		t.Fatalf("failed to write report: %v", err)
+	}
+
+	var parsed struct {
+		Suites []struct {
+			Name     string `xml:"name,attr"`
+			Tests    int    `xml:"tests,attr"`
+			Failures int    `xml:"failures,attr"`
+			Cases    []struct {
+				Name    string `xml:"name,attr"`
+				Failure *struct {
+					Text string `xml:",chardata"`
+				} `xml:"failure"`
+				Error *struct {
+					Message string `xml:"message,attr"`
+				} `xml:"error"`
+			} `xml:"testcase"`
+		} `xml:"testsuite"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &parsed); err != nil {
+		t.Fatalf("invalid XML: %v\n%s", err, buf.String())
+	}
+
+	if len(parsed.Suites) != 1 || parsed.Suites[0].Tests != 3 || parsed.Suites[0].Failures != 1 {
+		t.Fatalf("unexpected suites: %+v", parsed.Suites)
+	}
+
+	cases := parsed.Suites[0].Cases
+	if cases[0].Failure != nil || cases[0].Error != nil {
+		t.Errorf("expected the passed case to have no failure, got %+v", cases[0])
+	}
+	if cases[1].Failure == nil || !strings.Contains(cases[1].Failure.Text, "not found") {
+		t.Errorf("expected the failed case to have a failure, got %+v", cases[1])
+	}
+	if cases[2].Error == nil || cases[2].Error.Message != "no completion" {
+		t.Errorf("expected the errored case to have an error, got %+v", cases[2])
+	}
+}
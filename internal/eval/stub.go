@@ -0,0 +1,79 @@
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/acai-travel/tech-challenge/internal/chat/assistant"
+	"github.com/acai-travel/tech-challenge/internal/chat/tools"
+	"github.com/acai-travel/tech-challenge/internal/config"
+	"github.com/acai-travel/tech-challenge/internal/errs"
+)
+
+// stubTool describes itself as the real tool, so that the model gets the same
+// definitions as in production, but answers as stubbed.
+type stubTool struct {
+	tools.Tool
+	stub    Stub
+	stubbed bool
+	calls   *callLog
+}
+
+func (t *stubTool) Execute(ctx context.Context, args json.RawMessage) (string, error) {
+	var arguments map[string]any
+	_ = json.Unmarshal(args, &arguments)
+	t.calls.add(ToolCall{Name: t.Name(), Arguments: arguments})
+
+	switch {
+	case !t.stubbed:
+		return "", errs.NotFound("", "tool not stubbed in the evaluation: "+t.Name())
+	case t.stub.Error != "":
+		kind := errs.Kind(t.stub.Kind)
+		if kind == "" {
+			kind = errs.KindUpstreamUnavailable
+		}
+		return "", &errs.Error{Kind: kind, Msg: t.stub.Error}
+	default:
+		return t.stub.Result, nil
+	}
+}
+
+// callLog records the tool calls of a reply, in order.
+type callLog struct {
+	mu    sync.Mutex
+	calls []ToolCall
+}
+
+func (l *callLog) add(c ToolCall) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls = append(l.calls, c)
+}
+
+func (l *callLog) list() []ToolCall {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]ToolCall(nil), l.calls...)
+}
+
+// stubRegistry registers every tool of the service, answering as stubbed.
+// Tools without a stub fail as not found.
+func stubRegistry(stubs map[string]Stub, calls *callLog) *tools.Registry {
+	real := assistant.EnabledTools(config.Tools{
+		Weather:  config.Weather{Enabled: true},
+		Holidays: config.Holidays{Enabled: true},
+		Airport:  config.Tool{Enabled: true},
+		Date:     config.Tool{Enabled: true},
+		Time:     config.Tool{Enabled: true},
+	})
+
+	registry := tools.NewRegistry()
+	for _, name := range real.Names() {
+		t, _ := real.Get(name)
+		stub, ok := stubs[name]
+		registry.Register(&stubTool{Tool: t, stub: stub, stubbed: ok, calls: calls})
+	}
+
+	return registry
+}
@@ -0,0 +1,202 @@
+// Package eval runs suites of conversations against the assistant, with a fake,
+// recorded or live LLM and stubbed tools, and checks the replies against
+// assertions, so that prompt and tool changes can be measured before they ship.
+package eval
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Suite is a YAML file of evaluation cases.
+type Suite struct {
+	Name string `yaml:"name"`
+	// Personas cases can be answered by, by name.
+	Personas map[string]Persona `yaml:"personas"`
+	// Tools are stubs shared by every case, which cases can override.
+	Tools map[string]Stub `yaml:"tools"`
+	Cases []*Case         `yaml:"cases"`
+}
+
+type Persona struct {
+	SystemPrompt string   `yaml:"system_prompt"`
+	Model        string   `yaml:"model"`
+	Tools        []string `yaml:"tools"`
+}
+
+// Stub replaces a tool, returning Result, or failing with Error of the given
+// kind (upstream_unavailable by default).
+type Stub struct {
+	Result string `yaml:"result"`
+	Error  string `yaml:"error"`
+	Kind   string `yaml:"kind"`
+}
+
+// Case is a conversation the assistant replies to.
+type Case struct {
+	Name    string `yaml:"name"`
+	Persona string `yaml:"persona"`
+	// Messages are the conversation so far, ending with a user message.
+	Messages []Message       `yaml:"messages"`
+	Tools    map[string]Stub `yaml:"tools"`
+	// LLM are the completions the fake LLM answers with, in order.
+	LLM    []Completion `yaml:"llm"`
+	Assert []Assertion  `yaml:"assert"`
+}
+
+// Message is either a user or an assistant message.
+type Message struct {
+	User      string `yaml:"user"`
+	Assistant string `yaml:"assistant"`
+}
+
+// Completion is a scripted answer of the fake LLM: tool calls, or the content
+// of the reply.
+type Completion struct {
+	Content   string     `yaml:"content"`
+	ToolCalls []ToolCall `yaml:"tool_calls"`
+}
+
+type ToolCall struct {
+	Name      string         `yaml:"name" json:"name"`
+	Arguments map[string]any `yaml:"arguments" json:"arguments,omitempty"`
+}
+
+// Assertion checks one thing about a reply. Exactly one field but With is set.
+type Assertion struct {
+	// Called is a tool the assistant must call, with at least the arguments in
+	// With.
+	Called    string         `yaml:"called"`
+	With      map[string]any `yaml:"with"`
+	NotCalled string         `yaml:"not_called"`
+	// Contains and NotContains are matched case insensitively.
+	Contains    string `yaml:"contains"`
+	NotContains string `yaml:"not_contains"`
+	// Matches is a regular expression the reply must match.
+	Matches string `yaml:"matches"`
+	// Judge is a rubric an LLM grades the reply against.
+	Judge string `yaml:"judge"`
+}
+
+// Load reads and validates a suite.
+func Load(path string) (*Suite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var s Suite
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&s); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if err := s.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return &s, nil
+}
+
+// Validate reports the first invalid case.
+func (s *Suite) Validate() error {
+	if s.Name == "" {
+		return errors.New("name is required")
+	}
+
+	if len(s.Cases) == 0 {
+		return errors.New("no cases")
+	}
+
+	seen := make(map[string]bool)
+	for i, c := range s.Cases {
+		if c.Name == "" {
+			return fmt.Errorf("case %d: name is required", i+1)
+		}
+		if seen[c.Name] {
+			return fmt.Errorf("case %q: duplicate name", c.Name)
+		}
+		seen[c.Name] = true
+
+		if err := s.validateCase(c); err != nil {
+			return fmt.Errorf("case %q: %w", c.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Suite) validateCase(c *Case) error {
+	if c.Persona != "" {
+		if _, ok := s.Personas[c.Persona]; !ok {
+			return fmt.Errorf("unknown persona %q", c.Persona)
+		}
+	}
+
+	if len(c.Messages) == 0 {
+		return errors.New("no messages")
+	}
+	for i, m := range c.Messages {
+		if (m.User == "") == (m.Assistant == "") {
+			return fmt.Errorf("message %d: exactly one of user and assistant is required", i+1)
+		}
+	}
+	if c.Messages[len(c.Messages)-1].User == "" {
+		return errors.New("the last message must be a user message")
+	}
+
+	if len(c.Assert) == 0 {
+		return errors.New("no assertions")
+	}
+	for i, a := range c.Assert {
+		if err := a.validate(); err != nil {
+			return fmt.Errorf("assertion %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+func (a Assertion) validate() error {
+	set := 0
+	for _, v := range []string{a.Called, a.NotCalled, a.Contains, a.NotContains, a.Matches, a.Judge} {
+		if v != "" {
+			set++
+		}
+	}
+
+	if set != 1 {
+		return errors.New("exactly one of called, not_called, contains, not_contains, matches and judge is required")
+	}
+
+	if len(a.With) > 0 && a.Called == "" {
+		return errors.New("with requires called")
+	}
+
+	if a.Matches != "" {
+		if _, err := regexp.Compile(a.Matches); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// stubs returns the stubs of a case, its own replacing those of the suite.
+func (s *Suite) stubs(c *Case) map[string]Stub {
+	stubs := make(map[string]Stub, len(s.Tools)+len(c.Tools))
+	for name, stub := range s.Tools {
+		stubs[name] = stub
+	}
+	for name, stub := range c.Tools {
+		stubs[name] = stub
+	}
+	return stubs
+}
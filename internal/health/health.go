@@ -5,7 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
+	"sync/atomic"
 	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
@@ -15,67 +15,71 @@ var startTime = time.Now()
 
 type Check struct {
 	Status string            `json:"status"`
-	Checks map[string]string `json:"checks"`
+	Checks map[string]Result `json:"checks,omitempty"`
 	Uptime string            `json:"uptime"`
 }
 
+// Handler serves the liveness and readiness probes from the cached results of
+// a Monitor.
 type Handler struct {
-	db *mongo.Database
+	monitor  *Monitor
+	draining atomic.Bool
 }
 
-func NewHandler(db *mongo.Database) *Handler {
-	return &Handler{db: db}
+func NewHandler(monitor *Monitor) *Handler {
+	return &Handler{monitor: monitor}
 }
 
-func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
-	defer cancel()
+// MongoChecker pings MongoDB.
+func MongoChecker(db *mongo.Database) Checker {
+	return CheckerFunc("mongodb", func(ctx context.Context) error {
+		return db.Client().Ping(ctx, nil)
+	})
+}
 
-	checks := make(map[string]string)
-	overallStatus := "healthy"
+// Drain marks the server as shutting down, so that load balancers stop
+// routing new requests to it while in-flight ones complete.
+func (h *Handler) Drain() {
+	h.draining.Store(true)
+}
 
-	if err := h.db.Client().Ping(ctx, nil); err != nil {
-		checks["mongodb"] = "unhealthy: " + err.Error()
-		overallStatus = "unhealthy"
-	} else {
-		checks["mongodb"] = "ok"
-	}
+// Live reports that the process is up and serving, regardless of its
+// dependencies, so that it is only restarted when it hangs.
+func (h *Handler) Live(w http.ResponseWriter, r *http.Request) {
+	writeCheck(w, http.StatusOK, Check{
+		Status: "alive",
+		Uptime: formatDuration(time.Since(startTime)),
+	})
+}
 
-	if os.Getenv("OPENAI_API_KEY") == "" {
-		checks["openai"] = "warning: API key not set"
-		if overallStatus == "healthy" {
-			overallStatus = "degraded"
-		}
-	} else {
-		checks["openai"] = "ok"
+// ServeHTTP reports whether the server is ready to take traffic along with the
+// last result of every dependency check. It fails while draining or when a
+// critical dependency is not ok, and reports degraded but ready when another
+// dependency is failing.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	status := h.monitor.Status()
+	if h.draining.Load() {
+		status = "draining"
 	}
 
-	if os.Getenv("WEATHER_API_KEY") == "" {
-		checks["weather_api"] = "warning: API key not set"
-		if overallStatus == "healthy" {
-			overallStatus = "degraded"
-		}
-	} else {
-		checks["weather_api"] = "ok"
+	code := http.StatusOK
+	if status != "healthy" && status != "degraded" {
+		code = http.StatusServiceUnavailable
 	}
 
-	uptime := time.Since(startTime)
-	response := Check{
-		Status: overallStatus,
-		Checks: checks,
-		Uptime: formatDuration(uptime),
-	}
+	writeCheck(w, code, Check{
+		Status: status,
+		Checks: h.monitor.Results(),
+		Uptime: formatDuration(time.Since(startTime)),
+	})
+}
 
+func writeCheck(w http.ResponseWriter, code int, check Check) {
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
 
-	switch overallStatus {
-	case "healthy", "degraded":
-		w.WriteHeader(http.StatusOK)
-	default:
-		w.WriteHeader(http.StatusServiceUnavailable)
-	}
-
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(check)
 }
 
 func formatDuration(d time.Duration) string {
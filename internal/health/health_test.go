@@ -0,0 +1,74 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	ok := CheckerFunc("ok", func(ctx context.Context) error { return nil })
+	failing := CheckerFunc("failing", func(ctx context.Context) error { return errors.New("revoked key") })
+
+	tests := []struct {
+		name       string
+		critical   bool
+		run        bool
+		drain      bool
+		wantStatus string
+		wantCode   int
+	}{
+		{"pending critical check", true, false, false, "unhealthy", http.StatusServiceUnavailable},
+		{"failing critical check", true, true, false, "unhealthy", http.StatusServiceUnavailable},
+		{"failing optional check", false, true, false, "degraded", http.StatusOK},
+		{"draining", false, true, true, "draining", http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor := NewMonitor(time.Minute, time.Second)
+			monitor.Register(ok, true)
+			monitor.Register(failing, tt.critical)
+
+			if tt.run {
+				monitor.CheckAll(context.Background())
+			}
+
+			h := NewHandler(monitor)
+			if tt.drain {
+				h.Drain()
+			}
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("expected status code %d, got %d", tt.wantCode, rec.Code)
+			}
+
+			var got Check
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+
+			if got.Status != tt.wantStatus {
+				t.Errorf("expected status %q, got %q", tt.wantStatus, got.Status)
+			}
+
+			if tt.run && got.Checks["failing"].Error != "revoked key" {
+				t.Errorf("expected check error to be reported, got %+v", got.Checks["failing"])
+			}
+
+			rec = httptest.NewRecorder()
+			h.Live(rec, httptest.NewRequest(http.MethodGet, "/livez", nil))
+
+			if rec.Code != http.StatusOK {
+				t.Errorf("expected liveness to ignore dependencies, got %d", rec.Code)
+			}
+		})
+	}
+}
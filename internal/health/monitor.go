@@ -0,0 +1,177 @@
+package health
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/acai-travel/tech-challenge/internal/metrics"
+)
+
+// Checker checks that a dependency is reachable and usable.
+type Checker interface {
+	Name() string
+	Check(ctx context.Context) error
+}
+
+type checkerFunc struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+func (c checkerFunc) Name() string                    { return c.name }
+func (c checkerFunc) Check(ctx context.Context) error { return c.fn(ctx) }
+
+// CheckerFunc adapts a function to a Checker.
+func CheckerFunc(name string, fn func(ctx context.Context) error) Checker {
+	return checkerFunc{name: name, fn: fn}
+}
+
+const (
+	StatusPending = "pending"
+	StatusOK      = "ok"
+	StatusFailing = "failing"
+)
+
+// Result is the outcome of the last run of a check.
+type Result struct {
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	LatencyMS int64     `json:"latency_ms"`
+	CheckedAt time.Time `json:"checked_at,omitzero"`
+	// Critical checks make the server unready when failing, the others only
+	// degrade it.
+	Critical bool `json:"critical"`
+}
+
+type registration struct {
+	checker  Checker
+	critical bool
+}
+
+// Monitor runs checks in the background and caches their results, so that
+// probes answer instantly and do not hit dependencies on every request.
+type Monitor struct {
+	interval time.Duration
+	timeout  time.Duration
+
+	mu      sync.RWMutex
+	checks  []registration
+	results map[string]Result
+}
+
+func NewMonitor(interval, timeout time.Duration) *Monitor {
+	return &Monitor{
+		interval: interval,
+		timeout:  timeout,
+		results:  make(map[string]Result),
+	}
+}
+
+// Register adds a check, reported as pending until it first runs.
+func (m *Monitor) Register(c Checker, critical bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.checks = append(m.checks, registration{checker: c, critical: critical})
+	m.results[c.Name()] = Result{Status: StatusPending, Critical: critical}
+}
+
+// Run checks every dependency right away and then at every interval, until
+// the context is cancelled.
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		m.CheckAll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckAll runs every check concurrently and waits for them.
+func (m *Monitor) CheckAll(ctx context.Context) {
+	m.mu.RLock()
+	checks := append([]registration(nil), m.checks...)
+	m.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, reg := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.run(ctx, reg)
+		}()
+	}
+	wg.Wait()
+}
+
+func (m *Monitor) run(ctx context.Context, reg registration) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	name := reg.checker.Name()
+	start := time.Now()
+	err := reg.checker.Check(ctx)
+	latency := time.Since(start)
+
+	result := Result{
+		Status:    StatusOK,
+		LatencyMS: latency.Milliseconds(),
+		CheckedAt: start,
+		Critical:  reg.critical,
+	}
+
+	if err != nil {
+		result.Status = StatusFailing
+		result.Error = err.Error()
+	}
+
+	m.mu.Lock()
+	previous := m.results[name]
+	m.results[name] = result
+	m.mu.Unlock()
+
+	metrics.RecordDependencyCheck(name, err == nil, latency)
+
+	if err != nil && previous.Status != StatusFailing {
+		slog.WarnContext(ctx, "Dependency check failing", "dependency", name, "error", err)
+	} else if err == nil && previous.Status == StatusFailing {
+		slog.InfoContext(ctx, "Dependency check recovered", "dependency", name)
+	}
+}
+
+// Results returns the last result of every check.
+func (m *Monitor) Results() map[string]Result {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	results := make(map[string]Result, len(m.results))
+	for name, r := range m.results {
+		results[name] = r
+	}
+	return results
+}
+
+// Status summarizes the results: unhealthy when a critical check is not ok,
+// degraded when another check is failing, healthy otherwise.
+func (m *Monitor) Status() string {
+	status := "healthy"
+
+	for _, r := range m.Results() {
+		switch {
+		case r.Critical && r.Status != StatusOK:
+			return "unhealthy"
+		case r.Status == StatusFailing:
+			status = "degraded"
+		}
+	}
+
+	return status
+}
@@ -0,0 +1,45 @@
+package httpx
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/acai-travel/tech-challenge/internal/auth"
+	"github.com/twitchtv/twirp"
+)
+
+// Auth authenticates requests with an API key, sent in the X-API-Key header or
+// as a bearer token, or with a bearer JWT, and stores the principal in the
+// request context. Requests without valid credentials are rejected with a
+// Twirp unauthenticated error.
+func Auth(authn *auth.Authenticator) func(handler http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, err := authn.Authenticate(r.Context(), credential(r))
+			if err != nil {
+				if !errors.Is(err, auth.ErrMissingCredentials) {
+					slog.WarnContext(r.Context(), "Authentication failed", "error", err, "http_path", r.URL.Path)
+				}
+
+				w.Header().Set("WWW-Authenticate", `Bearer realm="acai"`)
+				_ = twirp.WriteError(w, twirp.NewError(twirp.Unauthenticated, err.Error()))
+				return
+			}
+
+			handler.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+func credential(r *http.Request) string {
+	if v := r.Header.Get("Authorization"); v != "" {
+		scheme, token, ok := strings.Cut(v, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+
+	return r.Header.Get("X-API-Key")
+}
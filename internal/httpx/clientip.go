@@ -0,0 +1,30 @@
+package httpx
+
+import (
+	"context"
+	"net/http"
+)
+
+type clientIPKey struct{}
+
+// WithClientIP returns a context carrying the IP address of the caller.
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIP returns the IP address of the caller, empty outside of a request.
+func ClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
+
+// StoreClientIP stores the IP address of the caller in the request context,
+// taken from the last X-Forwarded-For entry with trustProxy, as RateLimit
+// does, so that clients can't forge it.
+func StoreClientIP(trustProxy bool) func(handler http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handler.ServeHTTP(w, r.WithContext(WithClientIP(r.Context(), clientIP(r, trustProxy))))
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package httpx_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/acai-travel/tech-challenge/internal/httpx"
+)
+
+func TestStoreClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		trustProxy bool
+		forwarded  string
+		want       string
+	}{
+		{"remote address", false, "", "192.0.2.1"},
+		{"forwarded header ignored", false, "203.0.113.7", "192.0.2.1"},
+		{"forwarded header trusted", true, "198.51.100.4, 203.0.113.7", "203.0.113.7"},
+		// The client sent its own X-Forwarded-For, the proxy appended the address it saw.
+		{"spoofed forwarded entry ignored", true, "10.0.0.1, 192.0.2.99 ,203.0.113.7", "203.0.113.7"},
+		{"no forwarded header", true, "", "192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := httpx.StoreClientIP(tt.trustProxy)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = httpx.ClientIP(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/twirp/acai.chat.ChatService/ListConversations", nil)
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package httpx
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/acai-travel/tech-challenge/internal/metrics"
+	"github.com/twitchtv/twirp"
+)
+
+type rpcStartKey struct{}
+
+type rpcCodeKey struct{}
+
+// ServerHooks records the count and latency of every RPC by method and Twirp
+// error code, and logs failed RPCs with their error metadata: server errors as
+// errors, client errors as warnings. Errors with a retry_after metadata get a
+// Retry-After header.
+func ServerHooks() *twirp.ServerHooks {
+	return &twirp.ServerHooks{
+		RequestReceived: func(ctx context.Context) (context.Context, error) {
+			return context.WithValue(ctx, rpcStartKey{}, time.Now()), nil
+		},
+		Error: func(ctx context.Context, err twirp.Error) context.Context {
+			method, _ := twirp.MethodName(ctx)
+
+			attrs := []any{"rpc_method", method, "twirp_code", err.Code(), "error", err.Msg()}
+			if meta := err.MetaMap(); len(meta) > 0 {
+				attrs = append(attrs, "twirp_meta", meta)
+			}
+
+			if retryAfter := err.Meta("retry_after"); retryAfter != "" {
+				_ = twirp.SetHTTPResponseHeader(ctx, "Retry-After", retryAfter)
+			}
+
+			if twirp.ServerHTTPStatusFromErrorCode(err.Code()) >= 500 {
+				slog.ErrorContext(ctx, "RPC failed", attrs...)
+			} else {
+				slog.WarnContext(ctx, "RPC rejected", attrs...)
+			}
+
+			return context.WithValue(ctx, rpcCodeKey{}, string(err.Code()))
+		},
+		ResponseSent: func(ctx context.Context) {
+			start, ok := ctx.Value(rpcStartKey{}).(time.Time)
+			if !ok {
+				return
+			}
+
+			service, _ := twirp.ServiceName(ctx)
+			method, ok := twirp.MethodName(ctx)
+			if !ok {
+				// The request did not match any method.
+				method = "unknown"
+			}
+
+			code, ok := ctx.Value(rpcCodeKey{}).(string)
+			if !ok {
+				code = "ok"
+			}
+
+			metrics.RecordRPC(service, method, code, time.Since(start))
+		},
+	}
+}
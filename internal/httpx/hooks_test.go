@@ -0,0 +1,58 @@
+package httpx_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/acai-travel/tech-challenge/internal/httpx"
+	"github.com/acai-travel/tech-challenge/internal/metrics"
+	"github.com/acai-travel/tech-challenge/internal/pb"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/twitchtv/twirp"
+)
+
+// chatService fails to describe conversations and lists none.
+type chatService struct {
+	pb.ChatService
+}
+
+func (chatService) DescribeConversation(ctx context.Context, req *pb.DescribeConversationRequest) (*pb.DescribeConversationResponse, error) {
+	return nil, twirp.NotFoundError("conversation not found")
+}
+
+func (chatService) ListConversations(ctx context.Context, req *pb.ListConversationsRequest) (*pb.ListConversationsResponse, error) {
+	return &pb.ListConversationsResponse{}, nil
+}
+
+func TestServerHooks(t *testing.T) {
+	srv := httptest.NewServer(pb.NewChatServiceServer(chatService{}, twirp.WithServerHooks(httpx.ServerHooks())))
+	t.Cleanup(srv.Close)
+
+	tests := []struct {
+		method string
+		code   string
+	}{
+		{"ListConversations", "ok"},
+		{"DescribeConversation", "not_found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			counter := metrics.RPCRequestsTotal.WithLabelValues("ChatService", tt.method, tt.code)
+			before := testutil.ToFloat64(counter)
+
+			resp, err := http.Post(srv.URL+pb.ChatServicePathPrefix+tt.method, "application/json", strings.NewReader("{}"))
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			resp.Body.Close()
+
+			if got := testutil.ToFloat64(counter) - before; got != 1 {
+				t.Errorf("rpc_requests_total{method=%q,code=%q} increased by %v, want 1", tt.method, tt.code, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package httpx
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// languageTag loosely matches a BCP 47 language tag, e.g. de or pt-BR.
+var languageTag = regexp.MustCompile(`^[A-Za-z]{2,8}(-[A-Za-z0-9]{1,8})*$`)
+
+type localeKey struct{}
+
+// WithLocale returns a context carrying the locale of the user.
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeKey{}, locale)
+}
+
+// Locale returns the locale of the user, empty when unknown.
+func Locale(ctx context.Context) string {
+	locale, _ := ctx.Value(localeKey{}).(string)
+	return locale
+}
+
+// AcceptLanguage stores the preferred language of the Accept-Language header
+// in the request context as the locale of the user.
+func AcceptLanguage() func(handler http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if locale := preferredLanguage(r.Header.Get("Accept-Language")); locale != "" {
+				r = r.WithContext(WithLocale(r.Context(), locale))
+			}
+
+			handler.ServeHTTP(w, r)
+		})
+	}
+}
+
+// preferredLanguage returns the language with the highest weight, the first
+// one on ties, ignoring the * wildcard and anything malformed.
+func preferredLanguage(header string) string {
+	best, bestQ := "", 0.0
+
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !languageTag.MatchString(tag) {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if w, err := strconv.ParseFloat(v, 64); err == nil && w >= 0 && w <= 1 {
+				q = w
+			} else {
+				q = 0
+			}
+		}
+
+		if q > bestQ {
+			best, bestQ = tag, q
+		}
+	}
+
+	return best
+}
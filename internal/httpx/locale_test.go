@@ -0,0 +1,43 @@
+package httpx_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/acai-travel/tech-challenge/internal/httpx"
+)
+
+func TestAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"de-DE", "de-DE"},
+		{"fr-CH, fr;q=0.9, en;q=0.8, *;q=0.5", "fr-CH"},
+		{"en;q=0.5, es-ES;q=0.8", "es-ES"},
+		{"*", ""},
+		{"en;q=abc, pt-BR;q=0.1", "pt-BR"},
+		{"<script>, nl", "nl"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			var got string
+			handler := httpx.AcceptLanguage()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = httpx.Locale(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/twirp/acai.chat.ChatService/StartConversation", nil)
+			if tt.header != "" {
+				req.Header.Set("Accept-Language", tt.header)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.want {
+				t.Errorf("Locale() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -29,9 +29,10 @@ func Logger() func(handler http.Handler) http.Handler {
 
 				metrics.RecordRequest(r.Method, r.URL.Path, saw.status, duration)
 
-				// Skip logging for metrics endpoint to avoid noise
+				// Skip logging for metrics and probe endpoints to avoid noise
 				// Clear console and all data is on Grafana
-				if r.URL.Path == "/metrics" {
+				switch r.URL.Path {
+				case "/metrics", "/livez", "/readyz", "/health":
 					return
 				}
 
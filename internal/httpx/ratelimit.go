@@ -0,0 +1,108 @@
+package httpx
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/acai-travel/tech-challenge/internal/auth"
+	"github.com/acai-travel/tech-challenge/internal/metrics"
+	"github.com/acai-travel/tech-challenge/internal/ratelimit"
+	"github.com/twitchtv/twirp"
+)
+
+// RateLimit throttles requests per API key, per JWT user or, for anonymous
+// requests, per client IP, and rejects callers that used up their daily LLM
+// tokens. Rejected requests get a Twirp resource exhausted error and a
+// Retry-After header. It must run after Auth to see the principal.
+//
+// With trustProxy the client IP is taken from X-Forwarded-For, which is only
+// safe behind a proxy that sets it.
+func RateLimit(limiter *ratelimit.Limiter, trustProxy bool) func(handler http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := callerKey(r, trustProxy)
+
+			if retryAfter, ok := limiter.Allow(key); !ok {
+				metrics.RecordThrottled("rate", string(key.Kind))
+				slog.WarnContext(r.Context(), "Request rate limited", "caller", key.String(), "retry_after", retryAfter)
+
+				err := ratelimit.RateLimitedError(retryAfter)
+				w.Header().Set("Retry-After", err.Meta("retry_after"))
+				_ = twirp.WriteError(w, err)
+				return
+			}
+
+			ctx := ratelimit.WithCaller(r.Context(), limiter, key)
+
+			if retryAfter, ok := limiter.CheckQuota(key); !ok {
+				metrics.RecordThrottled("quota", string(key.Kind))
+				slog.WarnContext(ctx, "Daily token quota exceeded", "caller", key.String(), "retry_after", retryAfter)
+
+				err := ratelimit.QuotaExceededError(retryAfter)
+				w.Header().Set("Retry-After", err.Meta("retry_after"))
+				_ = twirp.WriteError(w, err)
+				return
+			}
+
+			handler.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// LimitIP throttles requests per client IP, whoever the caller is. It runs
+// before Auth so that requests failing authentication are limited too.
+func LimitIP(limiter *ratelimit.Limiter, trustProxy bool) func(handler http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := ratelimit.Key{Kind: ratelimit.KindIP, ID: clientIP(r, trustProxy)}
+
+			if retryAfter, ok := limiter.Allow(key); !ok {
+				metrics.RecordThrottled("rate", string(key.Kind))
+				slog.WarnContext(r.Context(), "Request rate limited", "caller", key.String(), "retry_after", retryAfter)
+
+				err := ratelimit.RateLimitedError(retryAfter)
+				w.Header().Set("Retry-After", err.Meta("retry_after"))
+				_ = twirp.WriteError(w, err)
+				return
+			}
+
+			handler.ServeHTTP(w, r)
+		})
+	}
+}
+
+func callerKey(r *http.Request, trustProxy bool) ratelimit.Key {
+	if p, ok := auth.FromContext(r.Context()); ok {
+		if p.KeyID != "" {
+			return ratelimit.Key{Kind: ratelimit.KindAPIKey, ID: p.KeyID}
+		}
+		return ratelimit.Key{Kind: ratelimit.KindUser, ID: p.UserID}
+	}
+
+	return ratelimit.Key{Kind: ratelimit.KindIP, ID: clientIP(r, trustProxy)}
+}
+
+// clientIP returns the IP address of the caller. With trustProxy it is the
+// last X-Forwarded-For entry, the one added by the proxy: the entries before
+// it come from the client and can be forged.
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+			last := xff[len(xff)-1]
+			if i := strings.LastIndex(last, ","); i >= 0 {
+				last = last[i+1:]
+			}
+			if ip := strings.TrimSpace(last); ip != "" {
+				return ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,41 @@
+package httpx_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/acai-travel/tech-challenge/internal/httpx"
+	"github.com/acai-travel/tech-challenge/internal/ratelimit"
+)
+
+func TestLimitIP(t *testing.T) {
+	// Every request fails authentication, as with a wrong API key.
+	unauthorized := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	handler := httpx.LimitIP(ratelimit.New(ratelimit.Limit{RequestsPerMinute: 1, Burst: 2}, nil), true)(unauthorized)
+
+	send := func(forwarded string) int {
+		req := httptest.NewRequest(http.MethodPost, "/twirp/acai.chat.ChatService/ListConversations", nil)
+		req.Header.Set("X-Forwarded-For", forwarded)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for i := range 2 {
+		if code := send("203.0.113.7"); code != http.StatusUnauthorized {
+			t.Fatalf("request %d: expected 401, got %d", i+1, code)
+		}
+	}
+
+	// Prepending addresses does not get the client a new bucket.
+	if code := send("198.51.100.4, 203.0.113.7"); code != http.StatusTooManyRequests {
+		t.Errorf("expected failed logins to be rate limited, got %d", code)
+	}
+
+	if code := send("198.51.100.4"); code != http.StatusUnauthorized {
+		t.Errorf("expected another IP not to be limited, got %d", code)
+	}
+}
@@ -0,0 +1,50 @@
+package httpx
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/acai-travel/tech-challenge/internal/logx"
+)
+
+// RequestIDHeader carries the ID of a request, echoed on its response.
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID stores an ID for every request in its context, so that its log
+// records can be told apart, and echoes it in the response header. An ID sent
+// by the client or a proxy is kept when it looks sane, otherwise a random one
+// is generated.
+func RequestID() func(handler http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIDHeader)
+			if !validRequestID(id) {
+				id = newRequestID()
+			}
+
+			w.Header().Set(RequestIDHeader, id)
+			handler.ServeHTTP(w, r.WithContext(logx.WithRequestID(r.Context(), id)))
+		})
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID accepts up to 128 printable ASCII characters without spaces,
+// keeping client provided IDs from injecting anything into logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,126 @@
+// Package logx sets up structured logging correlated with traces: every record
+// logged with a context carries the trace, span and request IDs found in it.
+package logx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/acai-travel/tech-challenge/internal/config"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Handler adds trace_id, span_id and request_id attributes, taken from the
+// context of each record, to the records it passes to the wrapped handler.
+type Handler struct {
+	slog.Handler
+}
+
+// NewHandler wraps h to correlate its records with traces and requests.
+func NewHandler(h slog.Handler) *Handler {
+	return &Handler{Handler: h}
+}
+
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(
+			slog.String("trace_id", sc.TraceID().String()),
+			slog.String("span_id", sc.SpanID().String()),
+		)
+	}
+
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &Handler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{Handler: h.Handler.WithGroup(name)}
+}
+
+// New creates a logger writing to w in the configured format, from the
+// configured level. Records are also passed to the extra handlers, e.g. to
+// export them over OTLP.
+func New(w io.Writer, cfg config.Log, extra ...slog.Handler) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", cfg.Level, err)
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+
+	var h slog.Handler
+	switch cfg.Format {
+	case "json":
+		h = slog.NewJSONHandler(w, opts)
+	case "text":
+		h = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q", cfg.Format)
+	}
+
+	if len(extra) > 0 {
+		h = &fanout{level: level, handlers: append([]slog.Handler{h}, extra...)}
+	}
+
+	return slog.New(NewHandler(h)), nil
+}
+
+// fanout passes the records from a level to several handlers.
+type fanout struct {
+	level    slog.Leveler
+	handlers []slog.Handler
+}
+
+func (f *fanout) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= f.level.Level()
+}
+
+func (f *fanout) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range f.handlers {
+		if h.Enabled(ctx, r.Level) {
+			errs = append(errs, h.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f *fanout) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return f.with(func(h slog.Handler) slog.Handler { return h.WithAttrs(attrs) })
+}
+
+func (f *fanout) WithGroup(name string) slog.Handler {
+	return f.with(func(h slog.Handler) slog.Handler { return h.WithGroup(name) })
+}
+
+func (f *fanout) with(fn func(slog.Handler) slog.Handler) slog.Handler {
+	handlers := make([]slog.Handler, len(f.handlers))
+	for i, h := range f.handlers {
+		handlers[i] = fn(h)
+	}
+	return &fanout{level: f.level, handlers: handlers}
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying the ID of the request it serves.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the ID of the request the context serves, empty outside
+// of a request.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,101 @@
+package logx_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/acai-travel/tech-challenge/internal/config"
+	"github.com/acai-travel/tech-challenge/internal/logx"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestHandler_Correlation(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logx.New(&buf, config.Log{Level: "info", Format: "json"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	ctx, span := sdktrace.NewTracerProvider().Tracer("test").Start(context.Background(), "test")
+	defer span.End()
+	ctx = logx.WithRequestID(ctx, "req-1")
+
+	logger.With("component", "test").InfoContext(ctx, "hello")
+	logger.Info("no context")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d log lines, want 2: %s", len(lines), buf.String())
+	}
+
+	var record map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("invalid JSON log line %q: %v", lines[0], err)
+	}
+
+	want := map[string]string{
+		"trace_id":   span.SpanContext().TraceID().String(),
+		"span_id":    span.SpanContext().SpanID().String(),
+		"request_id": "req-1",
+		"component":  "test",
+	}
+	for k, v := range want {
+		if record[k] != v {
+			t.Errorf("%s = %v, want %q", k, record[k], v)
+		}
+	}
+
+	if strings.Contains(lines[1], "trace_id") || strings.Contains(lines[1], "request_id") {
+		t.Errorf("record without context got correlation IDs: %s", lines[1])
+	}
+}
+
+func TestNew_Level(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logx.New(&buf, config.Log{Level: "warn", Format: "text"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	logger.Info("dropped")
+	logger.Warn("kept")
+
+	if strings.Contains(buf.String(), "dropped") || !strings.Contains(buf.String(), "kept") {
+		t.Errorf("unexpected output for level warn: %s", buf.String())
+	}
+	if !logger.Enabled(context.Background(), slog.LevelError) {
+		t.Error("error level should be enabled")
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	for _, cfg := range []config.Log{
+		{Level: "verbose", Format: "text"},
+		{Level: "info", Format: "xml"},
+	} {
+		if _, err := logx.New(&bytes.Buffer{}, cfg); err == nil {
+			t.Errorf("New(%+v) succeeded, want an error", cfg)
+		}
+	}
+}
+
+func TestNew_ExtraHandlers(t *testing.T) {
+	var out, extra bytes.Buffer
+	logger, err := logx.New(&out, config.Log{Level: "info", Format: "text"}, slog.NewJSONHandler(&extra, nil))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	logger.Debug("dropped")
+	logger.With("component", "test").Info("kept")
+
+	for name, buf := range map[string]*bytes.Buffer{"writer": &out, "extra handler": &extra} {
+		if strings.Contains(buf.String(), "dropped") || !strings.Contains(buf.String(), "kept") || !strings.Contains(buf.String(), "component") {
+			t.Errorf("unexpected %s output: %s", name, buf.String())
+		}
+	}
+}
@@ -25,6 +25,135 @@ var (
 		},
 		[]string{"method", "path", "status"},
 	)
+
+	RPCRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rpc_requests_total",
+			Help: "Total number of Twirp RPCs by method and error code, ok on success",
+		},
+		[]string{"service", "method", "code"},
+	)
+
+	RPCDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "rpc_duration_seconds",
+			Help:    "Twirp RPC duration in seconds",
+			Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 40, 80},
+		},
+		[]string{"service", "method", "code"},
+	)
+
+	ThrottledRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ratelimit_throttled_total",
+			Help: "Total number of requests rejected by rate limits or daily token quotas",
+		},
+		[]string{"reason", "kind"},
+	)
+
+	DependencyUp = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "dependency_up",
+			Help: "Whether the last check of a dependency succeeded (1) or failed (0)",
+		},
+		[]string{"dependency"},
+	)
+
+	DependencyCheckDuration = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "dependency_check_duration_seconds",
+			Help: "Duration of the last check of a dependency in seconds",
+		},
+		[]string{"dependency"},
+	)
+
+	ConversationsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "chat_conversations_total",
+			Help: "Total number of conversations started, continued, edited, regenerated and forked",
+		},
+		[]string{"event"},
+	)
+
+	ConversationMessages = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "chat_conversation_messages",
+			Help:    "Number of messages in a conversation after each reply",
+			Buckets: prometheus.ExponentialBuckets(2, 2, 8),
+		},
+	)
+
+	AgentIterations = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "chat_agent_iterations",
+			Help:    "Number of LLM calls made by the agent loop for a reply",
+			Buckets: []float64{1, 2, 3, 4, 5, 6, 8, 10, 15},
+		},
+	)
+
+	ReplyTerminationsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "chat_reply_terminations_total",
+			Help: "Total number of replies by the reason the agent loop ended",
+		},
+		[]string{"reason"},
+	)
+
+	ReplyPhaseDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "chat_reply_phase_duration_seconds",
+			Help:    "Time a reply spent waiting on the LLM and running tools, in seconds",
+			Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 40, 80},
+		},
+		[]string{"phase"},
+	)
+
+	FeedbackTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "chat_feedback_total",
+			Help: "Total number of ratings of replies by rating and the model that generated them",
+		},
+		[]string{"rating", "model"},
+	)
+
+	FeedbackToolsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "chat_feedback_tools_total",
+			Help: "Total number of ratings of replies by rating and tool called, none for replies without tool calls",
+		},
+		[]string{"rating", "tool"},
+	)
+
+	GuardrailEventsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "chat_guardrail_events_total",
+			Help: "Total number of guardrail findings by stage, check, kind of finding and action taken",
+		},
+		[]string{"stage", "check", "kind", "action"},
+	)
+
+	AuditEventsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "chat_audit_events_total",
+			Help: "Total number of audit events by action and whether they were stored",
+		},
+		[]string{"action", "result"},
+	)
+
+	TitleFailuresTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "chat_title_failures_total",
+			Help: "Total number of conversations left untitled because title generation failed",
+		},
+	)
+)
+
+// Reasons the agent loop of a reply ended.
+const (
+	TerminationCompleted     = "completed"
+	TerminationMaxIterations = "max_iterations"
+	TerminationQuota         = "quota"
+	TerminationError         = "error"
 )
 
 func RecordRequest(method, path string, status int, duration time.Duration) {
@@ -32,3 +161,75 @@ func RecordRequest(method, path string, status int, duration time.Duration) {
 	HttpRequestsTotal.WithLabelValues(method, path, statusStr).Inc()
 	HttpRequestDuration.WithLabelValues(method, path, statusStr).Observe(duration.Seconds())
 }
+
+func RecordRPC(service, method, code string, duration time.Duration) {
+	RPCRequestsTotal.WithLabelValues(service, method, code).Inc()
+	RPCDuration.WithLabelValues(service, method, code).Observe(duration.Seconds())
+}
+
+// RecordThrottled counts a request rejected for reason ("rate" or "quota"),
+// labelled by how the caller was identified (API key, user or IP).
+func RecordThrottled(reason, kind string) {
+	ThrottledRequestsTotal.WithLabelValues(reason, kind).Inc()
+}
+
+func RecordDependencyCheck(dependency string, up bool, latency time.Duration) {
+	v := 0.0
+	if up {
+		v = 1
+	}
+	DependencyUp.WithLabelValues(dependency).Set(v)
+	DependencyCheckDuration.WithLabelValues(dependency).Set(latency.Seconds())
+}
+
+// RecordConversation counts a conversation started or continued with a reply,
+// along with its messages.
+func RecordConversation(event string, messages int) {
+	ConversationsTotal.WithLabelValues(event).Inc()
+	ConversationMessages.Observe(float64(messages))
+}
+
+// RecordReply records how the agent loop of a reply ended, the number of LLM
+// calls it made and the time spent in the LLM and in tools.
+func RecordReply(reason string, iterations int, llm, tools time.Duration) {
+	ReplyTerminationsTotal.WithLabelValues(reason).Inc()
+	AgentIterations.Observe(float64(iterations))
+	ReplyPhaseDuration.WithLabelValues("llm").Observe(llm.Seconds())
+	ReplyPhaseDuration.WithLabelValues("tool").Observe(tools.Seconds())
+}
+
+// RecordFeedback counts a rating of a reply generated by model, once per tool
+// the reply called. Replaced ratings are counted again.
+func RecordFeedback(rating, model string, tools []string) {
+	if model == "" {
+		model = "unknown"
+	}
+	FeedbackTotal.WithLabelValues(rating, model).Inc()
+
+	if len(tools) == 0 {
+		FeedbackToolsTotal.WithLabelValues(rating, "none").Inc()
+	}
+	for _, tool := range tools {
+		FeedbackToolsTotal.WithLabelValues(rating, tool).Inc()
+	}
+}
+
+// RecordGuardrail counts what a guardrail check found in content at a stage
+// (input, tool or output) and whether it was redacted or blocked, or a failed
+// check.
+func RecordGuardrail(stage, check, kind, action string) {
+	GuardrailEventsTotal.WithLabelValues(stage, check, kind, action).Inc()
+}
+
+// RecordAudit counts an audit event of an action, stored or failed.
+func RecordAudit(action string, stored bool) {
+	result := "stored"
+	if !stored {
+		result = "failed"
+	}
+	AuditEventsTotal.WithLabelValues(action, result).Inc()
+}
+
+func RecordTitleFailure() {
+	TitleFailuresTotal.Inc()
+}
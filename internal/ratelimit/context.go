@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/acai-travel/tech-challenge/internal/errs"
+	"github.com/acai-travel/tech-challenge/internal/metrics"
+	"github.com/twitchtv/twirp"
+)
+
+type callerKey struct{}
+
+type caller struct {
+	limiter *Limiter
+	key     Key
+}
+
+// WithCaller attaches the limiter and the caller of a request to the context,
+// so that the LLM tokens consumed while serving it are charged to the caller.
+func WithCaller(ctx context.Context, l *Limiter, key Key) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller{limiter: l, key: key})
+}
+
+// CheckQuota returns a resource exhausted error when the caller of the request
+// has used up its daily LLM tokens. It is a no-op outside of rate limited
+// requests.
+func CheckQuota(ctx context.Context) error {
+	c, ok := ctx.Value(callerKey{}).(caller)
+	if !ok {
+		return nil
+	}
+
+	if retryAfter, ok := c.limiter.CheckQuota(c.key); !ok {
+		metrics.RecordThrottled("quota", string(c.key.Kind))
+
+		// Sets the header on the Twirp response when called from a handler.
+		_ = twirp.SetHTTPResponseHeader(ctx, "Retry-After", errs.RetryAfterSeconds(retryAfter))
+
+		return QuotaExceededError(retryAfter)
+	}
+
+	return nil
+}
+
+// RecordTokens charges LLM tokens to the caller of the request.
+func RecordTokens(ctx context.Context, tokens int64) {
+	if c, ok := ctx.Value(callerKey{}).(caller); ok {
+		c.limiter.AddTokens(c.key, tokens)
+	}
+}
+
+// RateLimitedError is returned when a caller sends requests faster than its limit.
+func RateLimitedError(retryAfter time.Duration) twirp.Error {
+	return errs.Twirp(errs.RateLimited("", "rate limit exceeded, retry in "+retryAfter.String(), retryAfter))
+}
+
+// QuotaExceededError is returned when a caller has used up its daily LLM tokens.
+func QuotaExceededError(retryAfter time.Duration) twirp.Error {
+	return errs.Twirp(errs.BudgetExceeded("daily token quota exceeded", retryAfter))
+}
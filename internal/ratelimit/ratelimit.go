@@ -0,0 +1,206 @@
+// Package ratelimit throttles callers with a token bucket on requests and a
+// daily quota on the LLM tokens their requests consume.
+//
+// State is kept in memory, so limits apply per server instance and daily usage
+// is reset when the server restarts.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit configures how much a single caller may use the service. Zero values
+// disable the corresponding limit.
+type Limit struct {
+	// RequestsPerMinute is the rate at which the request bucket refills.
+	RequestsPerMinute float64 `json:"requests_per_minute"`
+	// Burst is the size of the request bucket, defaulting to one minute of requests.
+	Burst int `json:"burst,omitempty"`
+	// DailyTokens is the number of LLM tokens a caller may consume per UTC day.
+	DailyTokens int64 `json:"daily_tokens,omitempty"`
+}
+
+func (l Limit) burst() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return math.Max(1, math.Ceil(l.RequestsPerMinute))
+}
+
+// Kind tells how a caller was identified.
+type Kind string
+
+const (
+	KindAPIKey Kind = "key"
+	KindUser   Kind = "user"
+	KindIP     Kind = "ip"
+)
+
+// Key identifies a caller: the API key it used, the user of its JWT or, for
+// anonymous requests, its IP address.
+type Key struct {
+	Kind Kind
+	ID   string
+}
+
+func (k Key) String() string {
+	return string(k.Kind) + ":" + k.ID
+}
+
+// idleTimeout is how long the request bucket of an inactive caller is kept.
+const idleTimeout = 10 * time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type usage struct {
+	day    time.Time
+	tokens int64
+}
+
+// Limiter enforces a default limit on every caller, or a per-key limit for the
+// API keys that have one.
+type Limiter struct {
+	defaults Limit
+	keys     map[string]Limit
+	now      func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[Key]*bucket
+	usage     map[Key]*usage
+	lastSweep time.Time
+}
+
+// New creates a limiter applying defaults to every caller, except for the API
+// key IDs listed in keys, which replace the defaults entirely.
+func New(defaults Limit, keys map[string]Limit) *Limiter {
+	return &Limiter{
+		defaults: defaults,
+		keys:     keys,
+		now:      time.Now,
+		buckets:  make(map[Key]*bucket),
+		usage:    make(map[Key]*usage),
+	}
+}
+
+// Limit returns the limit applied to the caller.
+func (l *Limiter) Limit(key Key) Limit {
+	if key.Kind == KindAPIKey {
+		if limit, ok := l.keys[key.ID]; ok {
+			return limit
+		}
+	}
+	return l.defaults
+}
+
+// Allow takes a request from the caller's bucket. When the bucket is empty it
+// returns false and how long until the next request is allowed.
+func (l *Limiter) Allow(key Key) (time.Duration, bool) {
+	limit := l.Limit(key)
+	if limit.RequestsPerMinute <= 0 {
+		return 0, true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	rate := limit.RequestsPerMinute / time.Minute.Seconds()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: limit.burst(), last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(limit.burst(), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return time.Duration(math.Ceil((1-b.tokens)/rate)) * time.Second, false
+	}
+
+	b.tokens--
+	return 0, true
+}
+
+// CheckQuota reports whether the caller still has LLM tokens left today. When
+// it does not, it returns false and how long until the quota resets.
+func (l *Limiter) CheckQuota(key Key) (time.Duration, bool) {
+	limit := l.Limit(key)
+	if limit.DailyTokens <= 0 {
+		return 0, true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if u, ok := l.usage[key]; ok && u.day.Equal(day(now)) && u.tokens >= limit.DailyTokens {
+		return day(now).AddDate(0, 0, 1).Sub(now), false
+	}
+
+	return 0, true
+}
+
+// AddTokens charges LLM tokens to the caller's daily quota.
+func (l *Limiter) AddTokens(key Key, tokens int64) {
+	if tokens <= 0 || l.Limit(key).DailyTokens <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	today := day(l.now())
+
+	u, ok := l.usage[key]
+	if !ok || !u.day.Equal(today) {
+		u = &usage{day: today}
+		l.usage[key] = u
+	}
+
+	u.tokens += tokens
+}
+
+// Usage returns the LLM tokens the caller consumed today.
+func (l *Limiter) Usage(key Key) int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if u, ok := l.usage[key]; ok && u.day.Equal(day(l.now())) {
+		return u.tokens
+	}
+	return 0
+}
+
+// sweep forgets the buckets of inactive callers and usage from previous days,
+// so that the state does not grow with every IP ever seen.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > idleTimeout {
+			delete(l.buckets, key)
+		}
+	}
+
+	for key, u := range l.usage {
+		if u.day.Before(day(now)) {
+			delete(l.usage, key)
+		}
+	}
+}
+
+func day(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
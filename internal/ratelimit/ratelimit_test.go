@@ -0,0 +1,119 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/twitchtv/twirp"
+)
+
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestLimiter(defaults Limit, keys map[string]Limit) (*Limiter, *clock) {
+	c := &clock{t: time.Date(2025, 8, 20, 23, 0, 0, 0, time.UTC)}
+	l := New(defaults, keys)
+	l.now = c.now
+	return l, c
+}
+
+func TestLimiter_Allow(t *testing.T) {
+	l, c := newTestLimiter(Limit{RequestsPerMinute: 6, Burst: 2}, nil)
+	key := Key{Kind: KindIP, ID: "10.0.0.1"}
+
+	for i := range 2 {
+		if _, ok := l.Allow(key); !ok {
+			t.Fatalf("request %d within burst was throttled", i+1)
+		}
+	}
+
+	retryAfter, ok := l.Allow(key)
+	if ok {
+		t.Fatal("expected request over burst to be throttled")
+	}
+
+	if retryAfter != 10*time.Second {
+		t.Errorf("expected retry after 10s, got %v", retryAfter)
+	}
+
+	if _, ok := l.Allow(Key{Kind: KindIP, ID: "10.0.0.2"}); !ok {
+		t.Error("expected other callers to have their own bucket")
+	}
+
+	c.advance(10 * time.Second)
+
+	if _, ok := l.Allow(key); !ok {
+		t.Error("expected bucket to refill after retry delay")
+	}
+}
+
+func TestLimiter_PerKeyLimits(t *testing.T) {
+	l, _ := newTestLimiter(Limit{RequestsPerMinute: 1, Burst: 1}, map[string]Limit{"ci": {}})
+
+	ci := Key{Kind: KindAPIKey, ID: "ci"}
+	for range 10 {
+		if _, ok := l.Allow(ci); !ok {
+			t.Fatal("expected key without limits to never be throttled")
+		}
+	}
+
+	// A user with the same ID as the key is not affected by its override.
+	user := Key{Kind: KindUser, ID: "ci"}
+	l.Allow(user)
+	if _, ok := l.Allow(user); ok {
+		t.Error("expected default limit to apply to users")
+	}
+}
+
+func TestLimiter_Quota(t *testing.T) {
+	l, c := newTestLimiter(Limit{DailyTokens: 1000}, nil)
+	key := Key{Kind: KindAPIKey, ID: "dev"}
+
+	l.AddTokens(key, 600)
+	if _, ok := l.CheckQuota(key); !ok {
+		t.Fatal("expected quota left after 600 tokens")
+	}
+
+	l.AddTokens(key, 400)
+	retryAfter, ok := l.CheckQuota(key)
+	if ok {
+		t.Fatal("expected quota to be exhausted after 1000 tokens")
+	}
+
+	if retryAfter != time.Hour {
+		t.Errorf("expected quota to reset at midnight UTC in 1h, got %v", retryAfter)
+	}
+
+	c.advance(time.Hour)
+
+	if _, ok := l.CheckQuota(key); !ok {
+		t.Error("expected quota to reset on the next day")
+	}
+
+	if got := l.Usage(key); got != 0 {
+		t.Errorf("expected no usage on the next day, got %d", got)
+	}
+}
+
+func TestCheckQuota(t *testing.T) {
+	if err := CheckQuota(context.Background()); err != nil {
+		t.Fatalf("expected no error outside of rate limited requests, got %v", err)
+	}
+
+	l, _ := newTestLimiter(Limit{DailyTokens: 10}, nil)
+	ctx := WithCaller(context.Background(), l, Key{Kind: KindIP, ID: "10.0.0.1"})
+
+	RecordTokens(ctx, 10)
+
+	err := CheckQuota(ctx)
+	if te, ok := err.(twirp.Error); !ok || te.Code() != twirp.ResourceExhausted {
+		t.Fatalf("expected twirp.ResourceExhausted error, got %v", err)
+	}
+
+	if got := err.(twirp.Error).Meta("retry_after"); got != "3600" {
+		t.Errorf("expected retry_after 3600, got %q", got)
+	}
+}
@@ -2,69 +2,185 @@ package telemetry
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os" // Added for os.Getenv
+	"runtime/debug"
+	"strings"
 
+	"github.com/acai-travel/tech-challenge/internal/config"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/log/global"
 	"go.opentelemetry.io/otel/propagation"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
 	"go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	"go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
 )
 
-func Init(ctx context.Context, serviceName string) (func(context.Context) error, error) {
-	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			semconv.ServiceName(serviceName),
-		),
-	)
+// Init sets up the global tracer, meter and logger providers. Metrics are
+// always served to Prometheus, and traces, metrics and logs are exported over
+// OTLP gRPC when enabled. The returned function flushes and stops them.
+func Init(ctx context.Context, cfg config.Telemetry) (func(context.Context) error, error) {
+	res, err := newResource(ctx, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create resource: %w", err)
 	}
 
-	var tp *trace.TracerProvider
+	headers, err := config.ParseHeaders(cfg.Headers)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTLP headers: %w", err)
+	}
+
+	traceOpts := []trace.TracerProviderOption{
+		trace.WithResource(res),
+		trace.WithSampler(sampler(cfg.Sampling)),
+	}
+
+	if cfg.TracesEnabled {
+		opts := exporterOptions(cfg, headers, otlptracegrpc.WithHeaders, otlptracegrpc.WithInsecure, otlptracegrpc.WithEndpointURL, otlptracegrpc.WithEndpoint)
 
-	if os.Getenv("JAEGER_ENABLED") == "true" {
-		traceExporter, err := otlptracegrpc.New(ctx, otlptracegrpc.WithInsecure())
+		traceExporter, err := otlptracegrpc.New(ctx, opts...)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create trace exporter: %w", err)
 		}
 
-		tp = trace.NewTracerProvider(
-			trace.WithBatcher(traceExporter),
-			trace.WithResource(res),
-		)
-	} else {
-		// In case Jaeger is disabled
-		tp = trace.NewTracerProvider(
-			trace.WithResource(res),
-		)
+		traceOpts = append(traceOpts, trace.WithBatcher(traceExporter))
 	}
 
+	tp := trace.NewTracerProvider(traceOpts...)
+
 	otel.SetTracerProvider(tp)
 	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
 
-	metricExporter, err := prometheus.New()
+	promExporter, err := prometheus.New()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create prometheus exporter: %w", err)
 	}
 
-	mp := metric.NewMeterProvider(
-		metric.WithReader(metricExporter),
+	metricOpts := []metric.Option{
+		metric.WithReader(promExporter),
 		metric.WithResource(res),
-	)
+	}
+
+	if cfg.MetricsEnabled {
+		opts := exporterOptions(cfg, headers, otlpmetricgrpc.WithHeaders, otlpmetricgrpc.WithInsecure, otlpmetricgrpc.WithEndpointURL, otlpmetricgrpc.WithEndpoint)
+
+		metricExporter, err := otlpmetricgrpc.New(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create metric exporter: %w", err)
+		}
+
+		metricOpts = append(metricOpts, metric.WithReader(
+			metric.NewPeriodicReader(metricExporter, metric.WithInterval(cfg.MetricsInterval)),
+		))
+	}
+
+	mp := metric.NewMeterProvider(metricOpts...)
 	otel.SetMeterProvider(mp)
 
-	return func(ctx context.Context) error {
-		if err := tp.Shutdown(ctx); err != nil {
-			return err
+	shutdown := []func(context.Context) error{tp.Shutdown, mp.Shutdown}
+
+	if cfg.LogsEnabled {
+		opts := exporterOptions(cfg, headers, otlploggrpc.WithHeaders, otlploggrpc.WithInsecure, otlploggrpc.WithEndpointURL, otlploggrpc.WithEndpoint)
+
+		logExporter, err := otlploggrpc.New(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create log exporter: %w", err)
 		}
-		if err := mp.Shutdown(ctx); err != nil {
-			return err
+
+		lp := sdklog.NewLoggerProvider(
+			sdklog.WithProcessor(sdklog.NewBatchProcessor(logExporter)),
+			sdklog.WithResource(res),
+		)
+		global.SetLoggerProvider(lp)
+		shutdown = append(shutdown, lp.Shutdown)
+	}
+
+	return func(ctx context.Context) error {
+		var errs []error
+		for _, fn := range shutdown {
+			errs = append(errs, fn(ctx))
 		}
-		return nil
+		return errors.Join(errs...)
 	}, nil
 }
+
+// exporterOptions returns the endpoint, TLS and header options shared by the
+// OTLP exporters, built with the option functions of each exporter package.
+func exporterOptions[O any](cfg config.Telemetry, headers map[string]string,
+	withHeaders func(map[string]string) O, withInsecure func() O, withEndpointURL, withEndpoint func(string) O,
+) []O {
+	opts := []O{withHeaders(headers)}
+	if cfg.Insecure {
+		opts = append(opts, withInsecure())
+	}
+	if strings.Contains(cfg.Endpoint, "://") {
+		opts = append(opts, withEndpointURL(cfg.Endpoint))
+	} else if cfg.Endpoint != "" {
+		opts = append(opts, withEndpoint(cfg.Endpoint))
+	}
+	return opts
+}
+
+func newResource(ctx context.Context, cfg config.Telemetry) (*resource.Resource, error) {
+	version := cfg.ServiceVersion
+	if version == "" {
+		version = buildVersion()
+	}
+
+	return resource.New(ctx,
+		resource.WithTelemetrySDK(),
+		// OTEL_RESOURCE_ATTRIBUTES adds attributes, e.g. the pod name.
+		resource.WithFromEnv(),
+		resource.WithAttributes(
+			semconv.ServiceName(cfg.ServiceName),
+			semconv.ServiceVersion(version),
+			semconv.DeploymentEnvironmentName(cfg.Environment),
+		),
+	)
+}
+
+// sampler samples the configured ratio of traces, following the decision of
+// the parent span when configured to.
+func sampler(cfg config.Sampling) trace.Sampler {
+	root := trace.TraceIDRatioBased(cfg.Ratio)
+	if cfg.ParentBased {
+		return trace.ParentBased(root)
+	}
+	return root
+}
+
+// buildVersion is the VCS revision the binary was built from, suffixed with
+// -dirty for uncommitted changes, or the module version.
+func buildVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+
+	var revision, modified string
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.modified":
+			modified = s.Value
+		}
+	}
+
+	if revision == "" {
+		return info.Main.Version
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if modified == "true" {
+		revision += "-dirty"
+	}
+	return revision
+}
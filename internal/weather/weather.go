@@ -3,21 +3,69 @@ package weather
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
-	"os"
+
+	"github.com/acai-travel/tech-challenge/internal/errs"
 )
 
 const (
 	baseURL = "https://api.weatherapi.com/v1"
+
+	// upstream names WeatherAPI in errors.
+	upstream = "weather_api"
 )
 
-func GetCurrentWeather(ctx context.Context, location string) (*WeatherResponse, error) {
-	apiKey := os.Getenv("WEATHER_API_KEY")
-	if apiKey == "" {
-		return nil, fmt.Errorf("WEATHER_API_KEY environment variable not set")
+// Client calls WeatherAPI with an API key.
+type Client struct {
+	apiKey string
+}
+
+func NewClient(apiKey string) *Client {
+	return &Client{apiKey: apiKey}
+}
+
+// Check searches a location, failing on an invalid or revoked API key.
+func (c *Client) Check(ctx context.Context) error {
+	if c.apiKey == "" {
+		return errs.Unavailable(upstream, "API key is not configured (WEATHER_API_KEY)", nil)
+	}
+
+	u, err := url.Parse(baseURL + "/search.json")
+	if err != nil {
+		return fmt.Errorf("failed to parse URL: %w", err)
+	}
+
+	q := u.Query()
+	q.Set("key", c.apiKey)
+	q.Set("q", "London")
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errs.Unavailable(upstream, "request failed", requestError(err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return apiError(resp.StatusCode, body)
+	}
+
+	return nil
+}
+
+func (c *Client) GetCurrentWeather(ctx context.Context, location string) (*WeatherResponse, error) {
+	if c.apiKey == "" {
+		return nil, errs.Unavailable(upstream, "API key is not configured (WEATHER_API_KEY)", nil)
 	}
 
 	u, err := url.Parse(baseURL + "/current.json")
@@ -26,7 +74,7 @@ func GetCurrentWeather(ctx context.Context, location string) (*WeatherResponse,
 	}
 
 	q := u.Query()
-	q.Set("key", apiKey)
+	q.Set("key", c.apiKey)
 	q.Set("q", location)
 	q.Set("lang", "en")
 	u.RawQuery = q.Encode()
@@ -40,35 +88,30 @@ func GetCurrentWeather(ctx context.Context, location string) (*WeatherResponse,
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
+		return nil, errs.Unavailable(upstream, "request failed", requestError(err))
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, errs.Unavailable(upstream, "failed to read response body", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		var errResp ErrorResponse
-		if err := json.Unmarshal(body, &errResp); err != nil {
-			return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
-		}
-		return nil, fmt.Errorf("API error %d: %s", errResp.Error.Code, errResp.Error.Message)
+		return nil, apiError(resp.StatusCode, body)
 	}
 
 	var weatherResp WeatherResponse
 	if err := json.Unmarshal(body, &weatherResp); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+		return nil, errs.Unavailable(upstream, "invalid response", err)
 	}
 
 	return &weatherResp, nil
 }
 
-func GetForecast(ctx context.Context, location string, days int, hour *int, date string) (*ForecastResponse, error) {
-	apiKey := os.Getenv("WEATHER_API_KEY")
-	if apiKey == "" {
-		return nil, fmt.Errorf("WEATHER_API_KEY environment variable not set")
+func (c *Client) GetForecast(ctx context.Context, location string, days int, hour *int, date string) (*ForecastResponse, error) {
+	if c.apiKey == "" {
+		return nil, errs.Unavailable(upstream, "API key is not configured (WEATHER_API_KEY)", nil)
 	}
 
 	u, err := url.Parse(baseURL + "/forecast.json")
@@ -77,7 +120,7 @@ func GetForecast(ctx context.Context, location string, days int, hour *int, date
 	}
 
 	q := u.Query()
-	q.Set("key", apiKey)
+	q.Set("key", c.apiKey)
 	q.Set("q", location)
 	q.Set("days", fmt.Sprintf("%d", days))
 	if hour != nil {
@@ -100,27 +143,59 @@ func GetForecast(ctx context.Context, location string, days int, hour *int, date
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
+		return nil, errs.Unavailable(upstream, "request failed", requestError(err))
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, errs.Unavailable(upstream, "failed to read response body", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		var errResp ErrorResponse
-		if err := json.Unmarshal(body, &errResp); err != nil {
-			return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
-		}
-		return nil, fmt.Errorf("API error %d: %s", errResp.Error.Code, errResp.Error.Message)
+		return nil, apiError(resp.StatusCode, body)
 	}
 
 	var forecastResp ForecastResponse
 	if err := json.Unmarshal(body, &forecastResp); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+		return nil, errs.Unavailable(upstream, "invalid response", err)
 	}
 
 	return &forecastResp, nil
 }
+
+// requestError drops the URL from a failed request's error, as it carries the
+// API key.
+func requestError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
+
+// apiError classifies an error response of WeatherAPI by its error code, see
+// https://www.weatherapi.com/docs/#intro-error-codes.
+func apiError(status int, body []byte) error {
+	var errResp ErrorResponse
+	if err := json.Unmarshal(body, &errResp); err != nil || errResp.Error.Message == "" {
+		errResp.Error.Message = http.StatusText(status)
+	}
+
+	msg := errResp.Error.Message
+
+	switch errResp.Error.Code {
+	case 1006: // No location found matching parameter q.
+		return errs.NotFound(upstream, msg)
+	case 1003, 1005, 9000, 9001: // Missing q, invalid request URL, invalid bulk body.
+		return errs.InvalidInput("location", msg)
+	case 2007: // API key has exceeded calls per month quota.
+		return errs.RateLimited(upstream, msg, 0)
+	}
+
+	if status == http.StatusTooManyRequests {
+		return errs.RateLimited(upstream, msg, 0)
+	}
+
+	return errs.Unavailable(upstream, fmt.Sprintf("API error (status %d)", status), errors.New(msg))
+}